@@ -0,0 +1,59 @@
+// Package aferofs adapts afero file systems for extraction with
+// untar.WithFS:
+//
+//	fsys := afero.NewMemMapFs()
+//	err := untar.Untar(r, "/dst", untar.WithFS(aferofs.New(fsys)))
+//
+// Symbolic links are supported if afero file system implements
+// afero.Symlinker; hard links, named pipes and device nodes are not supported.
+package aferofs
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/artyom/untar"
+	"github.com/spf13/afero"
+)
+
+// New returns untar.WriteFS backed by fsys.
+func New(fsys afero.Fs) untar.WriteFS {
+	if _, ok := fsys.(afero.Symlinker); ok {
+		return symlinkFS{aferoFS{fsys}}
+	}
+	return aferoFS{fsys}
+}
+
+type aferoFS struct {
+	afero.Fs
+}
+
+func (f aferoFS) OpenFile(name string, flag int, perm os.FileMode) (io.WriteCloser, error) {
+	return f.Fs.OpenFile(name, flag, perm)
+}
+
+func (f aferoFS) Lstat(name string) (os.FileInfo, error) {
+	if l, ok := f.Fs.(afero.Lstater); ok {
+		fi, _, err := l.LstatIfPossible(name)
+		return fi, err
+	}
+	return f.Fs.Stat(name)
+}
+
+// symlinkFS is aferoFS supporting symbolic links
+type symlinkFS struct {
+	aferoFS
+}
+
+func (f symlinkFS) Symlink(oldname, newname string) error {
+	err := f.Fs.(afero.Linker).SymlinkIfPossible(oldname, newname)
+	if errors.Is(err, afero.ErrNoSymlink) {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: errors.ErrUnsupported}
+	}
+	return err
+}
+
+func (f symlinkFS) Readlink(name string) (string, error) {
+	return f.Fs.(afero.LinkReader).ReadlinkIfPossible(name)
+}
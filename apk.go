@@ -0,0 +1,55 @@
+package untar
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+)
+
+// APKData reads Alpine Linux package (.apk file) from r, skipping its
+// signature and control segments, and returns reader of uncompressed tar
+// stream of package data segment, which can be passed to Untar.
+//
+// Package is a concatenation of separately gzip-compressed tar streams:
+// optional signature (holding .SIGN.* files), control (holding .PKGINFO) and
+// data; the first two are cut without end of archive marker. Newer apk v3
+// format is not supported.
+func APKData(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(4); bytes.HasPrefix(magic, []byte("ADB")) {
+		return nil, errors.New("apk v3 package format is not supported")
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		zr.Multistream(false)
+		seg := bufio.NewReaderSize(zr, 512)
+		hdr, err := seg.Peek(512)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		name := hdr
+		if len(name) > 100 {
+			name = name[:100]
+		}
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		if !bytes.HasPrefix(name, []byte(".SIGN.")) && !bytes.Equal(name, []byte(".PKGINFO")) {
+			return seg, nil
+		}
+		if _, err := io.Copy(io.Discard, seg); err != nil {
+			return nil, err
+		}
+		if err := zr.Reset(br); err != nil {
+			if err == io.EOF {
+				return nil, errors.New("apk package has no data segment")
+			}
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package untar
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ulikunitz/xz"
+)
+
+// arMagic starts ar archives, like Debian packages and static libraries
+const arMagic = "!<arch>\n"
+
+// ARTar reads ar archive from r and returns reader of tar stream holding its
+// members as regular files, which can be passed to Untar. Both GNU and BSD
+// variants of long names are supported; symbol tables are skipped. Closing
+// returned reader stops the conversion.
+func ARTar(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() { pw.CloseWithError(arToTar(pw, r)) }()
+	return pr
+}
+
+func arToTar(w io.Writer, r io.Reader) error {
+	ar, err := newARReader(r)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	for {
+		hdr, err := ar.next()
+		if err == io.EOF {
+			return tw.Close()
+		}
+		if err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(tw, ar, hdr.Size); err != nil {
+			return unexpectedEOF(err)
+		}
+	}
+}
+
+// DebData reads Debian package (.deb file) from r and returns reader of
+// uncompressed tar stream of its data.tar member, which can be passed to
+// Untar. Members compressed with gzip, xz, zstd and bzip2 are supported, as
+// well as formats registered with RegisterDecompressor.
+func DebData(r io.Reader) (io.Reader, error) {
+	ar, err := newARReader(r)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		hdr, err := ar.next()
+		if err == io.EOF {
+			return nil, errors.New("deb package has no data.tar member")
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case hdr.Name == "debian-binary":
+			b, err := io.ReadAll(io.LimitReader(ar, 16))
+			if err != nil {
+				return nil, err
+			}
+			if v := strings.TrimSpace(string(b)); !strings.HasPrefix(v, "2.") {
+				return nil, fmt.Errorf("unsupported deb package format version %q", v)
+			}
+		case hdr.Name == "data.tar":
+			return ar, nil
+		case strings.HasPrefix(hdr.Name, "data.tar."):
+			ext := strings.TrimPrefix(hdr.Name, "data.tar.")
+			switch ext {
+			case "gz", "zst":
+				return decompress(ar, hdr.Name)
+			case "xz":
+				return xz.NewReader(ar)
+			case "bz2":
+				return bzip2.NewReader(ar), nil
+			}
+			if rd, err := Decompress(bufio.NewReader(ar), hdr.Name); rd != nil || err != nil {
+				return rd, err
+			}
+			return nil, fmt.Errorf("deb package data compressed with unsupported %q format", ext)
+		}
+	}
+}
+
+// arReader reads members of ar archive, see ARTar
+type arReader struct {
+	br    *bufio.Reader
+	cur   io.Reader // data of the current member
+	pad   bool      // current member is followed by padding byte
+	names []byte    // GNU long names table
+}
+
+func newARReader(r io.Reader) (*arReader, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(arMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != arMagic {
+		return nil, errors.New("not an ar archive")
+	}
+	return &arReader{br: br, cur: bytes.NewReader(nil)}, nil
+}
+
+func (ar *arReader) Read(p []byte) (int, error) { return ar.cur.Read(p) }
+
+// next skips to the next member, returning its header
+func (ar *arReader) next() (*tar.Header, error) {
+	for {
+		if _, err := io.Copy(io.Discard, ar.cur); err != nil {
+			return nil, err
+		}
+		if ar.pad {
+			if _, err := ar.br.Discard(1); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+		}
+		var buf [60]byte
+		if _, err := io.ReadFull(ar.br, buf[:]); err != nil {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, unexpectedEOF(err)
+		}
+		if string(buf[58:60]) != "`\n" {
+			return nil, errors.New("invalid ar member header")
+		}
+		field := func(i, j int) string { return strings.TrimRight(string(buf[i:j]), " ") }
+		size, err := strconv.ParseInt(field(48, 58), 10, 64)
+		if err != nil || size < 0 {
+			return nil, errors.New("invalid ar member size")
+		}
+		mtime, _ := strconv.ParseInt(field(16, 28), 10, 64)
+		uid, _ := strconv.Atoi(field(28, 34))
+		gid, _ := strconv.Atoi(field(34, 40))
+		mode, _ := strconv.ParseInt(field(40, 48), 8, 64)
+		ar.cur, ar.pad = io.LimitReader(ar.br, size), size%2 != 0
+		name := field(0, 16)
+		switch {
+		case name == "/" || name == "/SYM64/" || name == "__.SYMDEF" || name == "__.SYMDEF SORTED":
+			continue // symbol table
+		case name == "//":
+			if size > 1<<20 {
+				return nil, errors.New("ar long names table is too large")
+			}
+			if ar.names, err = io.ReadAll(ar.cur); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			continue
+		case strings.HasPrefix(name, "#1/"):
+			// BSD: name of given length precedes data
+			n, err := strconv.ParseInt(name[3:], 10, 64)
+			if err != nil || n < 0 || n > size || n > 4096 {
+				return nil, errors.New("invalid ar member name length")
+			}
+			b := make([]byte, n)
+			if _, err := io.ReadFull(ar.cur, b); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			name, size = string(bytes.TrimRight(b, "\x00")), size-n
+		case len(name) > 1 && name[0] == '/':
+			// GNU: offset in long names table
+			off, err := strconv.Atoi(name[1:])
+			if err != nil || off < 0 || off >= len(ar.names) {
+				return nil, errors.New("invalid ar long name reference")
+			}
+			name = string(ar.names[off:])
+			if i := strings.Index(name, "/\n"); i >= 0 {
+				name = name[:i]
+			}
+		default:
+			name = strings.TrimSuffix(name, "/")
+		}
+		return &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Size:     size,
+			Mode:     mode & 07777,
+			Uid:      uid,
+			Gid:      gid,
+			ModTime:  time.Unix(mtime, 0),
+			Format:   tar.FormatPAX,
+		}, nil
+	}
+}
@@ -0,0 +1,166 @@
+package untar
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// arMember returns ar member with raw name field and data, padded to even
+// length
+func arMember(name, data string) string {
+	s := fmt.Sprintf("%-16s%-12d%-6d%-6d%-8o%-10d`\n", name, 1600000000, 0, 0, 0644, len(data)) + data
+	if len(data)%2 != 0 {
+		s += "\n"
+	}
+	return s
+}
+
+func TestARTar(t *testing.T) {
+	longName := "a-rather-long-member-name.o"
+	for _, tc := range []struct {
+		name    string
+		archive string
+		want    string
+		err     string // error substring, empty if none expected
+	}{
+		{
+			name:    "short names",
+			archive: arMagic + arMember("a.o/", "odd") + arMember("b.o", "even"),
+			want:    "0 a.o 644 \"odd\"\n0 b.o 644 \"even\"\n",
+		},
+		{
+			name:    "symbol tables",
+			archive: arMagic + arMember("/", "syms") + arMember("__.SYMDEF", "x") + arMember("a.o/", "a"),
+			want:    "0 a.o 644 \"a\"\n",
+		},
+		{
+			name:    "GNU long names",
+			archive: arMagic + arMember("//", "x/\n"+longName+"/\n") + arMember("/3", "a") + arMember("/0", "b"),
+			want:    "0 " + longName + " 644 \"a\"\n0 x 644 \"b\"\n",
+		},
+		{
+			name:    "BSD long names",
+			archive: arMagic + arMember(fmt.Sprintf("#1/%d", len(longName)), longName+"data") + arMember("#1/4", "x\x00\x00\x00"),
+			want:    "0 " + longName + " 644 \"data\"\n0 x 644\n",
+		},
+		{
+			name:    "empty",
+			archive: arMagic,
+		},
+		{
+			name:    "not ar",
+			archive: "!<arch>",
+			err:     "not an ar archive",
+		},
+		{
+			name:    "bad header",
+			archive: arMagic + strings.Replace(arMember("a", "a"), "`\n", "``", 1),
+			err:     "invalid ar member header",
+		},
+		{
+			name:    "bad size",
+			archive: arMagic + strings.Replace(arMember("a", "a"), "1         `", "-1        `", 1),
+			err:     "invalid ar member size",
+		},
+		{
+			name:    "GNU name without table",
+			archive: arMagic + arMember("/0", "a"),
+			err:     "invalid ar long name reference",
+		},
+		{
+			name:    "GNU name outside of table",
+			archive: arMagic + arMember("//", "x/\n") + arMember("/4", "a"),
+			err:     "invalid ar long name reference",
+		},
+		{
+			name:    "BSD name longer than member",
+			archive: arMagic + arMember("#1/5", "abc"),
+			err:     "invalid ar member name length",
+		},
+		{
+			name:    "truncated data",
+			archive: (arMagic + arMember("a", "data"))[:len(arMagic)+62],
+			err:     io.ErrUnexpectedEOF.Error(),
+		},
+		{
+			name:    "truncated header",
+			archive: arMagic + arMember("a", "a")[:30],
+			err:     io.ErrUnexpectedEOF.Error(),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := ARTar(strings.NewReader(tc.archive))
+			defer r.Close()
+			got, err := tarEntries(r)
+			switch {
+			case tc.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+				t.Fatalf("got error %v, want one containing %q", err, tc.err)
+			}
+			if got != tc.want {
+				t.Errorf("got entries:\n%swant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDebData(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("compressed"))
+	zw.Close()
+	for _, tc := range []struct {
+		name    string
+		archive string
+		want    string
+		err     string // error substring, empty if none expected
+	}{
+		{
+			name:    "plain",
+			archive: arMagic + arMember("debian-binary", "2.0\n") + arMember("control.tar", "c") + arMember("data.tar", "plain"),
+			want:    "plain",
+		},
+		{
+			name:    "gzip",
+			archive: arMagic + arMember("debian-binary", "2.0\n") + arMember("data.tar.gz", gz.String()),
+			want:    "compressed",
+		},
+		{
+			name:    "unsupported version",
+			archive: arMagic + arMember("debian-binary", "3.0\n") + arMember("data.tar", "plain"),
+			err:     "unsupported deb package format version",
+		},
+		{
+			name:    "unsupported compression",
+			archive: arMagic + arMember("debian-binary", "2.0\n") + arMember("data.tar.foo", "x"),
+			err:     "unsupported \"foo\" format",
+		},
+		{
+			name:    "no data",
+			archive: arMagic + arMember("debian-binary", "2.0\n") + arMember("control.tar", "c"),
+			err:     "no data.tar member",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := DebData(strings.NewReader(tc.archive))
+			var got []byte
+			if err == nil {
+				got, err = io.ReadAll(r)
+			}
+			switch {
+			case tc.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+				t.Fatalf("got error %v, want one containing %q", err, tc.err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("got data %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package untar
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// ErrUnknownFormat is returned by Open and NewReader for data that is neither
+// an archive nor compressed with one of supported formats.
+var ErrUnknownFormat = errors.New("unknown archive format: neither tar or cpio nor compressed with gzip, bzip2, xz or zstd")
+
+// WithDecoderMemory limits memory decompressors of Open and NewReader may use
+// for their windows to about limit bytes: xz streams needing bigger
+// dictionary are rejected upfront, zstd frames needing bigger window fail to
+// decode. Buffers of data decompressed ahead of reads take up to another half
+// of limit. Zero means no limit. The option has no effect on extraction.
+func WithDecoderMemory(limit int64) Option {
+	return func(c *config) { c.decoderMemory = limit }
+}
+
+// Open opens archive by name, which is either a local file name or URL
+// accepted by OpenSource, and returns reader of tar stream it holds, see
+// NewReader. Closing the reader closes the archive.
+func Open(ctx context.Context, name string, opts ...Option) (io.ReadCloser, error) {
+	f, err := OpenSource(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	rd, err := NewReader(f, name, opts...)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &archiveReader{Reader: rd, closers: []io.Closer{f, rd}}, nil
+}
+
+// NewReader returns reader of tar stream held by archive read from r, which
+// can be passed to Untar. Compression with gzip, bzip2, xz and zstd, as well
+// as formats registered with RegisterDecompressor, is detected by magic bytes
+// rather than name, so that misnamed files and streams are handled. Archives
+// in cpio and ar formats are converted to tar, Debian packages yield their
+// data.tar member, see DebData. Alpine packages can't be told by contents and
+// are detected by ".apk" extension of name, see APKData. Other data is
+// rejected with ErrUnknownFormat unless it looks like tar archive. Name may
+// be empty. Closing the reader stops background decompression and conversion,
+// it doesn't close r.
+func NewReader(r io.Reader, name string, opts ...Option) (io.ReadCloser, error) {
+	c := new(config)
+	for _, opt := range opts {
+		opt(c)
+	}
+	rd := &archiveReader{}
+	if strings.HasSuffix(name, ".apk") {
+		data, err := APKData(r)
+		if err != nil {
+			return nil, err
+		}
+		rd.Reader = data
+		return rd, nil
+	}
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(arMagic) + len(debMember)); bytes.HasPrefix(magic, []byte(arMagic)) {
+		if !bytes.HasSuffix(magic, []byte(debMember)) {
+			ar := ARTar(br)
+			rd.Reader = ar
+			rd.closers = append(rd.closers, ar)
+			return rd, nil
+		}
+		data, err := DebData(br)
+		if err != nil {
+			return nil, err
+		}
+		rd.Reader = data
+		if cl, ok := data.(io.Closer); ok {
+			rd.closers = append(rd.closers, cl)
+		}
+		return rd, nil
+	}
+	dr, closer, err := c.decompressArchive(br, name)
+	if err != nil {
+		return nil, err
+	}
+	if closer != nil {
+		rd.closers = append(rd.closers, closer)
+	}
+	br = bufio.NewReader(dr)
+	if magic, _ := br.Peek(len(cpioMagic)); bytes.HasPrefix(magic, cpioMagic) {
+		tr := CPIOTar(br)
+		rd.Reader = tr
+		rd.closers = append(rd.closers, tr)
+		return rd, nil
+	}
+	rd.Reader = br
+	return rd, nil
+}
+
+// archiveReader reads from possibly layered readers, closing all of them on
+// Close
+type archiveReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (a *archiveReader) Close() error {
+	var err error
+	for i := len(a.closers) - 1; i >= 0; i-- {
+		if err2 := a.closers[i].Close(); err2 != nil && err == nil {
+			err = err2
+		}
+	}
+	return err
+}
+
+// magic bytes of compressed streams and archives; Debian packages are ar
+// archives having debMember first
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	cpioMagic  = []byte("07070")
+	debMember  = []byte("debian-binary")
+)
+
+// decompressArchive detects compression of data read from br by its magic
+// bytes, returning reader of uncompressed data and, if the decompressor needs
+// to be closed, its closer. Data that is neither compressed nor looks like
+// tar or cpio archive is rejected with ErrUnknownFormat.
+func (c *config) decompressArchive(br *bufio.Reader, name string) (io.Reader, io.Closer, error) {
+	size := readaheadSize(c.decoderMemory)
+	magic, _ := br.Peek(len(xzMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		ra := newReadahead(gr, size)
+		return ra, ra, nil
+	case bytes.HasPrefix(magic, bzip2Magic):
+		ra := newReadahead(bzip2.NewReader(br), size)
+		return ra, ra, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		var zopts []zstd.DOption
+		if c.decoderMemory > 0 {
+			zopts = append(zopts, zstd.WithDecoderLowmem(true), zstd.WithDecoderConcurrency(1),
+				zstd.WithDecoderMaxMemory(uint64(c.decoderMemory)))
+		}
+		zr, err := zstd.NewReader(br, zopts...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr.IOReadCloser(), nil
+	case bytes.HasPrefix(magic, xzMagic):
+		if dict, ok := xzDictSize(br); ok && c.decoderMemory > 0 && dict > c.decoderMemory {
+			return nil, nil, fmt.Errorf("xz dictionary of %d bytes exceeds decoder memory limit", dict)
+		}
+		xr, err := xz.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		ra := newReadahead(xr, size)
+		return ra, ra, nil
+	}
+	if rc, err := Decompress(br, name); err != nil {
+		return nil, nil, err
+	} else if rc != nil {
+		ra := newReadahead(rc, size)
+		return ra, ra, nil
+	}
+	if !bytes.HasPrefix(magic, cpioMagic) && !looksLikeTar(br) {
+		return nil, nil, ErrUnknownFormat
+	}
+	return br, nil, nil
+}
+
+// xzDictSize returns dictionary size of LZMA2 filter found in the first block
+// header of xz stream read from br, reporting false if there is none
+func xzDictSize(br *bufio.Reader) (int64, bool) {
+	const streamHeader = 12
+	b, err := br.Peek(streamHeader + 1)
+	if err != nil || b[streamHeader] == 0 {
+		return 0, false // no blocks
+	}
+	size := (int(b[streamHeader]) + 1) * 4
+	if b, err = br.Peek(streamHeader + size); err != nil {
+		return 0, false
+	}
+	b = b[streamHeader : streamHeader+size-4] // without CRC32
+	flags, p := b[1], 2
+	varint := func() (uint64, bool) {
+		v, n := binary.Uvarint(b[p:])
+		p += n
+		return v, n > 0
+	}
+	for _, bit := range []byte{0x40, 0x80} { // compressed and uncompressed sizes
+		if flags&bit != 0 {
+			if _, ok := varint(); !ok {
+				return 0, false
+			}
+		}
+	}
+	for i := 0; i <= int(flags&3); i++ {
+		id, ok := varint()
+		n, ok2 := varint()
+		if !ok || !ok2 || n > uint64(len(b)-p) {
+			return 0, false
+		}
+		props := b[p : p+int(n)]
+		p += int(n)
+		if id == 0x21 && len(props) == 1 && props[0] <= 40 {
+			if props[0] == 40 {
+				return 1<<32 - 1, true
+			}
+			return int64(2|props[0]&1) << (props[0]/2 + 11), true
+		}
+	}
+	return 0, false
+}
+
+// looksLikeTar reports whether data read from br starts with tar header:
+// either with ustar magic at offset 257 or, for old V7 archives, with valid
+// header checksum
+func looksLikeTar(br *bufio.Reader) bool {
+	blk, err := br.Peek(512)
+	if err != nil {
+		return len(blk) == 0 // empty input is an empty archive
+	}
+	if bytes.Equal(blk[257:262], []byte("ustar")) {
+		return true
+	}
+	want, err := strconv.ParseUint(strings.Trim(string(blk[148:156]), " \x00"), 8, 64)
+	if err != nil {
+		return bytes.Count(blk, []byte{0}) == len(blk) // end of archive block
+	}
+	var sum uint64
+	for i, b := range blk {
+		if i >= 148 && i < 156 {
+			b = ' '
+		}
+		sum += uint64(b)
+	}
+	return sum == want
+}
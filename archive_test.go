@@ -0,0 +1,109 @@
+package untar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+func TestNewReader(t *testing.T) {
+	ball, err := io.ReadAll(tarball(t, reg("a"), reg("b")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const entries = "0 a 644 \"a\"\n0 b 644 \"b\"\n"
+	compress := func(data []byte, newWriter func(io.Writer) (io.WriteCloser, error)) []byte {
+		var buf bytes.Buffer
+		w, err := newWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	gzipWriter := func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }
+	cpio := newc(cpioEntry{name: "a", mode: 0100644, nlink: 1, data: "a"})
+	gz := compress(ball, gzipWriter)
+	zst := compress(ball, func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) })
+	xzc := compress(ball, func(w io.Writer) (io.WriteCloser, error) { return xz.NewWriter(w) })
+	for _, tc := range []struct {
+		name    string
+		archive []byte
+		opts    []Option
+		want    string
+		err     error  // expected error, if any
+		errText string // error substring, if err is nil
+	}{
+		{name: "plain", archive: ball, want: entries},
+		{name: "gzip", archive: gz, want: entries},
+		{name: "zstd", archive: zst, want: entries},
+		{name: "xz", archive: xzc, want: entries},
+		{name: "x.tar.gz", archive: gz, want: entries}, // misnamed
+		{name: "empty", archive: nil, want: ""},
+		{name: "cpio", archive: cpio, want: "0 a 644 \"a\"\n"},
+		{name: "cpio.gz", archive: compress(cpio, gzipWriter), want: "0 a 644 \"a\"\n"},
+		{name: "ar", archive: []byte(arMagic + arMember("a", "a")), want: "0 a 644 \"a\"\n"},
+		{name: "deb", archive: []byte(arMagic + arMember("debian-binary", "2.0\n") + arMember("data.tar", string(ball))), want: entries},
+		{name: "unknown", archive: []byte(strings.Repeat("not an archive", 100)), err: ErrUnknownFormat},
+		{name: "xz over limit", archive: xzc, opts: []Option{WithDecoderMemory(1 << 20)}, errText: "xz dictionary"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rd, err := NewReader(bytes.NewReader(tc.archive), tc.name, tc.opts...)
+			var got string
+			if err == nil {
+				defer rd.Close()
+				got, err = tarEntries(rd)
+			}
+			switch {
+			case tc.err != nil:
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("got error %v, want %v", err, tc.err)
+				}
+			case tc.errText != "":
+				if err == nil || !strings.Contains(err.Error(), tc.errText) {
+					t.Fatalf("got error %v, want one containing %q", err, tc.errText)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("got entries:\n%swant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "a.tar")
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	io.Copy(zw, tarball(t, reg("a")))
+	zw.Close()
+	if err := os.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rd, err := Open(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+	dst := t.TempDir()
+	if err := Untar(rd, dst); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := walk(t, dst), []string{"a"}; !equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
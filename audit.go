@@ -0,0 +1,444 @@
+package untar
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// AuditRecord describes a single file system change made by Untar, see
+// WithAuditLog.
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	// Op is one of: create, write (of existing file), mkdir, remove,
+	// symlink, link, mknod, chmod, chown, chtimes
+	Op     string `json:"op"`
+	Path   string `json:"path"`
+	Target string `json:"target,omitempty"` // link target for symlink and link
+	Backup string `json:"backup,omitempty"` // where previous version was moved, see WithAuditBackups
+
+	Old *AuditMeta `json:"old,omitempty"` // metadata before change, nil if path did not exist
+	New *AuditMeta `json:"new,omitempty"` // metadata after change, nil if path was removed
+}
+
+// AuditMeta holds file metadata recorded in audit log.
+type AuditMeta struct {
+	Mode    os.FileMode `json:"mode"`
+	Size    int64       `json:"size"`
+	UID     int         `json:"uid"`
+	GID     int         `json:"gid"`
+	ModTime time.Time   `json:"mtime"`
+}
+
+// WithAuditLog makes Untar append a JSON line (AuditRecord) to w for every
+// file system change it makes, recording metadata of affected path before and
+// after the change. If w has Sync() error method, like *os.File, it is called
+// at most once a second and once more before Untar returns. Failure to write
+// audit record aborts extraction.
+//
+// Removal of a directory tree is recorded as a single record for its root.
+func WithAuditLog(w io.Writer) Option {
+	return func(c *config) { c.audit = &auditLog{w: w} }
+}
+
+// WithAuditBackups makes Untar move files and directories it would overwrite
+// or remove to a new subdirectory of dir, recording their new location in
+// audit log, so that Undo can restore them. Directory dir must be on the same
+// file system as destination. It only has effect together with WithAuditLog
+// and cannot be used with WithFS.
+func WithAuditBackups(dir string) Option {
+	return func(c *config) { c.backupDir = dir }
+}
+
+// auditLog serializes audit records to writer
+type auditLog struct {
+	mu       sync.Mutex
+	w        io.Writer
+	lastSync time.Time
+	err      error // sticky write error
+}
+
+func (l *auditLog) record(rec AuditRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return l.err
+	}
+	if _, err := l.w.Write(append(b, '\n')); err != nil {
+		l.err = err
+		return err
+	}
+	if time.Since(l.lastSync) >= time.Second {
+		return l.syncLocked()
+	}
+	return nil
+}
+
+func (l *auditLog) sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return l.err
+	}
+	return l.syncLocked()
+}
+
+func (l *auditLog) syncLocked() error {
+	s, ok := l.w.(interface{ Sync() error })
+	if !ok {
+		return nil
+	}
+	l.lastSync = time.Now()
+	if err := s.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) {
+		l.err = err // EINVAL is returned for pipes and terminals
+		return err
+	}
+	return nil
+}
+
+// auditFS is WriteFS recording changes made through it to audit log
+type auditFS struct {
+	fs  WriteFS
+	log *auditLog
+
+	backupDir string // empty if backups are disabled
+	backupRun string // subdirectory of backupDir for this run, created lazily
+	backups   int
+}
+
+// backup moves existing name to backup directory (or copies it there if keep
+// is true), returning its new path
+func (a *auditFS) backup(name string, keep bool) (string, error) {
+	if a.backupRun == "" {
+		dir, err := os.MkdirTemp(a.backupDir, "untar-")
+		if err != nil {
+			return "", err
+		}
+		if a.backupRun, err = filepath.Abs(dir); err != nil {
+			return "", err
+		}
+	}
+	a.backups++
+	p := filepath.Join(a.backupRun, strconv.Itoa(a.backups))
+	if keep {
+		return p, copyFile(name, p)
+	}
+	if err := os.Rename(name, p); err != nil {
+		return "", fmt.Errorf("backup: %w", err)
+	}
+	return p, nil
+}
+
+// copyFile copies contents and permissions of regular file src to new file
+// dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, fi.ModTime(), fi.ModTime())
+}
+
+// remove removes name, moving it to backup directory if backups are enabled
+func (a *auditFS) remove(name string, fn func(string) error) error {
+	old := a.meta(name)
+	if old == nil {
+		return fn(name)
+	}
+	var backup string
+	var err error
+	if a.backupDir != "" {
+		backup, err = a.backup(name, false)
+	} else {
+		err = fn(name)
+	}
+	if err != nil {
+		return err
+	}
+	return a.log.record(AuditRecord{Time: time.Now(), Op: "remove", Path: name, Backup: backup, Old: old})
+}
+
+// meta returns current metadata of name, nil if it does not exist
+func (a *auditFS) meta(name string) *AuditMeta {
+	fi, err := a.fs.Lstat(name)
+	if err != nil {
+		return nil
+	}
+	m := &AuditMeta{Mode: fi.Mode(), Size: fi.Size(), ModTime: fi.ModTime()}
+	m.UID, m.GID, _ = fileOwner(fi)
+	return m
+}
+
+// do runs fn changing name, recording it as op on success
+func (a *auditFS) do(op, name, target string, fn func() error) error {
+	old := a.meta(name)
+	if err := fn(); err != nil {
+		return err
+	}
+	return a.log.record(AuditRecord{Time: time.Now(), Op: op, Path: name, Target: target, Old: old, New: a.meta(name)})
+}
+
+func (a *auditFS) OpenFile(name string, flag int, perm os.FileMode) (io.WriteCloser, error) {
+	old := a.meta(name)
+	var backup string
+	// files opened without truncation are modified in place
+	keep := flag&os.O_TRUNC == 0
+	if old != nil && old.Mode.IsRegular() && a.backupDir != "" && flag&os.O_EXCL == 0 {
+		var err error
+		if backup, err = a.backup(name, keep); err != nil {
+			return nil, err
+		}
+	}
+	f, err := a.fs.OpenFile(name, flag, perm)
+	if err != nil {
+		if backup == "" {
+			return nil, err
+		}
+		if keep {
+			os.Remove(backup)
+			return nil, err
+		}
+		// put file back, or at least let Undo do it
+		if rerr := os.Rename(backup, name); rerr != nil {
+			if lerr := a.log.record(AuditRecord{Time: time.Now(), Op: "remove", Path: name, Backup: backup, Old: old}); lerr != nil {
+				return nil, lerr
+			}
+		}
+		return nil, err
+	}
+	return &auditFile{WriteCloser: f, fs: a, name: name, old: old, backup: backup}, nil
+}
+
+func (a *auditFS) MkdirAll(name string, perm os.FileMode) error {
+	var created []string
+	for p := filepath.Clean(name); ; p = filepath.Dir(p) {
+		if _, err := a.fs.Lstat(p); err == nil || p == filepath.Dir(p) {
+			break
+		}
+		created = append(created, p)
+	}
+	if err := a.fs.MkdirAll(name, perm); err != nil {
+		return err
+	}
+	for i := len(created) - 1; i >= 0; i-- {
+		rec := AuditRecord{Time: time.Now(), Op: "mkdir", Path: created[i], New: a.meta(created[i])}
+		if err := a.log.record(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *auditFS) Remove(name string) error    { return a.remove(name, a.fs.Remove) }
+func (a *auditFS) RemoveAll(name string) error { return a.remove(name, a.fs.RemoveAll) }
+
+func (a *auditFS) Stat(name string) (os.FileInfo, error)  { return a.fs.Stat(name) }
+func (a *auditFS) Lstat(name string) (os.FileInfo, error) { return a.fs.Lstat(name) }
+
+func (a *auditFS) ReadDir(name string) ([]os.DirEntry, error) {
+	fsys, ok := a.fs.(ReadDirFS)
+	if !ok {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: errors.ErrUnsupported}
+	}
+	return fsys.ReadDir(name)
+}
+
+func (a *auditFS) Chmod(name string, mode os.FileMode) error {
+	return a.do("chmod", name, "", func() error { return a.fs.Chmod(name, mode) })
+}
+
+func (a *auditFS) Chown(name string, uid, gid int) error {
+	return a.do("chown", name, "", func() error { return a.fs.Chown(name, uid, gid) })
+}
+
+func (a *auditFS) Chtimes(name string, atime, mtime time.Time) error {
+	return a.do("chtimes", name, "", func() error { return a.fs.Chtimes(name, atime, mtime) })
+}
+
+func (a *auditFS) Symlink(oldname, newname string) error {
+	fsys, ok := a.fs.(SymlinkFS)
+	if !ok {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: errors.ErrUnsupported}
+	}
+	return a.do("symlink", newname, oldname, func() error { return fsys.Symlink(oldname, newname) })
+}
+
+func (a *auditFS) Readlink(name string) (string, error) {
+	fsys, ok := a.fs.(SymlinkFS)
+	if !ok {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: errors.ErrUnsupported}
+	}
+	return fsys.Readlink(name)
+}
+
+func (a *auditFS) Link(oldname, newname string) error {
+	fsys, ok := a.fs.(LinkFS)
+	if !ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: errors.ErrUnsupported}
+	}
+	return a.do("link", newname, oldname, func() error { return fsys.Link(oldname, newname) })
+}
+
+func (a *auditFS) Mknod(name string, mode uint32, dev int) error {
+	fsys, ok := a.fs.(NodeFS)
+	if !ok {
+		return &os.PathError{Op: "mknod", Path: name, Err: errors.ErrUnsupported}
+	}
+	return a.do("mknod", name, "", func() error { return fsys.Mknod(name, mode, dev) })
+}
+
+func (a *auditFS) Lsetxattr(name, attr string, data []byte) error {
+	fsys, ok := a.fs.(XattrFS)
+	if !ok {
+		return &os.PathError{Op: "setxattr", Path: name, Err: errors.ErrUnsupported}
+	}
+	return a.do("setxattr", name, attr, func() error { return fsys.Lsetxattr(name, attr, data) })
+}
+
+// auditFile records file creation or rewrite once it is closed
+type auditFile struct {
+	io.WriteCloser
+	fs     *auditFS
+	name   string
+	old    *AuditMeta
+	backup string
+	closed bool
+}
+
+func (f *auditFile) Stat() (os.FileInfo, error) {
+	if s, ok := f.WriteCloser.(interface{ Stat() (os.FileInfo, error) }); ok {
+		return s.Stat()
+	}
+	return nil, errors.ErrUnsupported
+}
+
+func (f *auditFile) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := f.WriteCloser.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, errors.ErrUnsupported
+}
+
+func (f *auditFile) Truncate(size int64) error {
+	if t, ok := f.WriteCloser.(interface{ Truncate(int64) error }); ok {
+		return t.Truncate(size)
+	}
+	return errors.ErrUnsupported
+}
+
+func (f *auditFile) Close() error {
+	if f.closed {
+		return f.WriteCloser.Close()
+	}
+	f.closed = true
+	err := f.WriteCloser.Close()
+	op := "create"
+	if f.old != nil {
+		op = "write"
+	}
+	if lerr := f.fs.log.record(AuditRecord{Time: time.Now(), Op: op, Path: f.name, Backup: f.backup, Old: f.old, New: f.fs.meta(f.name)}); err == nil {
+		err = lerr
+	}
+	return err
+}
+
+// Undo reverts changes recorded in audit log read from r (see WithAuditLog),
+// processing records in reverse order: paths created are removed (directories
+// only if empty), paths overwritten or removed are restored from backups taken
+// with WithAuditBackups, metadata changes of remaining paths are reverted.
+// Changes that cannot be reverted are reported to warn, which may be nil,
+// and make Undo return an error once it is done with the rest.
+func Undo(r io.Reader, warn func(error)) error {
+	var records []AuditRecord
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var rec AuditRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return fmt.Errorf("audit log line %d: %w", len(records)+1, err)
+		}
+		records = append(records, rec)
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	var failed int
+	for i := len(records) - 1; i >= 0; i-- {
+		if err := undo(&records[i]); err != nil {
+			failed++
+			if warn != nil {
+				warn(err)
+			}
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d of %d changes could not be undone", failed, len(records))
+	}
+	return nil
+}
+
+func undo(rec *AuditRecord) error {
+	switch rec.Op {
+	case "create", "mkdir", "symlink", "link", "mknod":
+		if rec.Old != nil {
+			return nil // replaced path is restored with its "remove" record
+		}
+		return os.Remove(rec.Path)
+	case "write", "remove":
+		if rec.Backup == "" {
+			return fmt.Errorf("%s: cannot undo %s, no backup was taken", rec.Path, rec.Op)
+		}
+		if err := os.Remove(rec.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return os.Rename(rec.Backup, rec.Path)
+	}
+	if rec.Old == nil || rec.Op == "setxattr" {
+		// previous attribute values are not recorded; replaced files
+		// get their attributes back with their backups
+		return nil
+	}
+	if rec.Old.Mode&os.ModeSymlink != 0 {
+		if rec.Op == "chown" {
+			return os.Lchown(rec.Path, rec.Old.UID, rec.Old.GID)
+		}
+		return nil
+	}
+	switch rec.Op {
+	case "chmod":
+		return os.Chmod(rec.Path, rec.Old.Mode)
+	case "chown":
+		return os.Chown(rec.Path, rec.Old.UID, rec.Old.GID)
+	case "chtimes":
+		return os.Chtimes(rec.Path, rec.Old.ModTime, rec.Old.ModTime)
+	}
+	return fmt.Errorf("%s: unknown operation %q", rec.Path, rec.Op)
+}
@@ -0,0 +1,156 @@
+package untar
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// failFS is WriteFS failing to open files
+type failFS struct{ WriteFS }
+
+var errOpen = errors.New("open failed")
+
+func (failFS) OpenFile(string, int, os.FileMode) (io.WriteCloser, error) { return nil, errOpen }
+
+func TestAuditOpenFailure(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		flag int
+	}{
+		{"truncate", os.O_WRONLY | os.O_TRUNC},
+		{"in place", os.O_WRONLY},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			name := filepath.Join(dir, "file")
+			if err := os.WriteFile(name, []byte("old"), 0666); err != nil {
+				t.Fatal(err)
+			}
+			var log bytes.Buffer
+			a := &auditFS{fs: failFS{osFS{}}, log: &auditLog{w: &log}, backupDir: t.TempDir()}
+			if _, err := a.OpenFile(name, tc.flag, 0666); !errors.Is(err, errOpen) {
+				t.Fatalf("got error %v, want %v", err, errOpen)
+			}
+			if b, err := os.ReadFile(name); err != nil || string(b) != "old" {
+				t.Errorf("file holds %q, %v", b, err)
+			}
+			if log.Len() != 0 {
+				t.Errorf("unexpected audit records: %s", log.Bytes())
+			}
+			if got := walk(t, a.backupRun); len(got) != 0 {
+				t.Errorf("backup directory holds %q", got)
+			}
+		})
+	}
+}
+
+func TestUndo(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		existing map[string]string // file contents by slash-separated path
+		entries  []*tar.Header
+		backups  bool
+		err      bool // Undo is expected to fail
+	}{
+		{
+			name:    "new tree",
+			entries: []*tar.Header{{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755}, reg("dir/file"), reg("top")},
+		},
+		{
+			name:     "overwrite with backups",
+			existing: map[string]string{"dir/file": "old", "other": "other"},
+			entries:  []*tar.Header{reg("dir/file"), reg("dir/new")},
+			backups:  true,
+		},
+		{
+			name:     "symlink replacing file",
+			existing: map[string]string{"link": "old"},
+			entries:  []*tar.Header{{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "target"}},
+			backups:  true,
+		},
+		{
+			name:     "overwrite without backups",
+			existing: map[string]string{"file": "old"},
+			entries:  []*tar.Header{reg("file")},
+			err:      true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dst := t.TempDir()
+			for name, data := range tc.existing {
+				p := filepath.Join(dst, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			before := snapshotTree(t, dst)
+			var log bytes.Buffer
+			opts := []Option{WithAuditLog(&log)}
+			if tc.backups {
+				opts = append(opts, WithAuditBackups(t.TempDir()))
+			}
+			if err := Untar(tarball(t, tc.entries...), dst, opts...); err != nil {
+				t.Fatal(err)
+			}
+			var warnings []error
+			err := Undo(&log, func(err error) { warnings = append(warnings, err) })
+			if tc.err {
+				if err == nil || len(warnings) == 0 {
+					t.Errorf("Undo succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Undo: %v, warnings: %q", err, warnings)
+			}
+			if after := snapshotTree(t, dst); !equal(after, before) {
+				t.Errorf("tree after Undo:\n%q\nwant:\n%q", after, before)
+			}
+		})
+	}
+}
+
+// snapshotTree describes files inside dir: directories, symbolic links with
+// their targets and regular files with their contents
+func snapshotTree(t *testing.T, dir string) []string {
+	t.Helper()
+	var out []string
+	for _, p := range walk(t, dir) {
+		name := filepath.Join(dir, filepath.FromSlash(p))
+		fi, err := os.Lstat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case fi.IsDir():
+			out = append(out, p+"/")
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, p+" -> "+target)
+		default:
+			b, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(b) > 64 {
+				out = append(out, fmt.Sprintf("%s %d bytes sha256:%x", p, len(b), sha256.Sum256(b)))
+				break
+			}
+			out = append(out, fmt.Sprintf("%s %q", p, b))
+		}
+	}
+	return out
+}
@@ -0,0 +1,156 @@
+package untar
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// WithBaseline makes Untar start with a copy of directory dir, typically
+// holding previously extracted release of the same software, and only write
+// entries that differ from it, see WithSkipIdentical. Files are copied with
+// reflinks (copy-on-write clones) where file system supports them, so that
+// extraction cost is proportional to the difference between releases. Once
+// archive is extracted, files and directories copied from baseline that are
+// not among extracted entries are removed.
+//
+// Destination directory must not exist or be empty. WithBaseline cannot be
+// used with WithFS and WithDryRun.
+func WithBaseline(dir string) Option {
+	return func(c *config) {
+		c.baseline = dir
+		c.skipIdentical = true
+	}
+}
+
+// cloneBaseline copies baseline directory tree to empty or missing dst
+func (c *config) cloneBaseline(dst string) error {
+	if f, err := os.Open(dst); err == nil {
+		_, err := f.Readdirnames(1)
+		f.Close()
+		if err != io.EOF {
+			if err == nil {
+				err = errors.New("directory is not empty")
+			}
+			return fmt.Errorf("cannot use baseline: %s: %w", dst, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	c.extracted = make(map[string]bool)
+	type dir struct {
+		name string
+		fi   os.FileInfo
+	}
+	// directories get their metadata once their contents are copied,
+	// so that read-only ones can be filled and keep their times
+	var dirs []dir
+	err := filepath.WalkDir(c.baseline, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(c.baseline, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case fi.IsDir():
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return err
+			}
+			dirs = append(dirs, dir{target, fi})
+			return nil
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+		case fi.Mode().IsRegular():
+			if err := reflink(p, target); err != nil {
+				if err := copyFile(p, target); err != nil {
+					return err
+				}
+			}
+		default:
+			return nil // special files are recreated from archive
+		}
+		return copyMeta(target, fi)
+	})
+	if err != nil {
+		return err
+	}
+	// walk visits directories before their subdirectories
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := copyMeta(dirs[i].name, dirs[i].fi); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyMeta sets permissions, modification time and owner (if run as root) of
+// name to match fi
+func copyMeta(name string, fi os.FileInfo) error {
+	if os.Getuid() == 0 {
+		if uid, gid, ok := fileOwner(fi); ok {
+			if err := os.Lchown(name, uid, gid); err != nil {
+				return err
+			}
+		}
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+	if err := os.Chmod(name, fi.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+	return os.Chtimes(name, fi.ModTime(), fi.ModTime())
+}
+
+// pruneBaseline removes paths inside dst that were copied from baseline but
+// are not among extracted entries
+func (c *config) pruneBaseline(dst string) error {
+	dst = filepath.Clean(dst)
+	keep := make(map[string]bool, len(c.extracted))
+	for name := range c.extracted {
+		for p := name; p != dst && !keep[p]; p = filepath.Dir(p) {
+			keep[p] = true
+			if p == filepath.Dir(p) {
+				break
+			}
+		}
+	}
+	var stale []string
+	err := filepath.WalkDir(dst, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == dst {
+			return err
+		}
+		if !keep[p] {
+			stale = append(stale, p)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, p := range stale {
+		if err := c.fs.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
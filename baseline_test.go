@@ -0,0 +1,97 @@
+package untar
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCloneBaseline(t *testing.T) {
+	base := t.TempDir()
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, p := range []string{"ro/sub/file", "file"} {
+		p = filepath.Join(base, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(p), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range []string{"ro/sub", "ro", "."} {
+		if err := os.Chtimes(filepath.Join(base, filepath.FromSlash(p)), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range []string{"ro/sub", "ro"} {
+		if err := os.Chmod(filepath.Join(base, filepath.FromSlash(p)), 0555); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dst := filepath.Join(t.TempDir(), "dst")
+	t.Cleanup(func() {
+		for _, p := range []string{"ro", "ro/sub"} {
+			os.Chmod(filepath.Join(base, filepath.FromSlash(p)), 0755)
+			os.Chmod(filepath.Join(dst, filepath.FromSlash(p)), 0755)
+		}
+	})
+	c := &config{baseline: base}
+	if err := c.cloneBaseline(dst); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := walk(t, dst), []string{"file", "ro", "ro/sub", "ro/sub/file"}; !equal(got, want) {
+		t.Fatalf("destination holds %q, want %q", got, want)
+	}
+	for _, name := range []string{"ro/sub", "ro", "."} {
+		name = filepath.FromSlash(name)
+		want, err := os.Stat(filepath.Join(base, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode() != want.Mode() {
+			t.Errorf("%s: mode %v, want %v", name, fi.Mode(), want.Mode())
+		}
+		if !fi.ModTime().Equal(mtime) {
+			t.Errorf("%s: modification time %v, want %v", name, fi.ModTime(), mtime)
+		}
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	base := t.TempDir()
+	for _, p := range []string{"same", "changed", "stale/file"} {
+		p = filepath.Join(base, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(filepath.Base(p)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(base, "changed"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "dst")
+	r := tarball(t,
+		&tar.Header{Name: "same", Typeflag: tar.TypeReg},
+		&tar.Header{Name: "changed", Typeflag: tar.TypeReg},
+		&tar.Header{Name: "new", Typeflag: tar.TypeReg},
+	)
+	if err := Untar(r, dst, WithBaseline(base)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := walk(t, dst), []string{"changed", "new", "same"}; !equal(got, want) {
+		t.Errorf("destination holds %q, want %q", got, want)
+	}
+	for _, name := range []string{"changed", "new", "same"} {
+		if b, err := os.ReadFile(filepath.Join(dst, name)); err != nil || string(b) != name {
+			t.Errorf("%s holds %q, %v", name, b, err)
+		}
+	}
+}
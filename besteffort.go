@@ -0,0 +1,55 @@
+package untar
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// WithBestEffort makes Untar tolerate environments where some operations are
+// never permitted, like Android (Termux) or restricted containers: if
+// changing ownership, creating links, device nodes or named pipes fails with
+// permission error (or is not supported, see WithFS), the operation is skipped
+// for the entry instead of aborting extraction. Such entries are counted as
+// skipped; the first failure of each operation is reported as a warning, see
+// WithWarningFunc.
+func WithBestEffort() Option {
+	return func(c *config) { c.bestEffort = true }
+}
+
+// degraded reports whether error of operation op on path name can be
+// tolerated in best-effort mode
+func (c *config) degraded(op, name string, err error) bool {
+	// operations the platform lacks are skipped even without best-effort mode
+	missing := c.onOS() && errors.Is(err, errors.ErrUnsupported)
+	if !missing && (!c.bestEffort || !isPermission(err)) {
+		return false
+	}
+	if c.firstFailure(op) {
+		c.warn(fmt.Errorf("%s: %s not permitted (%v), skipping it for this and further entries", name, op, err))
+	}
+	return true
+}
+
+// firstFailure records failure of operation op, reporting whether it's the
+// first one
+func (c *config) firstFailure(op string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failedOps[op] {
+		return false
+	}
+	if c.failedOps == nil {
+		c.failedOps = make(map[string]bool)
+	}
+	c.failedOps[op] = true
+	return true
+}
+
+func isPermission(err error) bool {
+	return os.IsPermission(err) ||
+		errors.Is(err, syscall.ENOSYS) ||
+		errors.Is(err, syscall.EOPNOTSUPP) ||
+		errors.Is(err, errors.ErrUnsupported)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// staging is a temporary directory next to destination which -atomic
+// extraction goes to, so that destination is only changed once extraction
+// succeeds
+type staging struct {
+	tmp string // temporary directory, removed once done
+	dir string // directory inside tmp archives are extracted to
+}
+
+// newStaging creates staging directory for extraction to dst, in the same
+// directory so that extracted tree can be renamed into place
+func newStaging(dst string) (*staging, error) {
+	dst = filepath.Clean(dst)
+	if fi, err := os.Stat(dst); err == nil && !fi.IsDir() {
+		return nil, &os.PathError{Op: "mkdir", Path: dst, Err: errors.New("not a directory")}
+	}
+	parent := filepath.Dir(dst)
+	if err := os.MkdirAll(parent, os.ModeDir|os.ModePerm); err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp(parent, "."+filepath.Base(dst)+".untar-")
+	if err != nil {
+		return nil, err
+	}
+	return &staging{tmp: tmp, dir: filepath.Join(tmp, "dst")}, nil
+}
+
+// commit moves extracted tree into place of dst: it is renamed if dst doesn't
+// exist or is an empty directory, otherwise its entries are moved over
+// existing ones one by one. If keepDirs is true, symlinks to directories in
+// dst are kept, see -keep-directory-symlink.
+func (s *staging) commit(dst string, keepDirs bool) error {
+	fi, err := os.Lstat(dst)
+	switch {
+	case os.IsNotExist(err):
+		return os.Rename(s.dir, dst)
+	case err != nil:
+		return err
+	case fi.IsDir():
+		// only succeeds for empty directory
+		if os.Remove(dst) == nil {
+			return os.Rename(s.dir, dst)
+		}
+	}
+	return moveOver(s.dir, dst, keepDirs)
+}
+
+// remove removes staging directory with whatever is left in it
+func (s *staging) remove() error { return os.RemoveAll(s.tmp) }
+
+// moveOver renames entries of directory src to directory dst, replacing
+// existing ones, and descending into directories present in both, so that
+// every file is replaced atomically. Directories merged this way get
+// permissions and modification time of their src counterparts.
+func moveOver(src, dst string, keepDirs bool) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		from, to := filepath.Join(src, e.Name()), filepath.Join(dst, e.Name())
+		if e.IsDir() {
+			stat := os.Lstat
+			if keepDirs {
+				stat = os.Stat
+			}
+			if fi, err := stat(to); err == nil && fi.IsDir() {
+				if err := moveOver(from, to, keepDirs); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if err := os.Rename(from, to); err != nil {
+			// existing non-empty directory, or directory replaced
+			// with a file
+			if os.RemoveAll(to) != nil {
+				return err
+			}
+			if err := os.Rename(from, to); err != nil {
+				return err
+			}
+		}
+	}
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(dst, fi.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, fi.ModTime(), fi.ModTime())
+}
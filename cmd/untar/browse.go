@@ -0,0 +1,428 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/artyom/untar"
+)
+
+var browseDst = "."
+
+func browseFlags() *flag.FlagSet {
+	fs := flag.NewFlagSet("browse", flag.ExitOnError)
+	fs.StringVar(&browseDst, "to", browseDst, "directory to unpack selected entries to")
+	return fs
+}
+
+const browseHelp = `commands:
+  ls [path]           list directory contents; marked entries are shown with *
+  cd path             change current directory
+  pwd                 print current directory
+  info path           show entry details
+  mark path...        mark entries (or whole directories) for extraction
+  unmark path...      remove marks
+  marked              list marked entries
+  extract [dir]       extract marked entries to dir
+  help                show this help
+  quit                exit
+Paths are relative to the current directory unless start with /, and may be
+glob patterns matching entries in a single directory.
+`
+
+// runBrowse shows archive as a navigable tree when run in a terminal, and
+// reads commands listed in browseHelp otherwise, so that it can be scripted.
+func runBrowse(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: untar browse [-to dir] archive")
+	}
+	root, err := readTree(args[0])
+	if err != nil {
+		return err
+	}
+	b := &browser{
+		archive: args[0],
+		dst:     browseDst,
+		root:    root,
+		cwd:     root,
+		marked:  make(map[string]bool),
+		out:     os.Stdout,
+	}
+	if !isTerminal(int(os.Stdin.Fd())) || !isTerminal(int(os.Stdout.Fd())) {
+		return b.run(os.Stdin)
+	}
+	extract, err := runTree(b, os.Stdin, os.Stdout)
+	if err != nil || !extract {
+		return err
+	}
+	return b.extract(nil)
+}
+
+// node is a file or directory inside archive
+type node struct {
+	name     string      // full path inside archive, empty for root
+	hdr      *tar.Header // nil for directories without their own entry
+	parent   *node
+	children map[string]*node
+}
+
+func (n *node) isDir() bool { return n.hdr == nil || n.hdr.Typeflag == tar.TypeDir }
+
+func (n *node) base() string { return path.Base("/" + n.name) }
+
+func (n *node) sortedChildren() []*node {
+	out := make([]*node, 0, len(n.children))
+	for _, c := range n.children {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
+
+// lookup returns node with given full name, creating missing directories
+// along the way if create is true
+func (n *node) lookup(name string, create bool) *node {
+	cur := n
+	if name == "" {
+		return cur
+	}
+	for _, elem := range strings.Split(name, "/") {
+		next, ok := cur.children[elem]
+		if !ok {
+			if !create {
+				return nil
+			}
+			next = &node{name: path.Join(cur.name, elem), parent: cur, children: make(map[string]*node)}
+			cur.children[elem] = next
+		}
+		cur = next
+	}
+	return cur
+}
+
+// readTree reads all headers of the archive into a tree
+func readTree(name string) (*node, error) {
+	rd, err := openArchive(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	root := &node{children: make(map[string]*node)}
+	tr := tar.NewReader(rd)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return root, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := cleanName(hdr.Name)
+		if name == "" {
+			continue
+		}
+		root.lookup(name, true).hdr = hdr
+	}
+}
+
+// cleanName converts archive entry name to a clean relative path
+func cleanName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+type browser struct {
+	archive string
+	dst     string
+	root    *node
+	cwd     *node
+	marked  map[string]bool
+	out     io.Writer
+}
+
+func (b *browser) run(in io.Reader) error {
+	sc := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(b.out, "%s:/%s> ", path.Base(b.archive), b.cwd.name)
+		if !sc.Scan() {
+			fmt.Fprintln(b.out)
+			return sc.Err()
+		}
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		cmd, args := fields[0], fields[1:]
+		var err error
+		switch cmd {
+		case "ls":
+			err = b.ls(args)
+		case "cd":
+			err = b.cd(args)
+		case "pwd":
+			fmt.Fprintf(b.out, "/%s\n", b.cwd.name)
+		case "info":
+			err = b.info(args)
+		case "mark":
+			err = b.mark(args, true)
+		case "unmark":
+			err = b.mark(args, false)
+		case "marked":
+			b.listMarked()
+		case "extract":
+			err = b.extract(args)
+		case "help", "?":
+			fmt.Fprint(b.out, browseHelp)
+		case "quit", "exit", "q":
+			return nil
+		default:
+			err = fmt.Errorf("unknown command %q, type help for the list of commands", cmd)
+		}
+		if err != nil {
+			fmt.Fprintln(b.out, "error:", err)
+		}
+	}
+}
+
+// resolve returns nodes matching path argument, which may be a glob pattern
+// in its last element
+func (b *browser) resolve(arg string) ([]*node, error) {
+	name := arg
+	if !strings.HasPrefix(name, "/") {
+		name = path.Join(b.cwd.name, name)
+	}
+	name = cleanName(name)
+	if n := b.root.lookup(name, false); n != nil {
+		return []*node{n}, nil
+	}
+	dir := b.root.lookup(cleanName(path.Dir("/"+name)), false)
+	if dir == nil {
+		return nil, fmt.Errorf("%s: no such entry", arg)
+	}
+	var out []*node
+	for _, c := range dir.sortedChildren() {
+		ok, err := path.Match(path.Base("/"+name), c.base())
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, c)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%s: no such entry", arg)
+	}
+	return out, nil
+}
+
+// isMarked reports whether node or any of its parents is marked
+func (b *browser) isMarked(n *node) bool {
+	for ; n != nil; n = n.parent {
+		if b.marked[n.name] {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *browser) ls(args []string) error {
+	dirs := []*node{b.cwd}
+	if len(args) > 0 {
+		dirs = dirs[:0]
+		for _, arg := range args {
+			nodes, err := b.resolve(arg)
+			if err != nil {
+				return err
+			}
+			dirs = append(dirs, nodes...)
+		}
+	}
+	for _, dir := range dirs {
+		if !dir.isDir() {
+			b.printNode(dir)
+			continue
+		}
+		for _, n := range dir.sortedChildren() {
+			b.printNode(n)
+		}
+	}
+	return nil
+}
+
+func (b *browser) printNode(n *node) {
+	mark := " "
+	if b.isMarked(n) {
+		mark = "*"
+	}
+	fmt.Fprintf(b.out, "%s %s %s\n", mark, nodeColumns(n), nodeName(n))
+}
+
+// nodeColumns returns mode, owner, size and modification time of node
+func nodeColumns(n *node) string {
+	if n.hdr == nil {
+		return fmt.Sprintf("%-10s %-17s %12s %16s", "d?????????", "", "", "")
+	}
+	return fmt.Sprintf("%-10s %-17s %12d %16s", n.hdr.FileInfo().Mode(),
+		owner(n.hdr), n.hdr.Size, n.hdr.ModTime.Format("2006-01-02 15:04"))
+}
+
+// nodeName returns base name of node, with slash for directories and
+// target for links
+func nodeName(n *node) string {
+	name := n.base()
+	if n.isDir() {
+		name += "/"
+	}
+	if n.hdr != nil && (n.hdr.Typeflag == tar.TypeSymlink || n.hdr.Typeflag == tar.TypeLink) {
+		name += " -> " + n.hdr.Linkname
+	}
+	return name
+}
+
+// owner returns user/group of entry, preferring names to numeric ids
+func owner(hdr *tar.Header) string {
+	u, g := hdr.Uname, hdr.Gname
+	if u == "" {
+		u = strconv.Itoa(hdr.Uid)
+	}
+	if g == "" {
+		g = strconv.Itoa(hdr.Gid)
+	}
+	return u + "/" + g
+}
+
+func (b *browser) cd(args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: cd path")
+	}
+	if len(args) == 0 {
+		b.cwd = b.root
+		return nil
+	}
+	nodes, err := b.resolve(args[0])
+	if err != nil {
+		return err
+	}
+	if len(nodes) != 1 || !nodes[0].isDir() {
+		return fmt.Errorf("%s: not a directory", args[0])
+	}
+	b.cwd = nodes[0]
+	return nil
+}
+
+func (b *browser) info(args []string) error {
+	for _, arg := range args {
+		nodes, err := b.resolve(arg)
+		if err != nil {
+			return err
+		}
+		for _, n := range nodes {
+			fmt.Fprintf(b.out, "name:  /%s\n", n.name)
+			if n.hdr == nil {
+				fmt.Fprintln(b.out, "type:  directory (implicit)")
+				continue
+			}
+			fmt.Fprintf(b.out, "mode:  %s\nowner: %s (%d/%d)\nsize:  %d\nmtime: %s\n",
+				n.hdr.FileInfo().Mode(), owner(n.hdr), n.hdr.Uid, n.hdr.Gid,
+				n.hdr.Size, n.hdr.ModTime.Format("2006-01-02 15:04:05 -0700"))
+			if n.hdr.Linkname != "" {
+				fmt.Fprintf(b.out, "link:  %s\n", n.hdr.Linkname)
+			}
+		}
+	}
+	return nil
+}
+
+func (b *browser) mark(args []string, mark bool) error {
+	if len(args) == 0 {
+		return errors.New("no paths given")
+	}
+	for _, arg := range args {
+		nodes, err := b.resolve(arg)
+		if err != nil {
+			return err
+		}
+		for _, n := range nodes {
+			if n == b.root {
+				if mark {
+					b.marked[""] = true
+				} else {
+					b.marked = make(map[string]bool)
+				}
+				continue
+			}
+			if mark {
+				b.marked[n.name] = true
+			} else {
+				delete(b.marked, n.name)
+			}
+		}
+	}
+	return nil
+}
+
+// toggle marks node or removes its mark, returning message explaining why
+// the mark can't be removed
+func (b *browser) toggle(n *node) string {
+	if b.marked[n.name] {
+		delete(b.marked, n.name)
+		return ""
+	}
+	if b.isMarked(n) {
+		return "parent directory is marked"
+	}
+	for name := range b.marked {
+		if strings.HasPrefix(name, n.name+"/") {
+			delete(b.marked, name) // covered by the new mark
+		}
+	}
+	b.marked[n.name] = true
+	return ""
+}
+
+func (b *browser) listMarked() {
+	names := make([]string, 0, len(b.marked))
+	for name := range b.marked {
+		names = append(names, "/"+name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(b.out, name)
+	}
+}
+
+func (b *browser) extract(args []string) error {
+	if len(b.marked) == 0 {
+		return errors.New("nothing marked")
+	}
+	dst := b.dst
+	switch len(args) {
+	case 0:
+	case 1:
+		dst = args[0]
+	default:
+		return errors.New("usage: extract [dir]")
+	}
+	var cnt int
+	filter := func(hdr *tar.Header) bool {
+		n := b.root.lookup(cleanName(hdr.Name), false)
+		if n == nil || !b.isMarked(n) {
+			return false
+		}
+		cnt++
+		return true
+	}
+	if err := openAndUntar(b.archive, dst, nil, untar.WithFilter(filter)); err != nil {
+		return err
+	}
+	fmt.Fprintf(b.out, "extracted %d entries to %s\n", cnt, dst)
+	return nil
+}
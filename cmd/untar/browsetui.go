@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// treeView is full screen browser of archive tree, used when browse runs in
+// a terminal
+type treeView struct {
+	b        *browser
+	expanded map[*node]bool
+	rows     []treeRow // visible nodes
+	cur      int       // selected row
+	top      int       // first row shown
+	status   string    // message shown instead of key help until next key
+}
+
+type treeRow struct {
+	n     *node
+	depth int
+}
+
+const treeHelp = "up/down: move  right/enter: open  left: close  space: mark  x: extract marked  q: quit"
+
+// runTree shows archive tree in terminal until user quits or asks to extract
+// marked entries, reporting the latter.
+func runTree(b *browser, in, out *os.File) (bool, error) {
+	restore, err := makeRaw(int(in.Fd()))
+	if err != nil {
+		return false, err
+	}
+	defer restore()
+	io.WriteString(out, "\x1b[?1049h\x1b[?25l") // alternate screen, hide cursor
+	defer io.WriteString(out, "\x1b[?25h\x1b[?1049l")
+	v := &treeView{b: b, expanded: map[*node]bool{b.root: true}}
+	v.refresh()
+	br := bufio.NewReader(in)
+	for {
+		width, height, err := termSize(int(out.Fd()))
+		if err != nil {
+			width, height = 80, 24
+		}
+		if _, err := out.Write(v.draw(width, height)); err != nil {
+			return false, err
+		}
+		key, err := readKey(br)
+		if err != nil {
+			return false, err
+		}
+		v.status = ""
+		page := height - 2
+		if page < 1 {
+			page = 1
+		}
+		switch key {
+		case "q", "esc", "\x03":
+			return false, nil
+		case "x":
+			if len(b.marked) != 0 {
+				return true, nil
+			}
+			v.status = "nothing marked"
+		case "up", "k":
+			v.move(-1)
+		case "down", "j":
+			v.move(1)
+		case "pgup":
+			v.move(-page)
+		case "pgdn":
+			v.move(page)
+		case "home", "g":
+			v.move(-len(v.rows))
+		case "end", "G":
+			v.move(len(v.rows))
+		case "right", "l", "\r":
+			v.open()
+		case "left", "h":
+			v.close()
+		case " ":
+			if len(v.rows) != 0 {
+				v.status = b.toggle(v.rows[v.cur].n)
+				v.move(1)
+			}
+		}
+	}
+}
+
+// refresh rebuilds list of visible rows, keeping selected node selected
+func (v *treeView) refresh() {
+	var sel *node
+	if v.cur < len(v.rows) {
+		sel = v.rows[v.cur].n
+	}
+	v.rows = v.rows[:0]
+	var walk func(n *node, depth int)
+	walk = func(n *node, depth int) {
+		for _, c := range n.sortedChildren() {
+			if c == sel {
+				v.cur = len(v.rows)
+			}
+			v.rows = append(v.rows, treeRow{n: c, depth: depth})
+			if v.expanded[c] {
+				walk(c, depth+1)
+			}
+		}
+	}
+	walk(v.b.root, 0)
+	if v.cur >= len(v.rows) {
+		v.cur = len(v.rows) - 1
+	}
+	if v.cur < 0 {
+		v.cur = 0
+	}
+}
+
+func (v *treeView) move(delta int) {
+	v.cur += delta
+	if v.cur >= len(v.rows) {
+		v.cur = len(v.rows) - 1
+	}
+	if v.cur < 0 {
+		v.cur = 0
+	}
+}
+
+// open expands selected directory or, if it is already expanded, selects
+// its first child
+func (v *treeView) open() {
+	if len(v.rows) == 0 {
+		return
+	}
+	n := v.rows[v.cur].n
+	switch {
+	case !n.isDir() || len(n.children) == 0:
+	case v.expanded[n]:
+		v.move(1)
+	default:
+		v.expanded[n] = true
+		v.refresh()
+	}
+}
+
+// close collapses selected directory or selects its parent
+func (v *treeView) close() {
+	if len(v.rows) == 0 {
+		return
+	}
+	n := v.rows[v.cur].n
+	if !v.expanded[n] {
+		if n = n.parent; n == v.b.root {
+			return
+		}
+		for i, r := range v.rows {
+			if r.n == n {
+				v.cur = i
+			}
+		}
+	}
+	delete(v.expanded, n)
+	v.refresh()
+}
+
+// draw renders screen of given size
+func (v *treeView) draw(width, height int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("\x1b[H")
+	line := func(s string, reverse bool) {
+		s = truncate(s, width)
+		if reverse {
+			buf.WriteString("\x1b[7m" + s + strings.Repeat(" ", width-utf8.RuneCountInString(s)) + "\x1b[m")
+		} else {
+			buf.WriteString(s)
+		}
+		buf.WriteString("\x1b[K\r\n")
+	}
+	line(fmt.Sprintf("%s: %d marked, extract to %s", v.b.archive, len(v.b.marked), v.b.dst), true)
+	rows := height - 2
+	if v.cur < v.top {
+		v.top = v.cur
+	}
+	if v.cur >= v.top+rows {
+		v.top = v.cur - rows + 1
+	}
+	for i := v.top; i < v.top+rows && i < len(v.rows); i++ {
+		r := v.rows[i]
+		mark := " "
+		if v.b.isMarked(r.n) {
+			mark = "*"
+		}
+		open := "  "
+		if r.n.isDir() && len(r.n.children) != 0 {
+			open = "+ "
+			if v.expanded[r.n] {
+				open = "- "
+			}
+		}
+		line(fmt.Sprintf("%s %s %s%s%s", mark, nodeColumns(r.n), strings.Repeat("  ", r.depth), open, nodeName(r.n)), i == v.cur)
+	}
+	buf.WriteString("\x1b[J")
+	status := v.status
+	if status == "" {
+		status = treeHelp
+	}
+	fmt.Fprintf(&buf, "\x1b[%d;1H%s\x1b[K", height, truncate(status, width))
+	return buf.Bytes()
+}
+
+// truncate cuts s to at most n runes
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	if n <= 0 {
+		return ""
+	}
+	return string([]rune(s)[:n])
+}
+
+// readKey reads key press from terminal in raw mode, returning either the
+// character typed or name of special key: up, down, left, right, pgup, pgdn,
+// home, end, esc
+func readKey(br *bufio.Reader) (string, error) {
+	b, err := br.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	if b != 0x1b {
+		if b < utf8.RuneSelf {
+			return string(b), nil
+		}
+		br.UnreadByte()
+		r, _, err := br.ReadRune()
+		return string(r), err
+	}
+	if br.Buffered() == 0 {
+		return "esc", nil
+	}
+	var seq []byte
+	for br.Buffered() != 0 {
+		c, _ := br.ReadByte()
+		seq = append(seq, c)
+		if len(seq) > 1 && (c >= 'A' && c <= 'Z' || c == '~') {
+			break
+		}
+	}
+	switch strings.TrimLeft(string(seq), "[O") {
+	case "A":
+		return "up", nil
+	case "B":
+		return "down", nil
+	case "C":
+		return "right", nil
+	case "D":
+		return "left", nil
+	case "5~":
+		return "pgup", nil
+	case "6~":
+		return "pgdn", nil
+	case "H", "1~", "7~":
+		return "home", nil
+	case "F", "4~", "8~":
+		return "end", nil
+	}
+	return "", nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/artyom/untar"
+)
+
+// recordSize is the size of tar record checkpoints are counted in, as with
+// default GNU tar blocking factor of 20
+const recordSize = 20 * 512
+
+// checkpointer runs actions every n records of tar stream read, like GNU tar
+// --checkpoint
+type checkpointer struct {
+	every   int64 // bytes between checkpoints
+	actions []string
+	read    int64 // bytes of tar stream read, accessed atomically
+	next    int64 // number of the next checkpoint
+	dots    bool  // whether dots were printed, so newline is due
+}
+
+// newCheckpointer validates actions and returns checkpointer counting data
+// read from rd
+func newCheckpointer(rd *archiveReader, records int, actions []string) (*checkpointer, error) {
+	if len(actions) == 0 {
+		actions = []string{"echo"}
+	}
+	for _, a := range actions {
+		switch name, _, _ := strings.Cut(a, "="); name {
+		case "dot", "echo", "exec":
+		default:
+			return nil, fmt.Errorf("unsupported checkpoint action %q, want dot, echo[=text] or exec=command", a)
+		}
+		if a == "exec" || a == "exec=" {
+			return nil, fmt.Errorf("checkpoint action %q needs a command", a)
+		}
+	}
+	c := &checkpointer{every: int64(records) * recordSize, actions: actions, next: 1}
+	rd.Reader = &countingReader{r: rd.Reader, n: &c.read}
+	return c, nil
+}
+
+func (c *checkpointer) entry(untar.Entry) {
+	for read := atomic.LoadInt64(&c.read); read >= c.next*c.every; c.next++ {
+		c.run(c.next)
+	}
+}
+
+// run performs actions of checkpoint n
+func (c *checkpointer) run(n int64) {
+	num := strconv.FormatInt(n, 10)
+	for _, a := range c.actions {
+		name, arg, _ := strings.Cut(a, "=")
+		switch name {
+		case "dot":
+			fmt.Fprint(os.Stderr, ".")
+			c.dots = true
+		case "echo":
+			if arg == "" {
+				arg = "read checkpoint %u"
+			}
+			c.newline()
+			log.Print(strings.ReplaceAll(arg, "%u", num))
+		case "exec":
+			c.newline()
+			if err := runHook(arg, []string{"TAR_CHECKPOINT=" + num, jobEnvPrefix + "CHECKPOINT=" + num}, nil); err != nil {
+				log.Printf("warning: checkpoint %d action: %v", n, err)
+			}
+		}
+	}
+}
+
+// newline ends line of dots, if any
+func (c *checkpointer) newline() {
+	if c.dots {
+		fmt.Fprintln(os.Stderr)
+		c.dots = false
+	}
+}
+
+// finish ends line of dots once extraction is done
+func (c *checkpointer) finish() { c.newline() }
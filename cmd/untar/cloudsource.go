@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	"github.com/artyom/untar"
+)
+
+func init() {
+	untar.RegisterSource("s3", openS3)
+	untar.RegisterSource("gs", openGCS)
+}
+
+// openS3 opens archive stored in Amazon S3 (or compatible storage) at
+// s3://bucket/key URL, taking credentials, region and endpoint from the
+// environment and shared configuration files, as AWS CLI does
+func openS3(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	bucket, key, err := objectPath(u)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	out, err := s3.NewFromConfig(cfg).GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &objectReader{
+		ReadCloser: out.Body,
+		info: remoteFileInfo{
+			name:  path.Base(key),
+			size:  aws.ToInt64(out.ContentLength),
+			mtime: aws.ToTime(out.LastModified),
+		},
+	}, nil
+}
+
+// openGCS opens archive stored in Google Cloud Storage at gs://bucket/key URL
+// with application default credentials. Download is resumed after network
+// errors, see openHTTP.
+func openGCS(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	bucket, key, err := objectPath(u)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := google.DefaultTokenSource(ctx, "https://www.googleapis.com/auth/devstorage.read_only")
+	if err != nil {
+		return nil, err
+	}
+	obj := (&url.URL{Scheme: "https", Host: "storage.googleapis.com", Path: "/" + bucket + "/" + key}).String()
+	return openURL(ctx, oauth2.NewClient(ctx, ts), obj)
+}
+
+// objectPath returns bucket and object key of cloud storage URL
+func objectPath(u *url.URL) (bucket, key string, err error) {
+	bucket, key = u.Host, strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return "", "", errors.New(u.String() + ": URL must be " + u.Scheme + "://bucket/key")
+	}
+	return bucket, key, nil
+}
+
+// objectReader reads object from cloud storage
+type objectReader struct {
+	io.ReadCloser
+	info remoteFileInfo
+}
+
+// Stat describes object, so that its size is known for progress reporting.
+func (r *objectReader) Stat() (os.FileInfo, error) { return r.info, nil }
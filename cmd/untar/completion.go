@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// kinds of flag values, used to pick completion candidates
+const (
+	argFile    = ""      // any file, default for non-boolean flags
+	argNone    = "none"  // boolean flag
+	argValue   = "value" // value that cannot be completed
+	argDir     = "dir"
+	argArchive = "archive"
+)
+
+// flagArgs maps flags to kinds of values they expect; non-boolean flags not
+// listed here complete file names
+var flagArgs = map[string]string{
+	"to":   argDir,
+	"C":    argDir,
+	"from": argArchive,
+
+	"strip-components":   argValue,
+	"strip-top-level":    argValue,
+	"subdir":             argValue,
+	"image":              argValue,
+	"go-module":          argValue,
+	"platform":           argValue,
+	"include":            argValue,
+	"exclude":            argValue,
+	"pre-hook":           argValue,
+	"post-hook":          argValue,
+	"progress-fd":        argValue,
+	"log-format":         argValue,
+	"timeout":            argValue,
+	"trailing-data":      argValue,
+	"overwrite":          argValue,
+	"policy":             argValue,
+	"audit-log":          argValue,
+	"audit-backups":      argDir,
+	"baseline":           argDir,
+	"checkpoint":         argValue,
+	"workers":            argValue,
+	"checkpoint-action":  argValue,
+	"max-memory":         argValue,
+	"max-entries":        argValue,
+	"max-file-size":      argValue,
+	"max-total-size":     argValue,
+	"max-ratio":          argValue,
+	"idmap":              argValue,
+	"expect-sha256":      argValue,
+	"manifest-format":    argValue,
+	"owner":              argValue,
+	"group":              argValue,
+	"recursive-depth":    argValue,
+	"transform":          argValue,
+	"recursive-max-size": argValue,
+
+	"use-external-decompressor": argValue,
+
+	"url":    argValue,
+	"addr":   argValue,
+	"log":    argValue,
+	"pubkey": argValue,
+}
+
+// complFlag is a flag description used to generate completion scripts
+type complFlag struct {
+	name, usage, arg string
+}
+
+// complFlags returns descriptions of flags defined on fs, in lexical order
+func complFlags(fs *flag.FlagSet) []complFlag {
+	var out []complFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		cf := complFlag{name: f.Name, usage: f.Usage, arg: flagArgs[f.Name]}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			cf.arg = argNone
+		}
+		out = append(out, cf)
+	})
+	return out
+}
+
+func subcommandNames() []string {
+	names := make([]string, 0, len(subcommands))
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func runCompletion(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: untar completion bash|zsh|fish")
+	}
+	var gen func(io.Writer)
+	switch args[0] {
+	case "bash":
+		gen = bashCompletion
+	case "zsh":
+		gen = zshCompletion
+	case "fish":
+		gen = fishCompletion
+	default:
+		return fmt.Errorf("unsupported shell %q, use one of: bash, zsh, fish", args[0])
+	}
+	w := bufio.NewWriter(os.Stdout)
+	gen(w)
+	return w.Flush()
+}
+
+// flagsOfKind returns space-separated list of flags with given value kind,
+// each prefixed with a single dash
+func flagsOfKind(flags []complFlag, kind string) string {
+	var out []string
+	for _, f := range flags {
+		if kind == "*" || f.arg == kind {
+			out = append(out, "-"+f.name)
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+func bashCompletion(w io.Writer) {
+	names := subcommandNames()
+	fmt.Fprintln(w, "# bash completion for untar, generated by \"untar completion bash\"")
+	fmt.Fprintln(w, "_untar() {")
+	fmt.Fprintln(w, "\tlocal cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}")
+	fmt.Fprintln(w, "\tlocal cmd= flags= args= dirflags= archflags= fileflags= valflags= files= ext")
+	fmt.Fprintln(w, "\tif ((COMP_CWORD > 1)); then")
+	fmt.Fprintln(w, "\t\tcase ${COMP_WORDS[1]} in")
+	fmt.Fprintf(w, "\t\t%s) cmd=${COMP_WORDS[1]} ;;\n", strings.Join(names, "|"))
+	fmt.Fprintln(w, "\t\tesac")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "\tcase $cmd in")
+	caseBody := func(flags []complFlag, args []string, files bool) {
+		fmt.Fprintf(w, "\t\tflags='%s'\n", flagsOfKind(flags, "*"))
+		fmt.Fprintf(w, "\t\tdirflags='%s'\n", flagsOfKind(flags, argDir))
+		fmt.Fprintf(w, "\t\tarchflags='%s'\n", flagsOfKind(flags, argArchive))
+		fmt.Fprintf(w, "\t\tfileflags='%s'\n", flagsOfKind(flags, argFile))
+		fmt.Fprintf(w, "\t\tvalflags='%s'\n", flagsOfKind(flags, argValue))
+		fmt.Fprintf(w, "\t\targs='%s'\n", strings.Join(args, " "))
+		fmt.Fprintf(w, "\t\tfiles=%v\n", files)
+		fmt.Fprintln(w, "\t\t;;")
+	}
+	for _, name := range names {
+		fmt.Fprintf(w, "\t%s)\n", name)
+		cmd := subcommands[name]
+		caseBody(complFlags(cmd.flags), cmd.args, cmd.files)
+	}
+	fmt.Fprintln(w, "\t*)")
+	caseBody(complFlags(flag.CommandLine), nil, true)
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, "\tlocal p=${prev#-}")
+	fmt.Fprintln(w, "\tp=-${p#-}")
+	fmt.Fprintln(w, "\tCOMPREPLY=()")
+	fmt.Fprintln(w, "\tif [[ $prev == -* && \" $dirflags \" == *\" $p \"* ]]; then")
+	fmt.Fprintln(w, "\t\tcompopt -o filenames")
+	fmt.Fprintln(w, "\t\tmapfile -t COMPREPLY < <(compgen -d -- \"$cur\")")
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "\tif [[ $prev == -* && \" $fileflags \" == *\" $p \"* ]]; then")
+	fmt.Fprintln(w, "\t\tcompopt -o filenames")
+	fmt.Fprintln(w, "\t\tmapfile -t COMPREPLY < <(compgen -f -- \"$cur\")")
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "\tif [[ $prev == -* && \" $valflags \" == *\" $p \"* ]]; then")
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "\tif [[ $cur == -* ]]; then")
+	fmt.Fprintln(w, "\t\tmapfile -t COMPREPLY < <(compgen -W \"$flags\" -- \"$cur\")")
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "\tif [[ -n $args ]]; then")
+	fmt.Fprintln(w, "\t\tmapfile -t COMPREPLY < <(compgen -W \"$args\" -- \"$cur\")")
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "\tif [[ $files != true ]] && ! [[ $prev == -* && \" $archflags \" == *\" $p \"* ]]; then")
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "\tif ((COMP_CWORD == 1)); then")
+	fmt.Fprintf(w, "\t\tmapfile -t COMPREPLY < <(compgen -W '%s' -- \"$cur\")\n", strings.Join(names, " "))
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "\tcompopt -o filenames")
+	fmt.Fprintf(w, "\tfor ext in %s; do\n", strings.Join(archiveExtensions, " "))
+	fmt.Fprintln(w, "\t\tmapfile -t -O ${#COMPREPLY[@]} COMPREPLY < <(compgen -f -X \"!*$ext\" -- \"$cur\")")
+	fmt.Fprintln(w, "\tdone")
+	fmt.Fprintln(w, "\tmapfile -t -O ${#COMPREPLY[@]} COMPREPLY < <(compgen -d -- \"$cur\")")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -F _untar untar")
+}
+
+func zshCompletion(w io.Writer) {
+	names := subcommandNames()
+	exts := make([]string, len(archiveExtensions))
+	for i, ext := range archiveExtensions {
+		exts[i] = strings.TrimPrefix(ext, ".")
+	}
+	archives := fmt.Sprintf(`_files -g "*.(%s)(-.)"`, strings.Join(exts, "|"))
+	escape := strings.NewReplacer(`[`, `\[`, `]`, `\]`, `:`, `\:`, `'`, `'\''`).Replace
+	specs := func(indent string, flags []complFlag) {
+		for _, f := range flags {
+			spec := fmt.Sprintf("-%s[%s]", f.name, escape(f.usage))
+			switch f.arg {
+			case argNone:
+			case argValue:
+				spec += ":value: "
+			case argDir:
+				spec += ":directory:_files -/"
+			case argArchive:
+				spec += ":archive:" + archives
+			default:
+				spec += ":file:_files"
+			}
+			fmt.Fprintf(w, "%s'%s' \\\n", indent, spec)
+		}
+	}
+	fmt.Fprintln(w, "#compdef untar")
+	fmt.Fprintln(w, "# zsh completion for untar, generated by \"untar completion zsh\"")
+	fmt.Fprintln(w, "_untar() {")
+	fmt.Fprintln(w, "\tlocal state")
+	fmt.Fprintln(w, "\tlocal -a subcommands")
+	fmt.Fprintln(w, "\tsubcommands=(")
+	for _, name := range names {
+		fmt.Fprintf(w, "\t\t'%s:%s'\n", name, escape(subcommands[name].usage))
+	}
+	fmt.Fprintln(w, "\t)")
+	fmt.Fprintln(w, "\tif ((CURRENT > 2)) && [[ -n ${subcommands[(r)${words[2]}:*]} ]]; then")
+	fmt.Fprintln(w, "\t\tlocal cmd=${words[2]}")
+	fmt.Fprintln(w, "\t\tshift words")
+	fmt.Fprintln(w, "\t\t((CURRENT--))")
+	fmt.Fprintln(w, "\t\tcase $cmd in")
+	for _, name := range names {
+		cmd := subcommands[name]
+		fmt.Fprintf(w, "\t\t%s)\n", name)
+		fmt.Fprintln(w, "\t\t_arguments \\")
+		specs("\t\t\t", complFlags(cmd.flags))
+		switch {
+		case len(cmd.args) != 0:
+			fmt.Fprintf(w, "\t\t\t'1:argument:(%s)'\n", strings.Join(cmd.args, " "))
+		case cmd.files:
+			fmt.Fprintf(w, "\t\t\t'*:archive:%s'\n", archives)
+		default:
+			fmt.Fprintln(w, "\t\t\t'*:file:_files'")
+		}
+		fmt.Fprintln(w, "\t\t;;")
+	}
+	fmt.Fprintln(w, "\t\tesac")
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "\t_arguments -S \\")
+	specs("\t\t", complFlags(flag.CommandLine))
+	fmt.Fprintln(w, "\t\t'1: :->first' \\")
+	fmt.Fprintf(w, "\t\t'*:archive:%s'\n", strings.Replace(archives, `'`, `'\''`, -1))
+	fmt.Fprintln(w, "\tif [[ $state == first ]]; then")
+	fmt.Fprintln(w, "\t\t_describe -t subcommands subcommand subcommands")
+	fmt.Fprintf(w, "\t\t%s\n", archives)
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "_untar \"$@\"")
+}
+
+func fishCompletion(w io.Writer) {
+	names := subcommandNames()
+	quote := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace
+	archives := "(__fish_complete_suffix " + strings.Join(archiveExtensions, " ") + ")"
+	flags := func(cond string, flags []complFlag) {
+		for _, f := range flags {
+			fmt.Fprintf(w, "complete -c untar -n '%s' -o '%s' -d '%s'", cond, quote(f.name), quote(f.usage))
+			switch f.arg {
+			case argNone:
+			case argValue:
+				fmt.Fprint(w, " -x")
+			case argDir:
+				fmt.Fprint(w, " -x -a '(__fish_complete_directories)'")
+			case argArchive:
+				fmt.Fprintf(w, " -x -k -a '%s'", archives)
+			default:
+				fmt.Fprint(w, " -r -F")
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	fmt.Fprintln(w, "# fish completion for untar, generated by \"untar completion fish\"")
+	fmt.Fprintln(w, "complete -c untar -f")
+	for _, name := range names {
+		fmt.Fprintf(w, "complete -c untar -n __fish_use_subcommand -a '%s' -d '%s'\n", name, quote(subcommands[name].usage))
+	}
+	notSub := "not __fish_seen_subcommand_from " + strings.Join(names, " ")
+	flags(notSub, complFlags(flag.CommandLine))
+	fmt.Fprintf(w, "complete -c untar -n '%s' -k -a '%s'\n", notSub, archives)
+	for _, name := range names {
+		cmd := subcommands[name]
+		cond := "__fish_seen_subcommand_from " + name
+		flags(cond, complFlags(cmd.flags))
+		switch {
+		case len(cmd.args) != 0:
+			fmt.Fprintf(w, "complete -c untar -n '%s' -a '%s'\n", cond, strings.Join(cmd.args, " "))
+		case cmd.files:
+			fmt.Fprintf(w, "complete -c untar -n '%s' -k -a '%s'\n", cond, archives)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// ageIdentities decrypt archives encrypted with age, see -decrypt-with
+var ageIdentities []age.Identity
+
+// loadIdentities reads age identities from file name
+func loadIdentities(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ids, err := age.ParseIdentities(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	ageIdentities = ids
+	return nil
+}
+
+var (
+	ageMagic = []byte("age-encryption.org/")
+	ageArmor = []byte(armor.Header)
+	pgpArmor = []byte("-----BEGIN PGP MESSAGE-----")
+)
+
+// decrypt returns reader of decrypted data if br holds data encrypted with
+// age or armored OpenPGP message, otherwise it returns nil reader. Binary
+// OpenPGP messages have no magic bytes, so they are only tried for data not
+// recognized as archive, see pgpEncrypted.
+func decrypt(br *bufio.Reader) (io.Reader, io.Closer, error) {
+	magic, _ := br.Peek(len(ageArmor))
+	var r io.Reader
+	switch {
+	case bytes.HasPrefix(magic, ageMagic):
+		r = br
+	case bytes.HasPrefix(magic, ageArmor):
+		r = armor.NewReader(br)
+	case bytes.HasPrefix(magic, pgpArmor):
+		d, err := decryptPGP(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		return d, d, nil
+	default:
+		return nil, nil, nil
+	}
+	if len(ageIdentities) == 0 {
+		return nil, nil, errors.New("archive is encrypted with age, use -decrypt-with to provide identity file")
+	}
+	dr, err := age.Decrypt(r, ageIdentities...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dr, nil, nil
+}
+
+// decryptPGP decrypts OpenPGP message read from r with gpg, using its keyring
+// and agent
+func decryptPGP(r io.Reader) (*commandReader, error) {
+	d, err := newCommandReader(r, "gpg", "--batch", "--quiet", "--decrypt")
+	if err != nil {
+		return nil, fmt.Errorf("decrypting OpenPGP message: %w", err)
+	}
+	return d, nil
+}
+
+// pgpEncrypted reports whether data read from br starts with OpenPGP packet
+// holding session key encrypted with public key or passphrase, which
+// encrypted messages start with
+func pgpEncrypted(br *bufio.Reader) bool {
+	magic, _ := br.Peek(1)
+	if len(magic) == 0 {
+		return false
+	}
+	switch b := magic[0]; {
+	case b&0xc0 == 0xc0: // new format
+		tag := b & 0x3f
+		return tag == 1 || tag == 3
+	case b&0xc0 == 0x80: // old format
+		tag := b >> 2 & 0x0f
+		return tag == 1 || tag == 3
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/artyom/untar"
+)
+
+// diffArchive compares archive with destination tree, printing entries that
+// differ, and returns their number
+func diffArchive(archive, dst string, w io.Writer, contents bool, opts ...untar.Option) (int, error) {
+	rd, err := openArchive(archive, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer rd.Close()
+	var n int
+	printDiff := func(d untar.Difference) {
+		n++
+		if d.What[0] == untar.DiffMissing {
+			fmt.Fprintf(w, "%s: missing\n", d.Path)
+			return
+		}
+		verb := "differs"
+		if len(d.What) > 1 {
+			verb = "differ"
+		}
+		fmt.Fprintf(w, "%s: %s %s\n", d.Path, strings.Join(d.What, ", "), verb)
+	}
+	if err := untar.Diff(rd, dst, contents, printDiff, opts...); err != nil {
+		return n, err
+	}
+	return n, rd.drain()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/artyom/untar"
+)
+
+// event is a single line of -log-format=json output
+type event struct {
+	Event string `json:"event"` // entry, warning or summary
+	*memberRecord
+	Outcome string       `json:"outcome,omitempty"` // extracted or unchanged
+	Message string       `json:"message,omitempty"` // warning text
+	Stats   *untar.Stats `json:"stats,omitempty"`
+	Error   string       `json:"error,omitempty"` // set on summary of failed extraction
+}
+
+// eventLog writes extraction events as JSON lines, see -log-format
+type eventLog struct {
+	mu  sync.Mutex // warnings may be reported by parallel workers
+	enc *json.Encoder
+}
+
+func newEventLog(w io.Writer) *eventLog { return &eventLog{enc: json.NewEncoder(w)} }
+
+func (l *eventLog) write(ev event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// errors are ignored: log reader going away must not break extraction
+	_ = l.enc.Encode(ev)
+}
+
+func (l *eventLog) entry(e untar.Entry) {
+	rec := newMemberRecord(e.Header)
+	ev := event{Event: "entry", memberRecord: &rec, Outcome: "extracted"}
+	if e.Unchanged {
+		ev.Outcome = "unchanged"
+	}
+	l.write(ev)
+}
+
+func (l *eventLog) warning(err error) { l.write(event{Event: "warning", Message: err.Error()}) }
+
+// summary writes the final record with extraction statistics and error, if
+// any
+func (l *eventLog) summary(stats *untar.Stats, err error) {
+	ev := event{Event: "summary", Stats: stats}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	l.write(ev)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// externalFormat describes compression format that can be handled by
+// external command
+type externalFormat struct {
+	magic    []byte   // nil if format has none and is detected by extension
+	ext      string   // archive name extension
+	commands []string // commands decompressing with -dc, in order of preference
+}
+
+// externalFormats lists formats supported by -use-external-decompressor
+var externalFormats = map[string]externalFormat{
+	"gzip":   {magic: gzipMagic, ext: ".gz", commands: []string{"pigz", "gzip"}},
+	"bzip2":  {magic: bzip2Magic, ext: ".bz2", commands: []string{"lbzip2", "pbzip2", "bzip2"}},
+	"xz":     {magic: xzMagic, ext: ".xz", commands: []string{"xz"}},
+	"zstd":   {magic: zstdMagic, ext: ".zst", commands: []string{"zstd"}},
+	"lz4":    {magic: []byte{0x04, 0x22, 0x4d, 0x18}, ext: ".lz4", commands: []string{"lz4"}},
+	"lzip":   {magic: []byte("LZIP"), ext: ".lz", commands: []string{"plzip", "lzip"}},
+	"lzop":   {magic: []byte("\x89LZO\x00\r\n\x1a\n"), ext: ".lzo", commands: []string{"lzop"}},
+	"lzma":   {ext: ".lzma", commands: []string{"xz"}},
+	"brotli": {ext: ".br", commands: []string{"brotli"}},
+}
+
+// externalFormatNames returns sorted names of externalFormats
+func externalFormatNames() []string {
+	names := make([]string, 0, len(externalFormats))
+	for name := range externalFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// externalDecompressor runs command to decompress data of some format
+type externalDecompressor struct {
+	externalFormat
+	path string
+}
+
+// externalDecompressors are set by -use-external-decompressor and take
+// precedence over built-in decompression
+var externalDecompressors []externalDecompressor
+
+// useExternal sets up external decompressors for comma-separated list of
+// format names
+func useExternal(list string) error {
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		f, ok := externalFormats[name]
+		if !ok {
+			return fmt.Errorf("unsupported -use-external-decompressor format %q", name)
+		}
+		d := externalDecompressor{externalFormat: f}
+		for _, cmd := range f.commands {
+			if path, err := exec.LookPath(cmd); err == nil {
+				d.path = path
+				break
+			}
+		}
+		if d.path == "" {
+			return fmt.Errorf("no %s command found for -use-external-decompressor", strings.Join(f.commands, " or "))
+		}
+		externalDecompressors = append(externalDecompressors, d)
+	}
+	return nil
+}
+
+// decompressExternal passes data read from br through external decompressor
+// matching its magic bytes or, for formats without them, extension of
+// archive name. It returns nil reader if there's no such decompressor.
+func decompressExternal(br *bufio.Reader, name string) (*commandReader, error) {
+	for _, d := range externalDecompressors {
+		if d.magic == nil && !strings.HasSuffix(name, d.ext) {
+			continue
+		}
+		if d.magic != nil {
+			if magic, _ := br.Peek(len(d.magic)); !bytes.Equal(magic, d.magic) {
+				continue
+			}
+		}
+		return newCommandReader(br, d.path, "-dc")
+	}
+	return nil, nil
+}
+
+// commandReader reads output of command filtering data, like decompressor
+type commandReader struct {
+	cmd    *exec.Cmd
+	out    io.ReadCloser
+	stderr bytes.Buffer
+	err    error // set once output ends
+	once   sync.Once
+	werr   error // result of cmd.Wait
+}
+
+// newCommandReader starts command name with args, passing it data from r
+func newCommandReader(r io.Reader, name string, args ...string) (*commandReader, error) {
+	c := &commandReader{cmd: exec.Command(name, args...)}
+	c.cmd.Stdin = r
+	c.cmd.Stderr = &c.stderr
+	// don't wait for reads from r blocked in copying to stdin
+	c.cmd.WaitDelay = time.Second
+	var err error
+	if c.out, err = c.cmd.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	if err := c.cmd.Start(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Read returns command output; once it ends, failure of command is
+// reported, so that data it couldn't process, like corrupted or encrypted
+// with unknown key, is not mistaken for complete
+func (c *commandReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.out.Read(p)
+	if err == io.EOF {
+		if werr := c.wait(); werr != nil {
+			err = fmt.Errorf("%s: %v: %s", filepath.Base(c.cmd.Path), werr, bytes.TrimSpace(c.stderr.Bytes()))
+		}
+		c.err = err
+	}
+	return n, err
+}
+
+// Close stops command if it's still running
+func (c *commandReader) Close() error {
+	c.cmd.Process.Kill()
+	c.wait()
+	return nil
+}
+
+func (c *commandReader) wait() error {
+	c.once.Do(func() { c.werr = c.cmd.Wait() })
+	return c.werr
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/artyom/untar"
+)
+
+// stringList is a flag.Value collecting values of repeated flag
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// switchValue is a boolean flag.Value for one of the "-x"/"-no-x" flag pair
+// sharing the same variable: the one set last on the command line wins
+type switchValue struct {
+	p  *bool
+	on bool // value stored when flag is set
+}
+
+func (s switchValue) IsBoolFlag() bool { return true }
+
+func (s switchValue) String() string {
+	if s.p == nil {
+		return "false"
+	}
+	return strconv.FormatBool(*s.p == s.on)
+}
+
+func (s switchValue) Set(v string) error {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return err
+	}
+	*s.p = b == s.on
+	return nil
+}
+
+// levelValue is a boolean flag.Value raising integer level, like verbosity
+// set by -v and -vv; the highest level set on the command line wins
+type levelValue struct {
+	p     *int
+	level int // value stored when flag is set
+}
+
+func (l levelValue) IsBoolFlag() bool { return true }
+
+func (l levelValue) String() string {
+	if l.p == nil {
+		return "false"
+	}
+	return strconv.FormatBool(*l.p >= l.level)
+}
+
+func (l levelValue) Set(v string) error {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return err
+	}
+	if b && *l.p < l.level {
+		*l.p = l.level
+	}
+	return nil
+}
+
+// sizeValue is a flag.Value holding byte size, accepting optional K, M, G or
+// T suffix (powers of 1024), like 64M or 1GiB
+type sizeValue int64
+
+func (s *sizeValue) String() string { return strconv.FormatInt(int64(*s), 10) }
+
+func (s *sizeValue) Set(v string) error {
+	n, err := parseSize(v)
+	if err != nil {
+		return err
+	}
+	*s = sizeValue(n)
+	return nil
+}
+
+func parseSize(v string) (int64, error) {
+	mult := int64(1)
+	num := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(v), "B"), "I")
+	if num != "" {
+		switch num[len(num)-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		}
+		if mult != 1 {
+			num = num[:len(num)-1]
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", v)
+	}
+	if n > math.MaxInt64/mult {
+		return 0, fmt.Errorf("size %q is too large", v)
+	}
+	return n * mult, nil
+}
+
+// occurrenceValue is a flag.Value for a flag with optional numeric argument:
+// "-occurrence" alone sets it to 1, "-occurrence=N" to N
+type occurrenceValue int
+
+func (o *occurrenceValue) IsBoolFlag() bool { return true }
+
+func (o *occurrenceValue) String() string { return strconv.Itoa(int(*o)) }
+
+func (o *occurrenceValue) Set(v string) error {
+	switch v {
+	case "true":
+		*o = 1
+		return nil
+	case "false":
+		*o = 0
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid occurrence number %q", v)
+	}
+	*o = occurrenceValue(n)
+	return nil
+}
+
+// timeValue is a flag.Value holding a point in time given either as a date
+// (2006-01-02, optionally followed by 15:04 or 15:04:05 time, or RFC 3339
+// timestamp), or as a path to file starting with / or . whose modification
+// time is used
+type timeValue struct{ time.Time }
+
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func (t *timeValue) String() string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func (t *timeValue) Set(v string) error {
+	if strings.HasPrefix(v, "/") || strings.HasPrefix(v, ".") {
+		fi, err := os.Stat(v)
+		if err != nil {
+			return err
+		}
+		t.Time = fi.ModTime()
+		return nil
+	}
+	for _, layout := range timeLayouts {
+		if tm, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			t.Time = tm
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid date %q", v)
+}
+
+// idMapValue is a flag.Value collecting id mappings given as
+// uid:container:host:count or gid:container:host:count, see untar.IDMap
+type idMapValue struct{ uids, gids []untar.IDMap }
+
+func (m *idMapValue) String() string {
+	if m == nil {
+		return ""
+	}
+	var parts []string
+	for _, r := range m.uids {
+		parts = append(parts, fmt.Sprintf("uid:%d:%d:%d", r.ContainerID, r.HostID, r.Size))
+	}
+	for _, r := range m.gids {
+		parts = append(parts, fmt.Sprintf("gid:%d:%d:%d", r.ContainerID, r.HostID, r.Size))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (m *idMapValue) Set(v string) error {
+	fields := strings.Split(v, ":")
+	if len(fields) != 4 {
+		return fmt.Errorf("invalid id mapping %q, want uid:container:host:count or gid:container:host:count", v)
+	}
+	var ids [3]int
+	for i, s := range fields[1:] {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid id mapping %q: bad number %q", v, s)
+		}
+		ids[i] = n
+	}
+	r := untar.IDMap{ContainerID: ids[0], HostID: ids[1], Size: ids[2]}
+	switch fields[0] {
+	case "uid":
+		m.uids = append(m.uids, r)
+	case "gid":
+		m.gids = append(m.gids, r)
+	default:
+		return fmt.Errorf("invalid id mapping %q, must start with uid: or gid:", v)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/artyom/untar"
+)
+
+// jobEnvPrefix is the prefix of environment variables describing extraction
+// job passed to hook commands: UNTAR_JOB_ARCHIVE, UNTAR_JOB_DEST,
+// UNTAR_JOB_ENTRIES, UNTAR_JOB_BYTES, UNTAR_JOB_SHA256. It differs from
+// envPrefix so that untar called from a hook is not configured by them.
+const jobEnvPrefix = "UNTAR_JOB_"
+
+// runHook runs command with sh -c, passing it extra environment variables
+// and stdin; hook stdout and stderr are passed through.
+func runHook(command string, env []string, stdin io.Reader) error {
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// runPreHook scans archive read from local file src and runs command,
+// passing it metadata of archive members as JSON objects, one per line, on
+// stdin. Hook exiting with non-zero status vetoes extraction.
+func runPreHook(command, archive, src, dst string) error {
+	rd, err := openArchive(src, nil)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	var entries int
+	var size int64
+	tr := tar.NewReader(rd)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeXGlobalHeader, tar.TypeXHeader:
+			continue
+		}
+		entries++
+		size += hdr.Size
+		if err := enc.Encode(newMemberRecord(hdr)); err != nil {
+			return err
+		}
+	}
+	env := []string{
+		jobEnvPrefix + "ARCHIVE=" + archive,
+		jobEnvPrefix + "DEST=" + dst,
+		jobEnvPrefix + "ENTRIES=" + strconv.Itoa(entries),
+		jobEnvPrefix + "BYTES=" + strconv.FormatInt(size, 10),
+	}
+	if err := runHook(command, env, &buf); err != nil {
+		return fmt.Errorf("pre-hook rejected extraction: %w", err)
+	}
+	return nil
+}
+
+// spoolArchive copies archive read from standard input or remote source to
+// a temporary file, returning its name. The file keeps archive name suffix,
+// by which some formats are recognized.
+func spoolArchive(ctx context.Context, name string) (string, error) {
+	var src io.ReadCloser = os.Stdin
+	if name != stdinName {
+		registerSourceHelper(name)
+		var err error
+		if src, err = untar.OpenSource(ctx, name); err != nil {
+			return "", err
+		}
+	}
+	defer src.Close()
+	var suffix string
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(name, ext) {
+			suffix = ext
+			break
+		}
+	}
+	f, err := os.CreateTemp("", "untar-*"+suffix)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
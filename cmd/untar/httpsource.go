@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/artyom/untar"
+)
+
+func init() {
+	untar.RegisterSource("http", openHTTP)
+	untar.RegisterSource("https", openHTTP)
+}
+
+// httpRetries is the number of times download interrupted by network error
+// is resumed
+const httpRetries = 5
+
+// openHTTP opens archive at http or https URL. If connection breaks and
+// server supports range requests, download is resumed from where it stopped.
+func openHTTP(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	return openURL(ctx, http.DefaultClient, u.String())
+}
+
+// openURL downloads url with client, see openHTTP
+func openURL(ctx context.Context, client *http.Client, url string) (*httpReader, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	r := &httpReader{ctx: ctx, cancel: cancel, client: client, url: url, size: -1}
+	resp, err := r.get()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	r.body = resp.Body
+	r.size = resp.ContentLength
+	if resp.Header.Get("Accept-Ranges") == "bytes" {
+		r.validator = resp.Header.Get("ETag")
+		if r.validator == "" {
+			r.validator = resp.Header.Get("Last-Modified")
+		}
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		r.mtime = t
+	}
+	return r, nil
+}
+
+// httpReader reads response body, resuming download with range requests
+// after network errors
+type httpReader struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
+	client    *http.Client
+	url       string
+	mu        sync.Mutex // guards body, which Close may be called concurrently with Read to interrupt
+	body      io.ReadCloser
+	off       int64     // bytes read so far
+	size      int64     // content length, -1 if unknown
+	validator string    // ETag or Last-Modified, empty if download can't be resumed
+	mtime     time.Time // Last-Modified
+	retries   int
+}
+
+// get requests data from the current offset
+func (r *httpReader) get() (*http.Response, error) {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	want := http.StatusOK
+	if r.off > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.off))
+		req.Header.Set("If-Range", r.validator)
+		want = http.StatusPartialContent
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != want {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: unexpected status %s", r.url, resp.Status)
+	}
+	return resp, nil
+}
+
+func (r *httpReader) Read(p []byte) (int, error) {
+	for {
+		r.mu.Lock()
+		body := r.body
+		r.mu.Unlock()
+		n, err := body.Read(p)
+		r.off += int64(n)
+		if err == nil || err == io.EOF || n > 0 {
+			return n, err
+		}
+		if !r.resume(err) {
+			return 0, err
+		}
+	}
+}
+
+// resume tries to continue download after read error err, reporting whether
+// it succeeded
+func (r *httpReader) resume(err error) bool {
+	if r.validator == "" || r.ctx.Err() != nil {
+		return false
+	}
+	for r.retries < httpRetries {
+		r.retries++
+		log.Printf("warning: %s: %v, resuming download at byte %d", r.url, err, r.off)
+		select {
+		case <-time.After(time.Duration(r.retries) * time.Second):
+		case <-r.ctx.Done():
+			return false
+		}
+		var resp *http.Response
+		if resp, err = r.get(); err != nil {
+			continue
+		}
+		r.mu.Lock()
+		r.body.Close()
+		r.body = resp.Body
+		r.mu.Unlock()
+		return true
+	}
+	return false
+}
+
+func (r *httpReader) Close() error {
+	r.cancel()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.body.Close()
+}
+
+// Stat describes downloaded archive, so that its size is known for progress
+// reporting.
+func (r *httpReader) Stat() (os.FileInfo, error) {
+	if r.size < 0 {
+		return nil, errors.New("content length is unknown")
+	}
+	return remoteFileInfo{name: path.Base(r.url), size: r.size, mtime: r.mtime}, nil
+}
+
+// remoteFileInfo describes archive downloaded from network
+type remoteFileInfo struct {
+	name  string
+	size  int64
+	mtime time.Time
+}
+
+func (fi remoteFileInfo) Name() string       { return fi.name }
+func (fi remoteFileInfo) Size() int64        { return fi.size }
+func (fi remoteFileInfo) Mode() os.FileMode  { return 0444 }
+func (fi remoteFileInfo) ModTime() time.Time { return fi.mtime }
+func (fi remoteFileInfo) IsDir() bool        { return false }
+func (fi remoteFileInfo) Sys() interface{}   { return nil }
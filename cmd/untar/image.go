@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/artyom/untar"
+)
+
+// extractImage assembles root file system of container image selected with
+// -image and -platform flags from "docker save" archive
+func extractImage(ctx context.Context, a *mainArgs, opts ...untar.Option) error {
+	switch {
+	case a.dryRun:
+		return errors.New("-dry-run cannot be used with -image or -platform")
+	case a.postHook != "", a.progress, a.progressFD > 0:
+		return errors.New("-post-hook, -progress and -progress-fd cannot be used with -image or -platform")
+	}
+	f, size, err := openSeekable(a.filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := os.MkdirAll(a.dst, os.ModeDir|os.ModePerm); err != nil {
+		return err
+	}
+	ref := untar.ImageRef{Name: a.image, Platform: a.platform}
+	return untar.UntarImageContext(ctx, f, size, a.dst, ref, opts...)
+}
+
+// openSeekable opens archive for random access; compressed and remote
+// archives are copied into a temporary file removed on close
+func openSeekable(name string) (*os.File, int64, error) {
+	if name != stdinName && !strings.Contains(name, "://") && !strings.HasSuffix(name, ".apk") {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, 0, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+		magic := make([]byte, len(xzMagic))
+		n, _ := f.ReadAt(magic, 0)
+		if !compressed(magic[:n]) {
+			return f, fi.Size(), nil
+		}
+		f.Close()
+	}
+	rd, err := openArchive(name, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rd.Close()
+	f, err := os.CreateTemp("", "untar-image-")
+	if err != nil {
+		return nil, 0, err
+	}
+	os.Remove(f.Name())
+	n, err := io.Copy(f, rd)
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, n, nil
+}
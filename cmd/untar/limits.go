@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/artyom/untar"
+)
+
+// ratioSlack is the amount of uncompressed data read before compression
+// ratio is checked: headers and padding of small archives compress well
+const ratioSlack = 1 << 20
+
+// ratioReader reads uncompressed archive, failing once it gets more than
+// ratio times larger than archive file data consumed, see -max-ratio
+type ratioReader struct {
+	r        io.Reader
+	consumed func() int64
+	ratio    float64
+	n        int64
+}
+
+func (r *ratioReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if r.n > ratioSlack && float64(r.n) > r.ratio*float64(r.consumed()) {
+		return n, fmt.Errorf("%w: compression ratio is over %v", untar.ErrLimitExceeded, r.ratio)
+	}
+	return n, err
+}
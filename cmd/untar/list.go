@@ -0,0 +1,105 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/artyom/untar"
+)
+
+// listArchive prints table of contents of archive in the format of "tar -tv";
+// selection options apply
+func listArchive(archive string, w io.Writer, opts ...untar.Option) error {
+	rd, err := openArchive(archive, nil)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+	l := newLister(w)
+	it := untar.NewIterator(rd, opts...)
+	for it.Next() {
+		if err := l.entry(it.Header()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+// lister prints entries in the format of "tar -tv"
+type lister struct {
+	w io.Writer
+	// owner and size are right-aligned to the widest seen so far, as
+	// GNU tar does
+	width int
+}
+
+func newLister(w io.Writer) *lister { return &lister{w: w, width: 19} }
+
+func (l *lister) entry(hdr *tar.Header) error {
+	owner := hdr.Uname
+	if owner == "" {
+		owner = strconv.Itoa(hdr.Uid)
+	}
+	group := hdr.Gname
+	if group == "" {
+		group = strconv.Itoa(hdr.Gid)
+	}
+	size := strconv.FormatInt(hdr.Size, 10)
+	if hdr.Typeflag == tar.TypeChar || hdr.Typeflag == tar.TypeBlock {
+		size = fmt.Sprintf("%d,%d", hdr.Devmajor, hdr.Devminor)
+	}
+	name := hdr.Name
+	switch hdr.Typeflag {
+	case tar.TypeSymlink:
+		name += " -> " + hdr.Linkname
+	case tar.TypeLink:
+		name += " link to " + hdr.Linkname
+	}
+	ug := owner + "/" + group
+	if n := len(ug) + 1 + len(size); n > l.width {
+		l.width = n
+	}
+	_, err := fmt.Fprintf(l.w, "%s %s %*s %s %s\n", modeString(hdr), ug, l.width-len(ug)-1, size,
+		hdr.ModTime.Local().Format("2006-01-02 15:04"), name)
+	return err
+}
+
+// modeString returns ls-style description of entry type and permissions
+func modeString(hdr *tar.Header) string {
+	b := []byte("-rwxrwxrwx")
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		b[0] = 'd'
+	case tar.TypeSymlink:
+		b[0] = 'l'
+	case tar.TypeLink:
+		b[0] = 'h'
+	case tar.TypeChar:
+		b[0] = 'c'
+	case tar.TypeBlock:
+		b[0] = 'b'
+	case tar.TypeFifo:
+		b[0] = 'p'
+	}
+	for i := 0; i < 9; i++ {
+		if hdr.Mode&(1<<uint(8-i)) == 0 {
+			b[i+1] = '-'
+		}
+	}
+	special := func(bit int64, i int, set, noExec byte) {
+		if hdr.Mode&bit == 0 {
+			return
+		}
+		if b[i] == '-' {
+			b[i] = noExec
+		} else {
+			b[i] = set
+		}
+	}
+	special(04000, 3, 's', 'S')
+	special(02000, 6, 's', 'S')
+	special(01000, 9, 't', 'T')
+	return string(b)
+}
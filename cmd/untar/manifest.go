@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/artyom/untar"
+)
+
+// manifest collects digests of extracted regular files
+type manifest struct {
+	root  string // destination paths are made relative to
+	mu    sync.Mutex
+	files []manifestFile
+}
+
+type manifestFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+func (m *manifest) entry(e untar.Entry) {
+	if e.Digest == nil {
+		return
+	}
+	name, err := filepath.Rel(m.root, e.Path)
+	if err != nil {
+		name = e.Path
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files = append(m.files, manifestFile{
+		Path:   filepath.ToSlash(name),
+		Size:   e.Header.Size,
+		SHA256: hex.EncodeToString(e.Digest),
+	})
+}
+
+// write saves manifest to file name, "-" being stdout, in the given format:
+// sha256sum (default) or json
+func (m *manifest) write(name, format string) error {
+	w := io.Writer(os.Stdout)
+	var f *os.File
+	if name != "-" {
+		var err error
+		if f, err = os.Create(name); err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := m.encode(w, format); err != nil {
+		return err
+	}
+	if f != nil {
+		return f.Close()
+	}
+	return nil
+}
+
+func (m *manifest) encode(w io.Writer, format string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch format {
+	case "", "sha256sum":
+		for _, f := range m.files {
+			// escape names like sha256sum does, so that "sha256sum -c"
+			// can read them back
+			if strings.ContainsAny(f.Path, "\\\n\r") {
+				r := strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r")
+				if _, err := fmt.Fprintf(w, "\\%s  %s\n", f.SHA256, r.Replace(f.Path)); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "%s  %s\n", f.SHA256, f.Path); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "json":
+		files := m.files
+		if files == nil {
+			files = []manifestFile{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(files)
+	}
+	return fmt.Errorf("unsupported manifest format %q", format)
+}
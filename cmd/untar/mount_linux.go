@@ -0,0 +1,198 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	iofs "io/fs"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+
+	"github.com/artyom/untar"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+var mountSubcommand = &subcommand{
+	usage: "mount archive read-only with FUSE",
+	flags: mountFlags(),
+	files: true,
+	run:   runMount,
+}
+
+var mountAllowOther bool
+
+func mountFlags() *flag.FlagSet {
+	fs := flag.NewFlagSet("mount", flag.ExitOnError)
+	fs.BoolVar(&mountAllowOther, "allow-other", mountAllowOther, "allow other users to access the mount (needs user_allow_other in /etc/fuse.conf)")
+	return fs
+}
+
+// runMount serves archive contents at mount point until it is unmounted or
+// process is interrupted
+func runMount(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: untar mount [-allow-other] archive mountpoint")
+	}
+	f, size, err := openSeekable(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fsys, err := untar.NewFS(f, size)
+	if err != nil {
+		return err
+	}
+	opts := &fs.Options{MountOptions: fuse.MountOptions{
+		FsName:     args[0],
+		Name:       "untar",
+		AllowOther: mountAllowOther,
+		// works without fusermount when run as root
+		DirectMount: os.Getuid() == 0,
+	}}
+	server, err := fs.Mount(args[1], &mountRoot{fsys: fsys}, opts)
+	if err != nil {
+		return err
+	}
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigc
+		if err := server.Unmount(); err != nil {
+			log.Print("unmount: ", err)
+		}
+	}()
+	server.Wait()
+	return nil
+}
+
+// mountRoot is the root directory of mounted archive; the whole inode tree is
+// built on mount
+type mountRoot struct {
+	fs.Inode
+	fsys *untar.FS
+}
+
+func (r *mountRoot) OnAdd(ctx context.Context) {
+	dirs := map[string]*fs.Inode{".": &r.Inode}
+	links := make(map[*tar.Header]*fs.Inode) // hard links share inodes
+	err := iofs.WalkDir(r.fsys, ".", func(name string, d iofs.DirEntry, err error) error {
+		if err != nil || name == "." {
+			return err
+		}
+		fi, err := r.fsys.Lstat(name)
+		if err != nil {
+			return err
+		}
+		parent := dirs[path.Dir(name)]
+		var attr fuse.Attr
+		fileAttr(&attr, fi)
+		hdr, _ := fi.Sys().(*tar.Header)
+		var ch *fs.Inode
+		switch mode := fi.Mode(); {
+		case mode.IsDir():
+			ch = parent.NewPersistentInode(ctx, &mountNode{attr: attr}, fs.StableAttr{Mode: syscall.S_IFDIR})
+			dirs[name] = ch
+		case mode&iofs.ModeSymlink != 0:
+			target, err := r.fsys.ReadLink(name)
+			if err != nil {
+				return err
+			}
+			ch = parent.NewPersistentInode(ctx, &fs.MemSymlink{Attr: attr, Data: []byte(target)}, fs.StableAttr{Mode: syscall.S_IFLNK})
+		case mode.IsRegular():
+			if ch = links[hdr]; ch != nil {
+				break
+			}
+			f, err := r.fsys.Open(name)
+			if err != nil {
+				return err
+			}
+			node := &mountNode{attr: attr, data: f.(io.ReaderAt)}
+			ch = parent.NewPersistentInode(ctx, node, fs.StableAttr{Mode: syscall.S_IFREG})
+			links[hdr] = ch
+		default:
+			ch = parent.NewPersistentInode(ctx, &mountNode{attr: attr}, fs.StableAttr{Mode: attr.Mode &^ 07777})
+		}
+		parent.AddChild(path.Base(name), ch, false)
+		return nil
+	})
+	if err != nil {
+		log.Print("mount: ", err)
+	}
+}
+
+// mountNode is a read-only file or directory of mounted archive
+type mountNode struct {
+	fs.Inode
+	attr fuse.Attr
+	data io.ReaderAt // nil for non-regular files
+}
+
+func (n *mountNode) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Attr = n.attr
+	return 0
+}
+
+func (n *mountNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	return nil, fuse.FOPEN_KEEP_CACHE, 0
+}
+
+func (n *mountNode) Read(ctx context.Context, fh fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	if n.data == nil {
+		return nil, syscall.EINVAL
+	}
+	k, err := n.data.ReadAt(dest, off)
+	if err != nil && err != io.EOF {
+		return nil, syscall.EIO
+	}
+	return fuse.ReadResultData(dest[:k]), 0
+}
+
+// fileAttr fills FUSE attributes from archive entry info
+func fileAttr(out *fuse.Attr, fi iofs.FileInfo) {
+	mode := fi.Mode()
+	out.Mode = uint32(mode.Perm())
+	switch {
+	case mode.IsDir():
+		out.Mode |= syscall.S_IFDIR
+	case mode&iofs.ModeSymlink != 0:
+		out.Mode |= syscall.S_IFLNK
+	case mode&iofs.ModeNamedPipe != 0:
+		out.Mode |= syscall.S_IFIFO
+	case mode&iofs.ModeCharDevice != 0:
+		out.Mode |= syscall.S_IFCHR
+	case mode&iofs.ModeDevice != 0:
+		out.Mode |= syscall.S_IFBLK
+	default:
+		out.Mode |= syscall.S_IFREG
+	}
+	if mode&iofs.ModeSetuid != 0 {
+		out.Mode |= syscall.S_ISUID
+	}
+	if mode&iofs.ModeSetgid != 0 {
+		out.Mode |= syscall.S_ISGID
+	}
+	if mode&iofs.ModeSticky != 0 {
+		out.Mode |= syscall.S_ISVTX
+	}
+	out.Nlink = 1
+	out.Size = uint64(fi.Size())
+	out.Blocks = (out.Size + 511) / 512
+	mtime := fi.ModTime()
+	out.SetTimes(nil, &mtime, nil)
+	if hdr, ok := fi.Sys().(*tar.Header); ok {
+		out.Uid, out.Gid = uint32(hdr.Uid), uint32(hdr.Gid)
+		out.Rdev = uint32(hdr.Devmajor<<8 | hdr.Devminor)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+// mountSubcommand is only available on Linux
+var mountSubcommand *subcommand
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/artyom/untar"
+)
+
+// notifyInterval is how often status is reported to systemd; timeout is
+// extended by a multiple of it, so that a single large entry doesn't make
+// systemd consider the service hung
+const notifyInterval = time.Second
+
+// systemdNotifier reports extraction status to systemd service manager when
+// run as a service with Type=notify, see sd_notify(3)
+type systemdNotifier struct {
+	conn     net.Conn
+	stats    *untar.Stats
+	watchdog bool
+	stop     chan struct{}
+	wg       sync.WaitGroup
+
+	mu   sync.Mutex
+	rd   *archiveReader // archive being extracted
+	name string         // last extracted entry
+}
+
+// newSystemdNotifier returns notifier sending periodic status updates, nil
+// if not run under systemd
+func newSystemdNotifier(stats *untar.Stats) *systemdNotifier {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+	conn, err := net.Dial("unixgram", addr)
+	if err != nil {
+		return nil
+	}
+	n := &systemdNotifier{
+		conn:     conn,
+		stats:    stats,
+		watchdog: os.Getenv("WATCHDOG_USEC") != "",
+		stop:     make(chan struct{}),
+	}
+	n.wg.Add(1)
+	go n.loop()
+	return n
+}
+
+func (n *systemdNotifier) entry(e untar.Entry) {
+	n.mu.Lock()
+	n.name = e.Header.Name
+	n.mu.Unlock()
+}
+
+// setArchive makes notifier report progress of reading rd
+func (n *systemdNotifier) setArchive(rd *archiveReader) {
+	n.mu.Lock()
+	n.rd = rd
+	n.mu.Unlock()
+}
+
+func (n *systemdNotifier) loop() {
+	defer n.wg.Done()
+	ticker := time.NewTicker(notifyInterval)
+	defer ticker.Stop()
+	for {
+		n.mu.Lock()
+		status, rd := "extracting "+n.name, n.rd
+		n.mu.Unlock()
+		if rd != nil && rd.size > 0 {
+			status += fmt.Sprintf(" (%d%%)", rd.consumed()*100/rd.size)
+		}
+		msg := []string{
+			"STATUS=" + status,
+			fmt.Sprintf("EXTEND_TIMEOUT_USEC=%d", (10 * notifyInterval).Microseconds()),
+		}
+		if n.watchdog {
+			msg = append(msg, "WATCHDOG=1")
+		}
+		n.send(msg...)
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// done stops periodic updates, reporting outcome of extraction
+func (n *systemdNotifier) done(err error) {
+	close(n.stop)
+	n.wg.Wait()
+	if err != nil {
+		n.send("STATUS=failed: " + err.Error())
+	} else {
+		n.send("READY=1", fmt.Sprintf("STATUS=done, %d entries extracted", n.stats.Entries))
+	}
+	n.conn.Close()
+}
+
+func (n *systemdNotifier) send(msg ...string) {
+	// errors are ignored: service manager going away must not break
+	// extraction
+	_, _ = n.conn.Write([]byte(strings.Join(msg, "\n")))
+}
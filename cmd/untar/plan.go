@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/artyom/untar"
+)
+
+// dryRun compares archive with destination tree and prints planned changes.
+// It fails if some entries conflict with existing files.
+func dryRun(archive, dst string, w io.Writer, opts ...untar.Option) error {
+	rd, err := openArchive(archive, nil)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+	counts := make(map[untar.Action]int)
+	printEntry := func(e untar.Entry) {
+		counts[e.Actions[0]]++
+		if e.Actions[0] == untar.ActionUnchanged {
+			return
+		}
+		var extra string
+		if len(e.Actions) > 1 {
+			s := make([]string, len(e.Actions)-1)
+			for i, a := range e.Actions[1:] {
+				s[i] = string(a)
+			}
+			extra = " (" + strings.Join(s, ", ") + ")"
+		}
+		fmt.Fprintf(w, "%s %-9s %s%s\n", actionSymbol(e.Actions[0]), e.Actions[0], e.Path, extra)
+	}
+	opts = append(opts, untar.WithDryRun(), untar.WithEntryFunc(printEntry))
+	if err := untar.Untar(rd, dst, opts...); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "plan: %d to create, %d to change, %d to replace, %d unchanged, %d conflicts\n",
+		counts[untar.ActionCreate],
+		counts[untar.ActionOverwrite]+counts[untar.ActionChmod]+counts[untar.ActionChown],
+		counts[untar.ActionReplace],
+		counts[untar.ActionUnchanged],
+		counts[untar.ActionConflict])
+	if n := counts[untar.ActionConflict]; n != 0 {
+		return fmt.Errorf("%d entries conflict with existing files", n)
+	}
+	return nil
+}
+
+func actionSymbol(a untar.Action) string {
+	switch a {
+	case untar.ActionCreate:
+		return "+"
+	case untar.ActionOverwrite, untar.ActionChmod, untar.ActionChown:
+		return "~"
+	case untar.ActionReplace:
+		return "±"
+	case untar.ActionConflict:
+		return "!"
+	}
+	return " "
+}
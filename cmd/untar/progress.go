@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/artyom/untar"
+)
+
+// progressRecord is a single line of machine-readable progress output
+type progressRecord struct {
+	Entries int    `json:"entries"`         // entries extracted so far
+	Bytes   int64  `json:"bytes"`           // bytes written to regular files
+	Read    int64  `json:"read"`            // bytes read from archive file
+	Total   int64  `json:"total,omitempty"` // archive file size, if known
+	Name    string `json:"name,omitempty"`  // last extracted entry
+	Done    bool   `json:"done,omitempty"`  // set on the final record
+
+	Stats *untar.Stats `json:"stats,omitempty"` // summary, only on the final record
+}
+
+// progressWriter emits progress records after extracted entries, no more
+// often than once per progressInterval, and once extraction completes
+type progressWriter struct {
+	enc   *json.Encoder
+	rd    *archiveReader // archive being extracted, set by caller
+	stats *untar.Stats
+	last  time.Time
+}
+
+const progressInterval = 200 * time.Millisecond
+
+func newProgressWriter(w io.Writer, stats *untar.Stats) *progressWriter {
+	return &progressWriter{enc: json.NewEncoder(w), stats: stats}
+}
+
+func (p *progressWriter) entry(e untar.Entry) {
+	if now := time.Now(); now.Sub(p.last) >= progressInterval {
+		p.last = now
+		p.write(e.Header.Name, false)
+	}
+}
+
+func (p *progressWriter) finish() { p.write("", true) }
+
+func (p *progressWriter) write(name string, done bool) {
+	rec := progressRecord{
+		Entries: p.stats.Entries,
+		Bytes:   p.stats.Bytes,
+		Read:    p.rd.consumed(),
+		Total:   p.rd.size,
+		Name:    name,
+		Done:    done,
+	}
+	if done {
+		rec.Stats = p.stats
+	}
+	// errors are ignored: progress reader going away must not break
+	// extraction
+	_ = p.enc.Encode(rec)
+}
+
+// progressPrinter prints human-readable progress to a terminal, rewriting a
+// single status line, or to a file or pipe, a line per progressLogInterval,
+// see -progress
+type progressPrinter struct {
+	w     io.Writer
+	rd    *archiveReader
+	tty   bool
+	start time.Time
+	last  time.Time
+	wide  int // length of the last status line
+}
+
+const progressLogInterval = 5 * time.Second
+
+func newProgressPrinter(f *os.File, rd *archiveReader) *progressPrinter {
+	p := &progressPrinter{w: f, rd: rd, start: time.Now()}
+	if fi, err := f.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		p.tty = true
+	}
+	return p
+}
+
+func (p *progressPrinter) progress(pr untar.Progress) {
+	interval := progressLogInterval
+	if p.tty {
+		interval = progressInterval
+	}
+	if now := time.Now(); now.Sub(p.last) >= interval {
+		p.last = now
+		p.print(pr.Name)
+	}
+}
+
+// finish prints the final status
+func (p *progressPrinter) finish() {
+	p.print("")
+	if p.tty {
+		fmt.Fprintln(p.w)
+	}
+}
+
+func (p *progressPrinter) print(name string) {
+	read, total := p.rd.consumed(), p.rd.size
+	elapsed := time.Since(p.start)
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(read) / elapsed.Seconds()
+	}
+	var line string
+	if total > 0 {
+		line = fmt.Sprintf("%3d%%  %s of %s  %s/s", read*100/total, formatSize(read), formatSize(total), formatSize(int64(rate)))
+		if rate > 0 && read < total {
+			eta := time.Duration(float64(total-read) / rate * float64(time.Second))
+			line += "  ETA " + eta.Round(time.Second).String()
+		}
+	} else {
+		line = fmt.Sprintf("%s  %s/s", formatSize(read), formatSize(int64(rate)))
+	}
+	if name != "" {
+		line += "  " + name
+	}
+	if !p.tty {
+		fmt.Fprintln(p.w, line)
+		return
+	}
+	pad := p.wide - len(line)
+	p.wide = len(line)
+	if pad < 0 {
+		pad = 0
+	}
+	fmt.Fprintf(p.w, "\r%s%s", line, strings.Repeat(" ", pad))
+}
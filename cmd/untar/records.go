@@ -0,0 +1,56 @@
+package main
+
+import (
+	"archive/tar"
+	"time"
+)
+
+// memberRecord describes archive entry in machine-readable output
+type memberRecord struct {
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	Size     int64     `json:"size"`
+	Mode     uint32    `json:"mode"`
+	Uid      int       `json:"uid"`
+	Gid      int       `json:"gid"`
+	Uname    string    `json:"uname,omitempty"`
+	Gname    string    `json:"gname,omitempty"`
+	ModTime  time.Time `json:"mtime"`
+	Linkname string    `json:"linkname,omitempty"`
+}
+
+func newMemberRecord(hdr *tar.Header) memberRecord {
+	return memberRecord{
+		Name:     hdr.Name,
+		Type:     typeName(hdr.Typeflag),
+		Size:     hdr.Size,
+		Mode:     uint32(hdr.Mode),
+		Uid:      hdr.Uid,
+		Gid:      hdr.Gid,
+		Uname:    hdr.Uname,
+		Gname:    hdr.Gname,
+		ModTime:  hdr.ModTime,
+		Linkname: hdr.Linkname,
+	}
+}
+
+// typeName returns human-readable name of tar entry type
+func typeName(flag byte) string {
+	switch flag {
+	case tar.TypeReg, tar.TypeRegA:
+		return "file"
+	case tar.TypeDir:
+		return "dir"
+	case tar.TypeSymlink:
+		return "symlink"
+	case tar.TypeLink:
+		return "hardlink"
+	case tar.TypeChar:
+		return "char"
+	case tar.TypeBlock:
+		return "block"
+	case tar.TypeFifo:
+		return "fifo"
+	}
+	return string(flag)
+}
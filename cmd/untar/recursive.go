@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/artyom/untar"
+)
+
+// tarExtensions lists file name suffixes of tar archives unpacked by
+// -recursive, longer ones first
+var tarExtensions = []string{".tar.gz", ".tar.bz2", ".tar.xz", ".tar.zst", ".tar", ".tgz", ".tbz2", ".tbz", ".txz", ".tzst"}
+
+// nestedArchives collects tar archives extracted from another archive
+type nestedArchives struct {
+	maxSize int64 // archives larger than this are left packed, 0 means no limit
+	warn    func(error)
+
+	mu    sync.Mutex
+	paths []string
+}
+
+func (n *nestedArchives) entry(e untar.Entry) {
+	if !e.Header.FileInfo().Mode().IsRegular() || nestedDir(e.Path) == e.Path {
+		return
+	}
+	if n.maxSize > 0 && e.Header.Size > n.maxSize {
+		n.warn(fmt.Errorf("%s: nested archive is larger than %d bytes, not unpacking it", e.Header.Name, n.maxSize))
+		return
+	}
+	n.mu.Lock()
+	n.paths = append(n.paths, e.Path)
+	n.mu.Unlock()
+}
+
+// nestedDir returns directory nested archive name is unpacked to: its name
+// without extension, or name itself if it has no tar extension
+func nestedDir(name string) string {
+	for _, ext := range tarExtensions {
+		if strings.HasSuffix(name, ext) && len(name) > len(ext) && !strings.HasSuffix(name, "/"+ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
+
+// extractNested unpacks archives collected by nested, which were found at
+// given depth, into directories named after them; archives found inside are
+// unpacked in turn until -recursive-depth is reached
+func (a *mainArgs) extractNested(ctx context.Context, nested *nestedArchives, depth int) error {
+	for _, name := range nested.paths {
+		if depth > a.recDepth {
+			a.warn(fmt.Errorf("%s: archive is nested deeper than %d levels, not unpacking it", name, a.recDepth))
+			continue
+		}
+		rd, err := openArchive(name, nil)
+		if err != nil {
+			a.warn(fmt.Errorf("%s: not unpacking nested archive: %w", name, err))
+			continue
+		}
+		inner := &nestedArchives{maxSize: nested.maxSize, warn: nested.warn}
+		opts := append(a.nestedOpts[:len(a.nestedOpts):len(a.nestedOpts)], untar.WithEntryFunc(inner.entry))
+		err = extract(ctx, rd, nestedDir(name), false, opts...)
+		rd.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if err := a.extractNested(ctx, inner, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
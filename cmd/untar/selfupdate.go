@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// version is the release version of the binary, set at build time with
+// -ldflags="-X main.version=v1.2.3"
+var version = "devel"
+
+// updatePublicKey is a base64-encoded ed25519 public key used to verify
+// signatures of release checksum files, set at build time with
+// -ldflags="-X main.updatePublicKey=..."
+var updatePublicKey = ""
+
+const releaseURL = "https://api.github.com/repos/artyom/untar/releases/latest"
+
+// release describes a subset of GitHub release API response
+type release struct {
+	Tag    string `json:"tag_name"`
+	Assets []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func (r *release) assetURL(name string) (string, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL, true
+		}
+	}
+	return "", false
+}
+
+type selfUpdateArgs struct {
+	url      string
+	pubkey   string
+	check    bool
+	force    bool
+	insecure bool
+}
+
+var selfUpdate = selfUpdateArgs{url: releaseURL, pubkey: updatePublicKey}
+
+func selfUpdateFlags() *flag.FlagSet {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	fs.StringVar(&selfUpdate.url, "url", selfUpdate.url, "release endpoint `URL`")
+	fs.StringVar(&selfUpdate.pubkey, "pubkey", selfUpdate.pubkey, "base64-encoded ed25519 `key` to verify release checksums signature")
+	fs.BoolVar(&selfUpdate.check, "check", false, "only check whether a newer release is available")
+	fs.BoolVar(&selfUpdate.force, "force", false, "update even if release version matches the current one")
+	fs.BoolVar(&selfUpdate.insecure, "insecure", false, "update without verifying release checksums signature if no public key is set")
+	return fs
+}
+
+// runSelfUpdate replaces running executable with the latest released binary
+// for the current platform. Release is expected to carry the binary named
+// untar-GOOS-GOARCH (with .exe suffix on Windows), SHA256SUMS file listing
+// its checksum, and SHA256SUMS.sig holding ed25519 signature of SHA256SUMS.
+// Without public key to check the signature it refuses to update, unless
+// -insecure is set.
+func runSelfUpdate(args []string) error {
+	if len(args) != 0 {
+		return errors.New("self-update takes no arguments")
+	}
+	if selfUpdate.pubkey == "" && !selfUpdate.insecure && !selfUpdate.check {
+		return errors.New("no public key to verify release signature: use -pubkey, or -insecure to update without verification")
+	}
+	client := &http.Client{Timeout: 5 * time.Minute}
+	var rel release
+	if err := fetchJSON(client, selfUpdate.url, &rel); err != nil {
+		return fmt.Errorf("release lookup: %w", err)
+	}
+	if rel.Tag == version && !selfUpdate.force {
+		log.Printf("already at the latest release %s", version)
+		return nil
+	}
+	if selfUpdate.check {
+		fmt.Printf("release %s is available (current version %s)\n", rel.Tag, version)
+		return nil
+	}
+	binName := "untar-" + runtime.GOOS + "-" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		binName += ".exe"
+	}
+	binURL, ok := rel.assetURL(binName)
+	if !ok {
+		return fmt.Errorf("release %s has no %s binary", rel.Tag, binName)
+	}
+	sumsURL, ok := rel.assetURL("SHA256SUMS")
+	if !ok {
+		return fmt.Errorf("release %s has no SHA256SUMS file", rel.Tag)
+	}
+	sums, err := fetch(client, sumsURL, 1<<20)
+	if err != nil {
+		return err
+	}
+	if selfUpdate.pubkey != "" {
+		sigURL, ok := rel.assetURL("SHA256SUMS.sig")
+		if !ok {
+			return fmt.Errorf("release %s has no SHA256SUMS.sig file", rel.Tag)
+		}
+		sig, err := fetch(client, sigURL, 1<<10)
+		if err != nil {
+			return err
+		}
+		if err := verifySignature(selfUpdate.pubkey, sums, sig); err != nil {
+			return err
+		}
+	} else {
+		log.Print("no public key configured, -insecure is set: skipping signature verification")
+	}
+	want, err := lookupChecksum(sums, binName)
+	if err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	if err := replaceExecutable(client, exe, binURL, want); err != nil {
+		return err
+	}
+	log.Printf("updated %s to %s", exe, rel.Tag)
+	return nil
+}
+
+// replaceExecutable downloads binary from url into a temporary file next to
+// exe, verifies its checksum and renames it over exe. On Windows, where
+// running executable can't be replaced, exe is renamed to exe.old first; it
+// is removed by the next update.
+func replaceExecutable(client *http.Client, exe, url string, sum []byte) error {
+	fi, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %s", url, resp.Status)
+	}
+	f, err := os.CreateTemp(filepath.Dir(exe), ".untar-update-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(f, io.TeeReader(resp.Body, h)); err != nil {
+		return err
+	}
+	if got := h.Sum(nil); !bytes.Equal(got, sum) {
+		return fmt.Errorf("checksum mismatch: got %x, want %x", got, sum)
+	}
+	if err := f.Chmod(fi.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		_ = os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+		if err := os.Rename(f.Name(), exe); err != nil {
+			_ = os.Rename(old, exe)
+			return err
+		}
+		return nil
+	}
+	return os.Rename(f.Name(), exe)
+}
+
+// verifySignature checks that sig is a valid ed25519 signature of msg made with
+// base64-encoded public key. Signature may either be raw or base64-encoded.
+func verifySignature(key string, msg, sig []byte) error {
+	pub, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("public key decode: %w", err)
+	}
+	if len(pub) != ed25519.PublicKeySize {
+		return fmt.Errorf("public key has invalid size %d", len(pub))
+	}
+	if len(sig) != ed25519.SignatureSize {
+		b, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+		if err != nil {
+			return fmt.Errorf("signature decode: %w", err)
+		}
+		sig = b
+	}
+	if !ed25519.Verify(ed25519.PublicKey(pub), msg, sig) {
+		return errors.New("checksums file signature verification failed")
+	}
+	return nil
+}
+
+// lookupChecksum finds checksum of a file name in sha256sum-formatted data
+func lookupChecksum(sums []byte, name string) ([]byte, error) {
+	sc := bufio.NewScanner(bytes.NewReader(sums))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != name {
+			continue
+		}
+		return hex.DecodeString(fields[0])
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no checksum for %s in SHA256SUMS", name)
+}
+
+func fetch(client *http.Client, url string, limit int64) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, limit))
+}
+
+func fetchJSON(client *http.Client, url string, v interface{}) error {
+	b, err := fetch(client, url, 10<<20)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
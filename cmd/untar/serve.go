@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/artyom/untar"
+)
+
+var serveAddr = "localhost:8080"
+
+func serveFlags() *flag.FlagSet {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.StringVar(&serveAddr, "addr", serveAddr, "`address` to listen on")
+	return fs
+}
+
+// runServe serves archive contents over HTTP without extracting them;
+// directories are served with listings, or with their index.html if present
+func runServe(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: untar serve [-addr host:port] archive")
+	}
+	f, size, err := openSeekable(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fsys, err := untar.NewFS(f, size)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Addr:              serveAddr,
+		Handler:           http.FileServer(http.FS(fsys)),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("serving %s on http://%s/", args[0], serveAddr)
+	return srv.ListenAndServe()
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// errBadSignature is returned when archive doesn't match its signature
+var errBadSignature = errors.New("signature verification failed")
+
+// verifier checks detached signature of data written to it
+type verifier interface {
+	io.Writer
+	verify() error
+}
+
+// newVerifier returns verifier of signature in file sigFile made with key
+// from file keyFile. Signatures of minisign and signify are checked
+// natively, anything else is treated as OpenPGP signature and checked with
+// gpgv, keyFile being its keyring.
+func newVerifier(sigFile, keyFile string) (verifier, error) {
+	sig, err := os.ReadFile(sigFile)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(sig, []byte("untrusted comment:")) {
+		return newEdVerifier(sig, keyFile)
+	}
+	return newGPGVerifier(sigFile, keyFile)
+}
+
+// verifyFile checks signature of a local file with v
+func verifyFile(v verifier, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(v, f); err != nil {
+		return err
+	}
+	return v.verify()
+}
+
+// edVerifier checks Ed25519 signatures of minisign and signify
+type edVerifier struct {
+	key     ed25519.PublicKey
+	sig     []byte       // signature of data or, if prehashed, of its BLAKE2b-512 hash
+	trusted []byte       // signature followed by minisign trusted comment, nil for signify
+	global  []byte       // signature of trusted
+	buf     bytes.Buffer // data, unless it's prehashed
+	hash    hash.Hash    // BLAKE2b-512 of data if signature is prehashed
+}
+
+// newEdVerifier parses signature sig and public key from file keyFile. Both
+// have "untrusted comment:" line followed by base64 of algorithm, key number
+// and signature or key; minisign signatures have another two lines with
+// trusted comment and its signature.
+func newEdVerifier(sig []byte, keyFile string) (*edVerifier, error) {
+	sigLines := readLines(sig)
+	if len(sigLines) < 2 {
+		return nil, errors.New("malformed signature file")
+	}
+	sigData, err := base64.StdEncoding.DecodeString(sigLines[1])
+	if err != nil || len(sigData) != 2+8+ed25519.SignatureSize {
+		return nil, errors.New("malformed signature file")
+	}
+	b, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	keyLines := readLines(b)
+	if len(keyLines) < 2 || !strings.HasPrefix(keyLines[0], "untrusted comment:") {
+		return nil, errors.New("malformed public key file")
+	}
+	keyData, err := base64.StdEncoding.DecodeString(keyLines[1])
+	if err != nil || len(keyData) != 2+8+ed25519.PublicKeySize || string(keyData[:2]) != "Ed" {
+		return nil, errors.New("malformed public key file")
+	}
+	if !bytes.Equal(sigData[2:10], keyData[2:10]) {
+		return nil, fmt.Errorf("%w: signature was made with another key", errBadSignature)
+	}
+	v := &edVerifier{key: ed25519.PublicKey(keyData[10:]), sig: sigData[10:]}
+	switch string(sigData[:2]) {
+	case "Ed":
+	case "ED":
+		v.hash, _ = blake2b.New512(nil)
+	default:
+		return nil, fmt.Errorf("unsupported signature algorithm %q", sigData[:2])
+	}
+	if len(sigLines) >= 4 {
+		comment, ok := strings.CutPrefix(sigLines[2], "trusted comment: ")
+		if !ok {
+			return nil, errors.New("malformed signature file")
+		}
+		if v.global, err = base64.StdEncoding.DecodeString(sigLines[3]); err != nil {
+			return nil, errors.New("malformed signature file")
+		}
+		v.trusted = append(append([]byte{}, v.sig...), comment...)
+	} else if v.hash != nil {
+		return nil, errors.New("malformed signature file: no trusted comment")
+	}
+	return v, nil
+}
+
+func (v *edVerifier) Write(p []byte) (int, error) {
+	if v.hash != nil {
+		return v.hash.Write(p)
+	}
+	return v.buf.Write(p)
+}
+
+func (v *edVerifier) verify() error {
+	msg := v.buf.Bytes()
+	if v.hash != nil {
+		msg = v.hash.Sum(nil)
+	}
+	if !ed25519.Verify(v.key, msg, v.sig) {
+		return errBadSignature
+	}
+	if v.trusted != nil && !ed25519.Verify(v.key, v.trusted, v.global) {
+		return fmt.Errorf("%w: invalid trusted comment signature", errBadSignature)
+	}
+	return nil
+}
+
+// readLines splits b into lines without line endings
+func readLines(b []byte) []string {
+	var lines []string
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		lines = append(lines, strings.TrimRight(sc.Text(), "\r"))
+	}
+	return lines
+}
+
+// gpgVerifier passes data to gpgv checking OpenPGP signature
+type gpgVerifier struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	output bytes.Buffer
+	err    error // first write error, gpgv exited early
+}
+
+func newGPGVerifier(sigFile, keyFile string) (*gpgVerifier, error) {
+	// gpgv looks for keyring without slashes in its home directory
+	keyFile, err := filepath.Abs(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	v := &gpgVerifier{cmd: exec.Command("gpgv", "--keyring", keyFile, "--", sigFile, "-")}
+	v.cmd.Stdout = &v.output
+	v.cmd.Stderr = &v.output
+	if v.stdin, err = v.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	if err := v.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("checking OpenPGP signature: %w", err)
+	}
+	return v, nil
+}
+
+// Write passes data to gpgv. Errors are reported by verify, so that failure
+// of gpgv doesn't look like a problem with reading the archive.
+func (v *gpgVerifier) Write(p []byte) (int, error) {
+	if v.err == nil {
+		_, v.err = v.stdin.Write(p)
+	}
+	return len(p), nil
+}
+
+func (v *gpgVerifier) verify() error {
+	v.stdin.Close()
+	if err := v.cmd.Wait(); err != nil {
+		return fmt.Errorf("%w: gpgv: %v: %s", errBadSignature, err, bytes.TrimSpace(v.output.Bytes()))
+	}
+	return v.err
+}
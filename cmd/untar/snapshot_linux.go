@@ -0,0 +1,77 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	btrfsSubvolumeIno = 256 // inode number of btrfs subvolume root directory
+	zfsSuperMagic     = 0x2fc12fc1
+)
+
+// snapshot creates btrfs or ZFS snapshot of destination directory dst,
+// returning command restoring dst from the snapshot
+func snapshot(dst string) (rollback string, err error) {
+	dst, err = filepath.Abs(dst)
+	if err != nil {
+		return "", err
+	}
+	var st unix.Statfs_t
+	if err := unix.Statfs(dst, &st); err != nil {
+		return "", err
+	}
+	stamp := time.Now().Format("20060102T150405")
+	switch int64(st.Type) {
+	case unix.BTRFS_SUPER_MAGIC:
+		fi, err := os.Stat(dst)
+		if err != nil {
+			return "", err
+		}
+		if fi.Sys().(*syscall.Stat_t).Ino != btrfsSubvolumeIno {
+			return "", fmt.Errorf("%s is not a btrfs subvolume, cannot snapshot it", dst)
+		}
+		snap := dst + ".untar-" + stamp
+		if _, err := command("btrfs", "subvolume", "snapshot", "-r", dst, snap); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("btrfs subvolume delete %[1]s && btrfs subvolume snapshot %[2]s %[1]s", dst, snap), nil
+	case zfsSuperMagic:
+		out, err := command("zfs", "list", "-H", "-o", "name", dst)
+		if err != nil {
+			return "", err
+		}
+		snap := strings.TrimSpace(out) + "@untar-" + stamp
+		if _, err := command("zfs", "snapshot", snap); err != nil {
+			return "", err
+		}
+		return "zfs rollback " + snap, nil
+	}
+	return "", fmt.Errorf("%s is neither on btrfs nor on ZFS, cannot snapshot it", dst)
+}
+
+// command runs program, returning its standard output
+func command(name string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return string(out), nil
+}
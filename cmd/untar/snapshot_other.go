@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+func snapshot(dst string) (string, error) {
+	return "", errors.New("snapshots are only supported on Linux")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/artyom/untar"
+)
+
+// sourceHelperPrefix is the prefix of executables handling archive URLs of
+// schemes not supported natively: URL with "scheme://" is opened by running
+// "untar-source-scheme URL", which is expected to write archive to stdout.
+const sourceHelperPrefix = "untar-source-"
+
+var helpersMu sync.Mutex
+
+// registerSourceHelper registers source for URL scheme of name if there's no
+// registered source for it, but helper executable is available
+func registerSourceHelper(name string) {
+	i := strings.Index(name, "://")
+	if i <= 0 {
+		return
+	}
+	scheme := strings.ToLower(name[:i])
+	helpersMu.Lock()
+	defer helpersMu.Unlock()
+	for _, s := range untar.Sources() {
+		if s == scheme {
+			return
+		}
+	}
+	helper, err := exec.LookPath(sourceHelperPrefix + scheme)
+	if err != nil {
+		return
+	}
+	untar.RegisterSource(scheme, func(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+		cmd := exec.CommandContext(ctx, helper, u.String())
+		cmd.Stderr = os.Stderr
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, err
+		}
+		return &helperReader{ReadCloser: out, cmd: cmd}, nil
+	})
+}
+
+// helperReader reads output of source helper, waiting for it to exit on Close
+type helperReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (h *helperReader) Close() error {
+	h.ReadCloser.Close()
+	return h.cmd.Wait()
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"archive/tar"
+	"io"
+
+	"github.com/artyom/untar"
+)
+
+// catArchive writes contents of regular files selected by opts to w, like
+// "tar -xO" does; entries of other types are skipped
+func catArchive(archive string, w io.Writer, opts ...untar.Option) error {
+	rd, err := openArchive(archive, nil)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+	it := untar.NewIterator(rd, opts...)
+	for it.Next() {
+		switch it.Header().Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			if _, err := io.Copy(w, it.Reader()); err != nil {
+				return err
+			}
+		}
+	}
+	return it.Err()
+}
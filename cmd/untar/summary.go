@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/artyom/untar"
+)
+
+// printSummary writes extraction statistics as a table
+func printSummary(w io.Writer, s *untar.Stats) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "files\t%d\n", s.Files)
+	fmt.Fprintf(tw, "directories\t%d\n", s.Dirs)
+	fmt.Fprintf(tw, "symlinks\t%d\n", s.Symlinks)
+	fmt.Fprintf(tw, "hardlinks\t%d\n", s.Hardlinks)
+	if len(s.LinkGroups) != 0 {
+		fmt.Fprintf(tw, "hardlink groups\t%d\n", len(s.LinkGroups))
+	}
+	if s.Devices != 0 {
+		fmt.Fprintf(tw, "devices\t%d\n", s.Devices)
+	}
+	if s.Fifos != 0 {
+		fmt.Fprintf(tw, "fifos\t%d\n", s.Fifos)
+	}
+	fmt.Fprintf(tw, "bytes written\t%s\n", formatSize(s.Bytes))
+	fmt.Fprintf(tw, "disk space used\t%s\n", formatSize(s.DiskBytes))
+	if s.Unchanged != 0 {
+		fmt.Fprintf(tw, "unchanged\t%d\n", s.Unchanged)
+	}
+	fmt.Fprintf(tw, "skipped\t%d\n", s.Skipped)
+	if s.Failed != 0 {
+		fmt.Fprintf(tw, "failed\t%d\n", s.Failed)
+	}
+	fmt.Fprintf(tw, "warnings\t%d\n", s.Warnings)
+	elapsed := s.Elapsed.Round(time.Millisecond)
+	if s.Elapsed < time.Second {
+		elapsed = s.Elapsed.Round(time.Microsecond)
+	}
+	fmt.Fprintf(tw, "elapsed\t%v\n", elapsed)
+	return tw.Flush()
+}
+
+// formatSize returns human-readable size using binary prefixes
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+import "errors"
+
+func isTerminal(fd int) bool { return false }
+
+func makeRaw(fd int) (func(), error) { return nil, errors.ErrUnsupported }
+
+func termSize(fd int) (int, int, error) { return 0, 0, errors.ErrUnsupported }
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/artyom/untar"
+)
+
+var undoLog string
+
+func undoFlags() *flag.FlagSet {
+	fs := flag.NewFlagSet("undo", flag.ExitOnError)
+	fs.StringVar(&undoLog, "log", undoLog, "audit log `file` written with -audit-log")
+	return fs
+}
+
+// runUndo reverts changes recorded in audit log of previous extraction
+func runUndo(args []string) error {
+	if undoLog == "" || len(args) != 0 {
+		return errors.New("usage: untar undo -log file")
+	}
+	f, err := os.Open(undoLog)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return untar.Undo(f, func(err error) { log.Print("warning: ", err) })
+}
@@ -1,63 +1,1378 @@
 package main
 
 import (
-	"compress/bzip2"
-	"compress/gzip"
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"flag"
+	"fmt"
+	"hash"
 	"io"
 	"log"
 	"os"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/artyom/untar"
 )
 
 func main() {
-	var (
-		dst      = "."
-		filename string
-	)
-	flag.StringVar(&dst, "to", dst, "directory to unpack to")
-	flag.StringVar(&filename, "from", filename, "file to extract")
+	args := &mainArgs{dst: ".", match: untar.DefaultMatchMode, recDepth: 3, recMaxSize: 1 << 30}
+	args.register(flag.CommandLine)
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			if err := cmd.main(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+	if err := flagsFromEnv(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
 	flag.Parse()
-	if dst == "" {
-		dst = "."
+	if args.dst == "" {
+		args.dst = "."
 	}
-	if filename == "" {
-		flag.Usage()
-		os.Exit(1)
+	args.members = flag.Args()
+	if args.filename == "" {
+		for len(args.members) != 0 && isArchiveArg(args.members[0]) {
+			args.archives = append(args.archives, args.members[0])
+			args.members = args.members[1:]
+		}
+		if len(args.archives) != 0 {
+			args.filename = args.archives[0]
+		}
+	}
+	if args.filename == "" {
+		if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice != 0 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		args.filename = stdinName
 	}
-	if err := openAndUntar(filename, dst); err != nil {
+	if err := run(args); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func openAndUntar(name, dst string) error {
-	var rd io.Reader
-	f, err := os.Open(name)
+// mainArgs holds flags of the default (extraction) mode
+type mainArgs struct {
+	dst      string
+	filename string
+	archives []string // archives given as positional arguments, extracted in order
+	members  []string // positional arguments
+	stripTop string
+	strip    int
+	xforms   stringList
+	subdir   string
+	keepDirs bool
+	overlay  bool
+	ociLayer bool
+	bestEff  bool
+	rmPart   bool
+	keepGo   bool
+	relLinks bool
+	absLinks bool
+	includes stringList
+	excludes stringList
+	exclFrom stringList
+	ignore   bool
+	exclVCS  bool
+	exclBak  bool
+	match    untar.MatchMode
+	preHook  string
+	postHook string
+	wantSum  string
+	sigFile  string
+	identity string
+	external string
+	pubkey   string
+
+	verbose    int
+	logFormat  string
+	events     *eventLog      // set by options for -log-format=json
+	warn       func(error)    // set by options
+	nestedOpts []untar.Option // set by options, see -recursive
+	recursive  bool
+	recDepth   int
+	recMaxSize sizeValue
+	progress   bool
+	progressFD int
+	timeout    time.Duration
+	maxMemory  sizeValue
+	limits     untar.Limits
+	maxFile    sizeValue
+	maxTotal   sizeValue
+	maxRatio   float64
+	checkSpace bool
+	atomic     bool
+	rollback   bool
+	dryRun     bool
+	verify     bool
+	skipSame   bool
+	snapshot   bool
+	baseline   string
+	userns     bool
+	idMap      idMapValue
+	byName     bool
+	noOwner    bool
+	owner      string
+	group      string
+	checkpoint int
+	workers    int
+	strict     bool
+	xattrs     bool
+	selinux    bool
+	ntfsPerms  bool
+	unsafe     bool
+	list       bool
+	toStdout   bool
+	verifyOnly bool
+	diff       bool
+	manifest   string
+	sumFormat  string
+	cpActions  stringList
+	compare    bool
+	summary    bool
+	occurrence occurrenceValue
+	trailing   string
+	zeros      bool
+	overwrite  string
+	policy     string
+	auditLog   string
+	backupDir  string
+	goModule   string
+	image      string
+	platform   string
+	newer      timeValue
+	older      timeValue
+}
+
+func (a *mainArgs) register(fs *flag.FlagSet) {
+	fs.StringVar(&a.dst, "to", a.dst, "directory to unpack to")
+	fs.StringVar(&a.dst, "C", a.dst, "same as -to")
+	fs.StringVar(&a.filename, "from", a.filename, "file to extract, - to read standard input (the default if it is not a terminal)")
+	fs.BoolVar(&a.keepDirs, "keep-directory-symlink", a.keepDirs, "extract through existing symlinks to directories instead of replacing them")
+	fs.BoolVar(&a.relLinks, "relative-symlinks", a.relLinks, "rewrite absolute symlink targets to relative ones, treating destination as /")
+	fs.BoolVar(&a.absLinks, "absolute-symlinks", a.absLinks, "rewrite relative symlink targets to absolute ones, treating destination as /")
+	fs.BoolVar(&a.bestEff, "best-effort", a.bestEff, "skip with a warning ownership changes, device nodes and named pipes if they are not permitted")
+	fs.BoolVar(&a.keepGo, "keep-going", a.keepGo, "continue after entries that fail to extract, reporting all failures at the end")
+	fs.BoolVar(&a.rmPart, "remove-partial", a.rmPart, "remove files left partially written when extraction fails or is interrupted")
+	fs.BoolVar(&a.ociLayer, "oci-layer", a.ociLayer, "treat archives as container image layers applied in order on top of destination, removing paths hidden by their whiteouts")
+	fs.BoolVar(&a.recursive, "recursive", a.recursive, "unpack tar archives found inside the archive into directories named after them")
+	fs.IntVar(&a.recDepth, "recursive-depth", a.recDepth, "with -recursive, unpack archives nested at most `N` levels deep")
+	fs.Var(&a.recMaxSize, "recursive-max-size", "with -recursive, leave nested archives larger than `size` packed, 0 means no limit")
+	fs.BoolVar(&a.overlay, "overlay-whiteouts", a.overlay, "treat archive as container image layer, converting its whiteouts for use as overlayfs upper directory")
+	fs.Var(&a.includes, "include", "extract only entries matching `pattern`, ** matches across directories (can be repeated)")
+	fs.Var(&a.excludes, "exclude", "skip entries matching `pattern` (can be repeated)")
+	fs.Var(&a.exclFrom, "exclude-from", "skip entries matching patterns read from `file`, one per line (can be repeated)")
+	fs.BoolVar(&a.exclVCS, "exclude-vcs", a.exclVCS, "skip version control system directories and files, like .git or .svn")
+	fs.BoolVar(&a.exclBak, "exclude-backups", a.exclBak, "skip editor backup and lock files, like *~ or #*#")
+	fs.BoolVar(&a.ignore, "tarignore", a.ignore, "skip entries matching patterns from "+tarignore+" file in destination directory")
+	fs.Var(switchValue{&a.match.Anchored, true}, "anchored", "patterns match the start of entry names")
+	fs.Var(switchValue{&a.match.Anchored, false}, "no-anchored", "patterns match after any / in entry names")
+	fs.Var(switchValue{&a.match.WildcardsMatchSlash, true}, "wildcards-match-slash", "wildcards in patterns match /")
+	fs.Var(switchValue{&a.match.WildcardsMatchSlash, false}, "no-wildcards-match-slash", "wildcards in patterns do not match /")
+	fs.Var(switchValue{&a.match.IgnoreCase, true}, "ignore-case", "case-insensitive pattern matching")
+	fs.Var(switchValue{&a.match.IgnoreCase, false}, "no-ignore-case", "case-sensitive pattern matching")
+	fs.Var(&a.occurrence, "occurrence", "extract only the `N`-th occurrence of each member given as argument and stop once all are found; -occurrence alone means 1")
+	fs.Var(&a.newer, "newer-mtime", "extract only entries modified after `date` (2006-01-02[ 15:04[:05]], RFC 3339, or path to file starting with / or . to take its modification time)")
+	fs.Var(&a.older, "older-mtime", "extract only entries modified before `date`, same format as -newer-mtime")
+	fs.StringVar(&a.subdir, "subdir", a.subdir, "extract only contents of archive directory `path`, placing them right into destination")
+	fs.StringVar(&a.goModule, "go-module", a.goModule, "treat archive as Go module zip of `path@version`, validating it; use auto to take module from archive")
+	fs.StringVar(&a.image, "image", a.image, "assemble root file system of image `name:tag` from \"docker save\" archive")
+	fs.StringVar(&a.platform, "platform", a.platform, "assemble root file system of image for `os/arch[/variant]` from \"docker save\" archive")
+	fs.IntVar(&a.strip, "strip-components", a.strip, "remove `N` leading path elements from entry names, skipping entries left with none")
+	fs.Var(&a.xforms, "transform", "rename entries with sed-like `expression` s/regexp/replacement/[gi], like \"s,^build/output/,bin/,\" (can be repeated)")
+	fs.StringVar(&a.stripTop, "strip-top-level", a.stripTop, "set to `auto` to strip the single top level directory shared by all entries")
+	fs.StringVar(&a.preHook, "pre-hook", a.preHook, "shell `command` reading archive member list on stdin, non-zero exit status aborts extraction; archives not in local files are first copied to a temporary file")
+	fs.StringVar(&a.auditLog, "audit-log", a.auditLog, "append JSON record of every file system change to `file`")
+	fs.StringVar(&a.backupDir, "audit-backups", a.backupDir, "with -audit-log, move files that would be overwritten or removed to `directory` so that \"untar undo\" can restore them")
+	fs.Var(levelValue{&a.verbose, 1}, "v", "print name, type and size of each extracted entry to stdout")
+	fs.Var(levelValue{&a.verbose, 2}, "vv", "print each extracted entry with mode, owner and modification time, like \"tar -tv\"")
+	fs.StringVar(&a.logFormat, "log-format", a.logFormat, "`format` of output: text (default) or json, printing a JSON record per extracted entry and warning, and a summary")
+	fs.BoolVar(&a.summary, "summary", a.summary, "print extraction statistics to stderr when done")
+	fs.BoolVar(&a.skipSame, "skip-identical", a.skipSame, "leave existing files with the same size and modification time intact")
+	fs.BoolVar(&a.skipSame, "incremental", a.skipSame, "same as -skip-identical")
+	fs.BoolVar(&a.skipSame, "update", a.skipSame, "same as -skip-identical")
+	fs.BoolVar(&a.compare, "compare-contents", a.compare, "with -skip-identical, also compare contents of files of the same size, rewriting only the differing part; with -diff, report files with different contents")
+	fs.StringVar(&a.baseline, "baseline", a.baseline, "start with a copy-on-write clone of `directory` holding previous release, writing only what differs; destination must be empty")
+	fs.BoolVar(&a.userns, "userns", a.userns, "run as root of a new user namespace with subordinate ids of current user mapped, so that ownership can be restored without privileges")
+	fs.Var(&a.idMap, "idmap", "restore ownership shifted by `mapping` uid:container:host:count or gid:container:host:count, as for user namespaces (can be repeated)")
+	fs.BoolVar(&a.byName, "same-owner-by-name", a.byName, "restore ownership by user and group names from archive, falling back to numeric ids for unknown names")
+	fs.BoolVar(&a.noOwner, "no-same-owner", a.noOwner, "don't restore ownership from archive even when run as root")
+	fs.StringVar(&a.owner, "owner", a.owner, "make extracted entries owned by `user` (name or id) instead of one from archive")
+	fs.StringVar(&a.group, "group", a.group, "make extracted entries owned by `group` (name or id) instead of one from archive")
+	fs.BoolVar(&a.snapshot, "snapshot", a.snapshot, "snapshot existing destination on btrfs or ZFS before extraction and print command to roll back to it")
+	fs.BoolVar(&a.unsafe, "unsafe", a.unsafe, "allow entries to be written outside of destination via .. elements or symlinks; only for trusted archives")
+	fs.BoolVar(&a.xattrs, "xattrs", a.xattrs, "restore extended attributes, like file capabilities, stored by \"tar --xattrs\"")
+	fs.BoolVar(&a.selinux, "selinux", a.selinux, "restore SELinux security contexts stored in archive")
+	fs.BoolVar(&a.ntfsPerms, "ntfs-permissions", a.ntfsPerms, "on Windows, translate permission bits to NTFS access control lists")
+	fs.BoolVar(&a.strict, "strict", a.strict, "reject archives with nonconforming or suspicious headers, for untrusted input")
+	fs.BoolVar(&a.verify, "verify", a.verify, "read back extracted files from storage and check them against the archive")
+	fs.BoolVar(&a.list, "list", a.list, "don't extract anything, print archive contents like \"tar -tv\"")
+	fs.BoolVar(&a.list, "t", a.list, "same as -list")
+	fs.BoolVar(&a.toStdout, "to-stdout", a.toStdout, "don't extract anything, write contents of selected files to stdout")
+	fs.BoolVar(&a.toStdout, "O", a.toStdout, "same as -to-stdout")
+	fs.BoolVar(&a.verifyOnly, "verify-archive", a.verifyOnly, "don't extract anything, read the whole archive checking it for corruption")
+	fs.BoolVar(&a.diff, "diff", a.diff, "don't extract anything, report how destination differs from archive like \"tar -d\"")
+	fs.BoolVar(&a.diff, "d", a.diff, "same as -diff")
+	fs.BoolVar(&a.dryRun, "dry-run", a.dryRun, "don't extract anything, print changes extraction would make")
+	fs.BoolVar(&a.dryRun, "n", a.dryRun, "same as -dry-run")
+	fs.StringVar(&a.trailing, "trailing-data", a.trailing, "what to do with data after the end of archive: `ignore` (default), warn or error")
+	fs.BoolVar(&a.zeros, "ignore-zeros", a.zeros, "read past end of archive markers, extracting concatenated archives like \"cat a.tar b.tar\" in full")
+	fs.StringVar(&a.overwrite, "overwrite", a.overwrite, "what to do with existing files: `always` replace them (default), never, keep-newer-files or error")
+	fs.StringVar(&a.policy, "policy", a.policy, "apply preset of safety settings `name`: "+strings.Join(untar.Policies, ", ")+"; other flags override it")
+	fs.DurationVar(&a.timeout, "timeout", a.timeout, "abort extraction if it takes longer than this `duration`")
+	fs.Var(&a.maxMemory, "max-memory", "keep memory use under this `size` (like 64M), sizing buffers and limiting decompressor windows and -workers; 0 means no limit")
+	fs.IntVar(&a.limits.Entries, "max-entries", a.limits.Entries, "abort if archive has more than `N` entries")
+	fs.Var(&a.maxFile, "max-file-size", "abort if archive has a file larger than `size` (like 100M)")
+	fs.Var(&a.maxTotal, "max-total-size", "abort if files in archive take more than `size` in total (like 10G)")
+	fs.Float64Var(&a.maxRatio, "max-ratio", a.maxRatio, "abort if archive expands more than `N` times on decompression")
+	fs.StringVar(&a.manifest, "manifest", a.manifest, "write SHA-256 digests of extracted files to `file` (- for stdout) once extraction succeeds")
+	fs.StringVar(&a.sumFormat, "manifest-format", a.sumFormat, "`format` of -manifest: sha256sum (default), readable by \"sha256sum -c\", or json")
+	fs.BoolVar(&a.atomic, "atomic", a.atomic, "extract to a temporary directory next to destination and move results into place only if extraction succeeds")
+	fs.BoolVar(&a.rollback, "rollback", a.rollback, "if extraction fails, remove files and directories it created, leaving existing ones in place")
+	fs.BoolVar(&a.checkSpace, "check-space", a.checkSpace, "fail early if destination file system doesn't have space for archive contents; archive files (but not standard input) are read twice for that")
+	fs.IntVar(&a.workers, "workers", a.workers, "write small files with `N` parallel workers, for fast storage")
+	fs.IntVar(&a.checkpoint, "checkpoint", a.checkpoint, "run checkpoint actions every `N` records (10 KiB) of tar stream")
+	fs.Var(&a.cpActions, "checkpoint-action", "`action` to run at each checkpoint: dot, echo[=text] (%u is checkpoint number) or exec=command; can be repeated, default echo")
+	fs.BoolVar(&a.progress, "progress", a.progress, "print progress of reading archive with throughput and estimated time left to stderr")
+	fs.IntVar(&a.progressFD, "progress-fd", a.progressFD, "write progress records as JSON lines to file descriptor `N`")
+	fs.StringVar(&a.wantSum, "expect-sha256", a.wantSum, "fail unless SHA-256 of archive file is `hex`; use with -atomic to leave destination intact on mismatch")
+	fs.StringVar(&a.external, "use-external-decompressor", a.external, "decompress comma-separated `formats` with external commands, like pigz or zstd, instead of built-in code; supports "+strings.Join(externalFormatNames(), ", "))
+	fs.StringVar(&a.identity, "decrypt-with", a.identity, "decrypt archives encrypted with age using identities from `file`; OpenPGP-encrypted archives are decrypted with gpg")
+	fs.StringVar(&a.sigFile, "signature", a.sigFile, "verify archive against detached minisign, signify or OpenPGP signature `file` before extraction; archives read from streams need -atomic")
+	fs.StringVar(&a.pubkey, "pubkey", a.pubkey, "public key `file` for -signature: minisign or signify key, or OpenPGP keyring made with \"gpg --export\" for gpgv")
+	fs.StringVar(&a.postHook, "post-hook", a.postHook, "shell `command` to run after successful extraction, see "+jobEnvPrefix+"* environment variables")
+}
+
+// options converts flags to extraction options
+func (a *mainArgs) options() ([]untar.Option, error) {
+	excludes := a.excludes
+	for _, name := range a.exclFrom {
+		patterns, err := readPatterns(name)
+		if err != nil {
+			return nil, err
+		}
+		excludes = append(excludes, patterns...)
+	}
+	if a.ignore {
+		patterns, err := readPatterns(filepath.Join(a.dst, tarignore))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		excludes = append(excludes, patterns...)
+	}
+	var opts []untar.Option
+	if a.policy != "" {
+		var err error
+		if opts, err = untar.PolicyOptions(a.policy); err != nil {
+			return nil, err
+		}
+	}
+	warn := func(err error) { log.Print("warning: ", err) }
+	switch a.logFormat {
+	case "", "text":
+	case "json":
+		switch {
+		case a.verbose > 0:
+			return nil, errors.New("-v and -vv cannot be used with -log-format=json")
+		case a.list, a.dryRun, a.toStdout, a.verifyOnly, a.diff:
+			return nil, errors.New("-log-format=json cannot be used with -list, -dry-run, -to-stdout, -verify-archive or -diff")
+		}
+		a.events = newEventLog(os.Stdout)
+		warn = a.events.warning
+	default:
+		return nil, fmt.Errorf("unsupported -log-format value %q", a.logFormat)
+	}
+	a.warn = warn
+	opts = append(opts,
+		untar.WithExactPermissions(),
+		untar.WithMatchMode(a.match),
+		untar.WithWarningFunc(warn),
+	)
+	if a.trailing != "" {
+		opts = append(opts, untar.WithTrailingData(untar.TrailingData(a.trailing)))
+	}
+	if a.zeros {
+		opts = append(opts, untar.WithIgnoreZeros())
+	}
+	if a.overwrite != "" {
+		opts = append(opts, untar.WithOverwrite(untar.Overwrite(a.overwrite)))
+	}
+	if workers := a.workers; workers > 1 {
+		if a.maxMemory > 0 {
+			if n := maxWorkers(int64(a.maxMemory)); n < workers {
+				workers = n
+			}
+		}
+		opts = append(opts, untar.WithWorkers(workers))
+	}
+	if a.maxMemory > 0 {
+		opts = append(opts, untar.WithBufferSize(bufferSize(int64(a.maxMemory))))
+		setMemoryLimit(int64(a.maxMemory))
+	}
+	switch {
+	case a.relLinks && a.absLinks:
+		return nil, errors.New("-relative-symlinks and -absolute-symlinks are mutually exclusive")
+	case a.relLinks:
+		opts = append(opts, untar.WithRelativeSymlinks())
+	case a.absLinks:
+		opts = append(opts, untar.WithAbsoluteSymlinks())
+	}
+	if a.verify {
+		opts = append(opts, untar.WithVerify())
+	}
+	if a.strict {
+		opts = append(opts, untar.WithStrict())
+	}
+	if a.xattrs {
+		opts = append(opts, untar.WithXattrs())
+	}
+	if a.selinux {
+		opts = append(opts, untar.WithSELinux())
+	}
+	if a.ntfsPerms {
+		opts = append(opts, untar.WithNTFSPermissions())
+	}
+	if a.unsafe {
+		opts = append(opts, untar.WithUnsafe())
+	}
+	if a.skipSame {
+		opts = append(opts, untar.WithSkipIdentical(a.compare))
+	} else if a.compare && !a.diff {
+		return nil, errors.New("-compare-contents requires -skip-identical or -diff")
+	}
+	if a.idMap.uids != nil || a.idMap.gids != nil {
+		opts = append(opts, untar.WithIDMap(a.idMap.uids, a.idMap.gids))
+	}
+	if a.byName {
+		opts = append(opts, untar.WithOwnerNames())
+	}
+	if a.noOwner {
+		if a.owner != "" || a.group != "" {
+			return nil, errors.New("-no-same-owner cannot be used with -owner or -group")
+		}
+		opts = append(opts, untar.WithoutOwnership())
+	}
+	if a.owner != "" || a.group != "" {
+		uid, gid, err := lookupOwner(a.owner, a.group)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, untar.WithOwner(uid, gid))
+	}
+	if a.bestEff {
+		opts = append(opts, untar.WithBestEffort())
+	}
+	if a.keepGo {
+		opts = append(opts, untar.WithKeepGoing())
+	}
+	a.limits.FileSize, a.limits.TotalSize = int64(a.maxFile), int64(a.maxTotal)
+	if a.limits != (untar.Limits{}) {
+		if a.policy == "strict" {
+			// flags override limits of the preset one by one
+			l := untar.StrictLimits
+			if a.limits.Entries == 0 {
+				a.limits.Entries = l.Entries
+			}
+			if a.limits.FileSize == 0 {
+				a.limits.FileSize = l.FileSize
+			}
+			if a.limits.TotalSize == 0 {
+				a.limits.TotalSize = l.TotalSize
+			}
+		}
+		opts = append(opts, untar.WithLimits(a.limits))
+	}
+	if a.checkSpace {
+		opts = append(opts, untar.WithSpaceCheck(0))
+	}
+	if a.rmPart {
+		opts = append(opts, untar.WithRemovePartial())
+	}
+	if a.rollback {
+		opts = append(opts, untar.WithRollback())
+	}
+	if a.identity != "" {
+		if err := loadIdentities(a.identity); err != nil {
+			return nil, err
+		}
+	}
+	if a.external != "" {
+		if err := useExternal(a.external); err != nil {
+			return nil, err
+		}
+	}
+	if a.keepDirs {
+		opts = append(opts, untar.WithKeepDirectorySymlink())
+	}
+	// options below select entries or only make sense for archives named on
+	// the command line, not for archives nested inside them
+	a.nestedOpts = opts[:len(opts):len(opts)]
+	if a.baseline != "" {
+		opts = append(opts, untar.WithBaseline(a.baseline))
+	}
+	switch {
+	case a.ociLayer && a.overlay:
+		return nil, errors.New("-oci-layer and -overlay-whiteouts are mutually exclusive")
+	case a.ociLayer:
+		opts = append(opts, untar.WithWhiteouts())
+	case a.overlay:
+		opts = append(opts, untar.WithOverlayWhiteouts())
+	}
+	if len(a.includes) != 0 {
+		opts = append(opts, untar.WithInclude(a.includes...))
+	}
+	if len(excludes) != 0 {
+		opts = append(opts, untar.WithExclude(excludes...))
+	}
+	if a.subdir != "" {
+		opts = append(opts, untar.WithSubdir(a.subdir))
+	}
+	if a.exclVCS {
+		opts = append(opts, untar.WithExcludeVCS())
+	}
+	if a.exclBak {
+		opts = append(opts, untar.WithExcludeBackups())
+	}
+	if !a.newer.IsZero() || !a.older.IsZero() {
+		newer, older := a.newer.Time, a.older.Time
+		opts = append(opts, untar.WithFilter(func(hdr *tar.Header) bool {
+			if !newer.IsZero() && !hdr.ModTime.After(newer) {
+				return false
+			}
+			return older.IsZero() || hdr.ModTime.Before(older)
+		}))
+	}
+	if len(a.members) != 0 {
+		opts = append(opts, untar.WithMembers(a.members...))
+	}
+	if a.occurrence > 0 {
+		if len(a.members) == 0 {
+			return nil, errors.New("-occurrence requires member names to extract")
+		}
+		opts = append(opts, untar.WithOccurrence(int(a.occurrence)))
+	}
+	if a.strip < 0 {
+		return nil, errors.New("-strip-components cannot be negative")
+	}
+	if a.strip > 0 {
+		opts = append(opts, untar.WithStripComponents(a.strip))
+	}
+	if len(a.xforms) != 0 {
+		opts = append(opts, untar.WithTransform(a.xforms...))
+	}
+	switch a.stripTop {
+	case "":
+	case "auto":
+		if a.subdir != "" {
+			return nil, errors.New("-strip-top-level cannot be used with -subdir")
+		}
+		if a.strip != 0 {
+			return nil, errors.New("-strip-top-level cannot be used with -strip-components")
+		}
+		top, err := topLevelDir(a.filename)
+		if err != nil {
+			return nil, err
+		}
+		if top != "" {
+			opts = append(opts, untar.WithStripComponents(1))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported -strip-top-level value %q, only \"auto\" is supported", a.stripTop)
+	}
+	return opts, nil
+}
+
+func run(a *mainArgs) error {
+	if len(a.archives) > 1 {
+		switch {
+		case a.image != "" || a.platform != "":
+			return errors.New("-image and -platform cannot be used with multiple archives")
+		case a.goModule != "":
+			return errors.New("-go-module cannot be used with multiple archives")
+		case a.stripTop != "":
+			return errors.New("-strip-top-level cannot be used with multiple archives")
+		case len(a.members) != 0:
+			return errors.New("member names cannot be given with multiple archives, use -include instead")
+		}
+	}
+	if a.atomic {
+		switch {
+		case a.image != "" || a.platform != "":
+			return errors.New("-atomic cannot be used with -image and -platform")
+		case a.goModule != "":
+			return errors.New("-atomic cannot be used with -go-module")
+		case a.auditLog != "":
+			return errors.New("-atomic cannot be used with -audit-log")
+		case a.postHook != "":
+			return errors.New("-atomic cannot be used with -post-hook")
+		}
+	}
+	if a.manifest != "" {
+		switch {
+		case a.image != "" || a.platform != "":
+			return errors.New("-manifest cannot be used with -image and -platform")
+		case a.goModule != "":
+			return errors.New("-manifest cannot be used with -go-module")
+		case a.list, a.toStdout, a.dryRun, a.verifyOnly, a.diff:
+			return errors.New("-manifest cannot be used with -list, -to-stdout, -dry-run, -verify-archive or -diff")
+		}
+	}
+	if a.wantSum != "" {
+		if b, err := hex.DecodeString(a.wantSum); err != nil || len(b) != sha256.Size {
+			return fmt.Errorf("invalid -expect-sha256 value %q", a.wantSum)
+		}
+		switch {
+		case len(a.archives) > 1:
+			return errors.New("-expect-sha256 cannot be used with multiple archives")
+		case a.image != "" || a.platform != "":
+			return errors.New("-expect-sha256 cannot be used with -image and -platform")
+		case a.goModule != "":
+			return errors.New("-expect-sha256 cannot be used with -go-module")
+		case a.list, a.toStdout, a.dryRun, a.diff:
+			return errors.New("-expect-sha256 cannot be used with -list, -to-stdout, -dry-run or -diff")
+		}
+	}
+	if a.sigFile != "" || a.pubkey != "" {
+		switch {
+		case a.sigFile == "" || a.pubkey == "":
+			return errors.New("-signature and -pubkey must be used together")
+		case len(a.archives) > 1:
+			return errors.New("-signature cannot be used with multiple archives")
+		case a.image != "" || a.platform != "":
+			return errors.New("-signature cannot be used with -image and -platform")
+		case a.goModule != "":
+			return errors.New("-signature cannot be used with -go-module")
+		case a.list, a.toStdout, a.dryRun, a.verifyOnly, a.diff:
+			return errors.New("-signature cannot be used with -list, -to-stdout, -dry-run, -verify-archive or -diff")
+		case !a.atomic && !isLocalFile(a.filename) && a.preHook == "":
+			// stream can only be checked once it's extracted, unless
+			// it is copied to a file for -pre-hook
+			return errors.New("-signature requires -atomic when archive is not a local file")
+		}
+	}
+	switch a.sumFormat {
+	case "", "sha256sum", "json":
+	default:
+		return fmt.Errorf("unsupported -manifest-format value %q", a.sumFormat)
+	}
+	if a.filename == stdinName {
+		switch {
+		case a.stripTop != "":
+			return errors.New("-strip-top-level cannot be used when reading archive from standard input")
+		case a.goModule != "":
+			return errors.New("-go-module cannot be used when reading archive from standard input")
+		}
+	}
+	if a.userns {
+		if ok, err := enterUserns(); !ok {
+			return err
+		}
+	}
+	if a.maxMemory > 0 {
+		debug.SetMemoryLimit(int64(a.maxMemory))
+	}
+	opts, err := a.options()
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	rd = f
-	if strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".tgz") {
-		gr, err := gzip.NewReader(f)
+	if a.goModule != "" {
+		return unzipModule(a)
+	}
+	if a.auditLog != "" && !a.dryRun {
+		f, err := os.OpenFile(a.auditLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		opts = append(opts, untar.WithAuditLog(f))
+		if a.backupDir != "" {
+			opts = append(opts, untar.WithAuditBackups(a.backupDir))
+		}
+	}
+	if a.image != "" || a.platform != "" {
+		var stats untar.Stats
+		opts = append(opts, untar.WithStats(&stats))
+		if a.events != nil {
+			opts = append(opts, untar.WithEntryFunc(a.events.entry))
+		}
+		ctx, cancel := a.context()
+		defer cancel()
+		err := extractImage(ctx, a, opts...)
+		if a.events != nil {
+			a.events.summary(&stats, err)
+		}
+		if err != nil {
+			return a.extractError(ctx, err, &stats)
+		}
+		if a.summary {
+			return printSummary(os.Stderr, &stats)
+		}
+		return nil
+	}
+	if a.list || a.toStdout || a.dryRun || a.verifyOnly || a.diff {
+		var differ int
+		for _, name := range a.archiveNames() {
+			var err error
+			switch {
+			case a.list:
+				err = listArchive(name, os.Stdout, opts...)
+			case a.toStdout:
+				err = catArchive(name, os.Stdout, opts...)
+			case a.verifyOnly:
+				err = verifyArchive(name, a.wantSum, opts...)
+			case a.diff:
+				var n int
+				n, err = diffArchive(name, a.dst, os.Stdout, a.compare, opts...)
+				differ += n
+			default:
+				err = dryRun(name, a.dst, os.Stdout, opts...)
+			}
+			if err != nil {
+				return a.archiveError(name, err)
+			}
+		}
+		if differ != 0 {
+			return fmt.Errorf("%d entries differ", differ)
+		}
+		return nil
+	}
+	if a.snapshot {
+		if _, err := os.Stat(a.dst); err == nil {
+			rollback, err := snapshot(a.dst)
+			if err != nil {
+				return err
+			}
+			log.Print("snapshot taken, to roll back run: ", rollback)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	dst := a.dst
+	var stage *staging
+	if a.atomic {
+		if stage, err = newStaging(a.dst); err != nil {
+			return err
+		}
+		defer stage.remove()
+		dst = stage.dir
+	}
+	var stats untar.Stats
+	shared := len(opts)
+	opts = append(opts, untar.WithStats(&stats))
+	if a.verbose > 0 {
+		opts = append(opts, untar.WithEntryFunc(newVerbosePrinter(os.Stdout, a.verbose).entry))
+	}
+	if a.events != nil {
+		opts = append(opts, untar.WithEntryFunc(a.events.entry))
+	}
+	var progress *progressWriter
+	if a.progressFD > 0 {
+		progress = newProgressWriter(os.NewFile(uintptr(a.progressFD), "progress"), &stats)
+		opts = append(opts, untar.WithEntryFunc(progress.entry))
+	}
+	notifier := newSystemdNotifier(&stats)
+	if notifier != nil {
+		opts = append(opts, untar.WithEntryFunc(notifier.entry))
+	}
+	var files *manifest
+	if a.manifest != "" {
+		files = &manifest{root: dst}
+		opts = append(opts, untar.WithDigests(), untar.WithEntryFunc(files.entry))
+	}
+	a.nestedOpts = append(a.nestedOpts, opts[shared:]...)
+	ctx, cancel := a.context()
+	defer cancel()
+	for _, name := range a.archiveNames() {
+		if err = a.extractArchive(ctx, name, dst, &stats, progress, notifier, opts...); err != nil {
+			err = a.archiveError(name, err)
+			break
+		}
+	}
+	if err == nil && stage != nil {
+		err = stage.commit(a.dst, a.keepDirs)
+	}
+	if err == nil && files != nil {
+		err = files.write(a.manifest, a.sumFormat)
+	}
+	if a.events != nil {
+		a.events.summary(&stats, err)
+	}
+	if notifier != nil {
+		notifier.done(err)
+	}
+	if err != nil {
+		return a.extractError(ctx, err, &stats)
+	}
+	if progress != nil {
+		progress.finish()
+	}
+	if a.summary {
+		return printSummary(os.Stderr, &stats)
+	}
+	return nil
+}
+
+// archiveNames returns names of archives to extract
+func (a *mainArgs) archiveNames() []string {
+	if len(a.archives) > 1 {
+		return a.archives
+	}
+	return []string{a.filename}
+}
+
+// archiveError prefixes err with archive name if there are several of them
+func (a *mainArgs) archiveError(name string, err error) error {
+	if len(a.archives) > 1 {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return err
+}
+
+// extractArchive extracts a single named archive to dst, adding to stats.
+// Progress and notifier, if not nil, are switched to this archive for its
+// duration.
+func (a *mainArgs) extractArchive(ctx context.Context, name, dst string, stats *untar.Stats, progress *progressWriter, notifier *systemdNotifier, opts ...untar.Option) error {
+	src := name // file archive is read from
+	if a.preHook != "" && !isLocalFile(name) {
+		// hook must vet the same data that is extracted, which
+		// streams and remote sources can't provide twice
+		var err error
+		if src, err = spoolArchive(ctx, name); err != nil {
+			return err
+		}
+		defer os.Remove(src)
+	}
+	if a.checkSpace && src != stdinName {
+		need, err := filesSize(src, opts...)
 		if err != nil {
 			return err
 		}
-		defer gr.Close()
-		rd = gr
-	} else if strings.HasSuffix(name, ".bz2") {
-		rd = bzip2.NewReader(f)
+		opts = append(opts, untar.WithSpaceCheck(need))
+	}
+	var sig verifier
+	if a.sigFile != "" {
+		var err error
+		if sig, err = newVerifier(a.sigFile, a.pubkey); err != nil {
+			return err
+		}
+		if isLocalFile(src) {
+			if err := verifyFile(sig, src); err != nil {
+				return err
+			}
+			sig = nil
+		}
+	}
+	if a.preHook != "" {
+		if err := runPreHook(a.preHook, name, src, a.dst); err != nil {
+			return err
+		}
+	}
+	var digest hash.Hash
+	if a.postHook != "" || a.wantSum != "" {
+		digest = sha256.New()
 	}
+	var tee io.Writer // receives raw archive data
+	switch {
+	case digest != nil && sig != nil:
+		tee = io.MultiWriter(digest, sig)
+	case digest != nil:
+		tee = digest
+	case sig != nil:
+		tee = sig
+	}
+	rd, err := openArchive(src, tee)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+	if a.maxRatio > 0 {
+		rd.Reader = &ratioReader{r: rd.Reader, consumed: rd.consumed, ratio: a.maxRatio}
+	}
+	if progress != nil {
+		progress.rd = rd
+	}
+	if notifier != nil {
+		notifier.setArchive(rd)
+	}
+	var printer *progressPrinter
+	if a.progress {
+		printer = newProgressPrinter(os.Stderr, rd)
+		opts = append(opts, untar.WithProgress(printer.progress))
+	}
+	// unblock reads stuck on stalled sources
+	stop := context.AfterFunc(ctx, func() { rd.Close() })
+	defer stop()
+	var checkpoints *checkpointer
+	if a.checkpoint > 0 {
+		if checkpoints, err = newCheckpointer(rd, a.checkpoint, a.cpActions); err != nil {
+			return err
+		}
+		opts = append(opts, untar.WithEntryFunc(checkpoints.entry))
+	}
+	var nested *nestedArchives
+	if a.recursive {
+		nested = &nestedArchives{maxSize: int64(a.recMaxSize), warn: a.warn}
+		opts = append(opts, untar.WithEntryFunc(nested.entry))
+	}
+	before := *stats
+	err = extract(ctx, rd, dst, tee != nil, opts...)
+	if printer != nil {
+		printer.finish()
+	}
+	if checkpoints != nil {
+		checkpoints.finish()
+	}
+	if err != nil {
+		return err
+	}
+	if sig != nil {
+		if err := sig.verify(); err != nil {
+			return err
+		}
+	}
+	if err := checkDigest(digest, a.wantSum); err != nil {
+		return err
+	}
+	if nested != nil {
+		if err := a.extractNested(ctx, nested, 1); err != nil {
+			return err
+		}
+	}
+	if a.postHook != "" {
+		env := []string{
+			jobEnvPrefix + "ARCHIVE=" + name,
+			jobEnvPrefix + "DEST=" + a.dst,
+			jobEnvPrefix + "ENTRIES=" + strconv.Itoa(stats.Entries-before.Entries),
+			jobEnvPrefix + "BYTES=" + strconv.FormatInt(stats.Bytes-before.Bytes, 10),
+			jobEnvPrefix + "SHA256=" + hex.EncodeToString(digest.Sum(nil)),
+		}
+		if err := runHook(a.postHook, env, nil); err != nil {
+			return fmt.Errorf("post-hook: %w", err)
+		}
+	}
+	return nil
+}
+
+// context returns context of extraction, cancelled on SIGINT or SIGTERM and
+// once -timeout expires. After the first signal, the next one terminates the
+// process.
+func (a *mainArgs) context() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+	if a.timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	return ctx, func() { cancel(); stop() }
+}
+
+// extractError returns error of extraction cancelled by ctx, printing summary
+// of what was done if it was interrupted by signal
+func (a *mainArgs) extractError(ctx context.Context, err error, stats *untar.Stats) error {
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return fmt.Errorf("extraction timed out after %v", a.timeout)
+	case ctx.Err() != nil:
+		log.Printf("interrupted after extracting %d entries", stats.Entries)
+		if perr := printSummary(os.Stderr, stats); perr != nil {
+			return perr
+		}
+		return errors.New("extraction interrupted")
+	}
+	return err
+}
+
+// unzipModule extracts Go module zip selected with -go-module flag
+func unzipModule(a *mainArgs) error {
+	if a.dryRun {
+		return errors.New("-dry-run cannot be used with -go-module")
+	}
+	var path, version string
+	if a.goModule != "auto" {
+		i := strings.LastIndexByte(a.goModule, '@')
+		if i < 0 {
+			return fmt.Errorf("invalid -go-module value %q, want path@version or auto", a.goModule)
+		}
+		path, version = a.goModule[:i], a.goModule[i+1:]
+	}
+	return untar.UnzipModule(a.filename, a.dst, path, version)
+}
+
+// lookupOwner resolves user and group given as names or numeric ids; empty
+// ones are returned as -1
+func lookupOwner(owner, group string) (uid, gid int, err error) {
+	uid, gid = -1, -1
+	if owner != "" {
+		if uid, err = strconv.Atoi(owner); err != nil {
+			u, err := user.Lookup(owner)
+			if err != nil {
+				return 0, 0, err
+			}
+			if uid, err = strconv.Atoi(u.Uid); err != nil {
+				return 0, 0, fmt.Errorf("user %s has non-numeric id %s", owner, u.Uid)
+			}
+		}
+	}
+	if group != "" {
+		if gid, err = strconv.Atoi(group); err != nil {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return 0, 0, err
+			}
+			if gid, err = strconv.Atoi(g.Gid); err != nil {
+				return 0, 0, fmt.Errorf("group %s has non-numeric id %s", group, g.Gid)
+			}
+		}
+	}
+	return uid, gid, nil
+}
+
+// bufferSize picks copy buffer size for a given memory limit: buffer takes
+// 1/16th of the limit, but no more than default and no less than 32 KiB.
+func bufferSize(limit int64) int {
+	return int(clamp(limit/16, 32<<10, 512<<10))
+}
+
+// Besides copy buffer (see bufferSize), memory limit set with -max-memory is
+// shared by readahead buffers taking 1/8th of it, decompressor window taking
+// 1/4th, and files buffered by -workers taking another 1/4th. The rest is
+// left to the runtime.
+
+// decoderMemory limits memory decompressors may use for their windows, set
+// by -max-memory; 0 means no limit
+var decoderMemory int64
+
+// setMemoryLimit sizes readahead buffers and decompressor windows for
+// a given memory limit, see untar.WithDecoderMemory
+func setMemoryLimit(limit int64) {
+	decoderMemory = limit / 4
+}
+
+// maxWorkers returns number of -workers fitting into a given memory limit,
+// each worker holding up to two files of up to 1 MiB
+func maxWorkers(limit int64) int {
+	return int(limit / 4 / (2 << 20))
+}
+
+func clamp(n, lo, hi int64) int64 {
+	switch {
+	case n < lo:
+		return lo
+	case n > hi:
+		return hi
+	}
+	return n
+}
+
+// tarignore is the name of file in destination directory listing patterns of
+// entries to skip
+const tarignore = ".tarignore"
+
+func readPatterns(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return untar.ReadPatterns(f)
+}
+
+// topLevelDir reads archive to find a directory holding all its entries
+func topLevelDir(name string) (string, error) {
+	rd, err := openArchive(name, nil)
+	if err != nil {
+		return "", err
+	}
+	defer rd.Close()
+	return untar.TopLevelDir(rd)
+}
+
+// filesSize reads archive to find the total size of regular files selected
+// by opts
+func filesSize(name string, opts ...untar.Option) (int64, error) {
+	rd, err := openArchive(name, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer rd.Close()
+	var size int64
+	it := untar.NewIterator(rd, opts...)
+	for it.Next() {
+		if hdr := it.Header(); hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA {
+			size += hdr.Size
+		}
+	}
+	return size, it.Err()
+}
+
+// subcommand is a mode of operation selected by the first command line
+// argument; without one, archive is extracted.
+type subcommand struct {
+	usage string                    // one line description
+	flags *flag.FlagSet             // flags accepted by subcommand
+	args  []string                  // fixed choices of positional arguments, if any
+	files bool                      // whether positional arguments are archives
+	run   func(args []string) error // called with arguments left after flags
+}
+
+func (c *subcommand) main(args []string) error {
+	if err := flagsFromEnv(c.flags); err != nil {
+		return err
+	}
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+	return c.run(c.flags.Args())
+}
+
+// subcommands is populated in init as some subcommands need to refer to it
+var subcommands map[string]*subcommand
+
+func init() {
+	subcommands = map[string]*subcommand{
+		"completion": {
+			usage: "print shell completion script",
+			flags: flag.NewFlagSet("completion", flag.ExitOnError),
+			args:  []string{"bash", "zsh", "fish"},
+			run:   runCompletion,
+		},
+		"self-update": {
+			usage: "replace this executable with the latest release",
+			flags: selfUpdateFlags(),
+			run:   runSelfUpdate,
+		},
+		"browse": {
+			usage: "interactively browse archive and extract selected entries",
+			flags: browseFlags(),
+			files: true,
+			run:   runBrowse,
+		},
+		"undo": {
+			usage: "revert changes recorded in audit log of previous extraction",
+			flags: undoFlags(),
+			run:   runUndo,
+		},
+		"serve": {
+			usage: "serve archive contents over HTTP",
+			flags: serveFlags(),
+			files: true,
+			run:   runServe,
+		},
+	}
+	if mountSubcommand != nil {
+		subcommands["mount"] = mountSubcommand
+	}
+}
+
+// isArchiveArg reports whether positional argument names archive to extract
+// rather than a member: it is either "-", URL, or an existing file with one
+// of archiveExtensions
+func isArchiveArg(name string) bool {
+	if name == stdinName || strings.Contains(name, "://") {
+		return true
+	}
+	for _, ext := range append(archiveExtensions, untar.Decompressors()...) {
+		if strings.HasSuffix(name, ext) {
+			fi, err := os.Stat(name)
+			return err == nil && fi.Mode().IsRegular()
+		}
+	}
+	return false
+}
+
+// isLocalFile reports whether archive is a regular file that can be read
+// more than once
+func isLocalFile(name string) bool {
+	if name == stdinName || strings.Contains(name, "://") {
+		return false
+	}
+	fi, err := os.Stat(name)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// archiveExtensions lists file name suffixes of archives this tool handles
+var archiveExtensions = []string{".tar", ".tgz", ".gz", ".bz2", ".tbz2", ".tbz", ".zst", ".tzst", ".xz", ".txz", ".apk", ".zip", ".age", ".gpg", ".cpio", ".deb", ".lz4", ".lz", ".lzo", ".lzma", ".br"}
+
+// envPrefix is the prefix of environment variables providing values for
+// command line flags: flag "to" can be set with UNTAR_TO, flag "some-flag"
+// with UNTAR_SOME_FLAG. Single-letter flags, like -C or -t, have no variables,
+// so that generic names like UNTAR_C are left alone. Values given on the
+// command line take precedence. Variables setting the same flag, like
+// UNTAR_TO and UNTAR_DEST, or UNTAR_POLICY and true UNTAR_SAFE_MODE, can't be
+// used together.
+const envPrefix = "UNTAR_"
+
+// envAliases maps environment variable names (without prefix) that don't
+// follow flag names to flags they set.
+var envAliases = map[string]string{
+	"DEST": "to",
+	"JOBS": "workers",
+}
+
+// envSafeMode is environment variable name (without prefix) which, set to
+// true value, applies "strict" policy, see -policy. False value keeps the
+// defaults.
+const envSafeMode = "SAFE_MODE"
+
+// flagsFromEnv sets flags of fs from UNTAR_* environment variables. It must be
+// called before fs.Parse so that command line arguments override environment.
+func flagsFromEnv(fs *flag.FlagSet) error {
+	setBy := make(map[string]string) // flag name to variable that set it
+	apply := func(key, name, value string) error {
+		f := fs.Lookup(name)
+		if f == nil {
+			return nil
+		}
+		// flags like -incremental are synonyms of other flags
+		if s, ok := strings.CutPrefix(f.Usage, "same as -"); ok {
+			name = s
+		}
+		if prev, ok := setBy[name]; ok {
+			return fmt.Errorf("%s%s and %s%s both set -%s, use only one of them", envPrefix, prev, envPrefix, key, name)
+		}
+		setBy[name] = key
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s%s: %v", envPrefix, key, err)
+		}
+		return nil
+	}
+	set := func(key, name string) error {
+		if v, ok := os.LookupEnv(envPrefix + key); ok {
+			return apply(key, name, v)
+		}
+		return nil
+	}
+	for key, name := range envAliases {
+		if err := set(key, name); err != nil {
+			return err
+		}
+	}
+	if v, ok := os.LookupEnv(envPrefix + envSafeMode); ok {
+		on, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%s%s: %v", envPrefix, envSafeMode, err)
+		}
+		if on {
+			if err := apply(envSafeMode, "policy", "strict"); err != nil {
+				return err
+			}
+		}
+	}
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err == nil && len(f.Name) > 1 {
+			err = set(strings.ToUpper(strings.Replace(f.Name, "-", "_", -1)), f.Name)
+		}
+	})
+	return err
+}
+
+// openAndUntar extracts named archive to dst. If digest is not nil, the whole
+// archive file is written to it.
+func openAndUntar(name, dst string, digest hash.Hash, opts ...untar.Option) error {
+	rd, err := openArchive(name, digest)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+	return extract(context.Background(), rd, dst, digest != nil, opts...)
+}
+
+// extract unpacks archive to dst; if drain is true, the rest of archive file
+// is read after tar stream end. If dst is created and extraction fails, it is
+// removed unless something is left in it.
+func extract(ctx context.Context, rd *archiveReader, dst string, drain bool, opts ...untar.Option) error {
+	_, err := os.Stat(dst)
+	created := os.IsNotExist(err)
 	if err := os.MkdirAll(dst, os.ModeDir|os.ModePerm); err != nil {
 		return err
 	}
-	// resetting umask is essential to have exact permissions on unpacked
-	// files; it's not not put inside untar function as it changes
-	// process-wide umask
-	mask := syscall.Umask(0)
-	defer syscall.Umask(mask)
-	return untar.Untar(rd, dst)
+	if err := untar.UntarContext(ctx, rd, dst, opts...); err != nil {
+		if created {
+			os.Remove(dst)
+		}
+		return err
+	}
+	if drain {
+		return rd.drain()
+	}
+	return nil
+}
+
+// checkDigest compares digest of archive data with expected hex-encoded
+// value, if it's not empty
+func checkDigest(digest hash.Hash, want string) error {
+	if want == "" {
+		return nil
+	}
+	if got := hex.EncodeToString(digest.Sum(nil)); !strings.EqualFold(got, want) {
+		return fmt.Errorf("archive SHA-256 is %s, want %s", got, want)
+	}
+	return nil
+}
+
+// openArchive opens named archive, which may be URL of any source registered
+// with untar.RegisterSource or handled by source helper, returning reader of
+// uncompressed tar stream; closing it closes underlying file. If digest is not
+// nil, archive file data is written to it as it's read.
+func openArchive(name string, digest io.Writer) (*archiveReader, error) {
+	var f io.ReadCloser = os.Stdin
+	if name != stdinName {
+		registerSourceHelper(name)
+		var err error
+		if f, err = untar.OpenSource(context.Background(), name); err != nil {
+			return nil, err
+		}
+	}
+	rd := &archiveReader{closers: []io.Closer{f}}
+	if f, ok := f.(interface{ Stat() (os.FileInfo, error) }); ok {
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+			rd.size = fi.Size()
+		}
+	}
+	rd.raw = &countingReader{r: f, n: &rd.read}
+	rd.Reader = rd.raw
+	if digest != nil {
+		rd.raw = io.TeeReader(rd.raw, digest)
+		rd.Reader = rd.raw
+	}
+	// decryption and external decompressors depend on flags, the rest of
+	// format detection is done by untar.NewReader; Alpine packages are
+	// gzip streams that only it knows how to read
+	if strings.HasSuffix(name, ".apk") {
+		tr, err := untar.NewReader(rd.raw, name)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		rd.Reader = tr
+		rd.closers = append(rd.closers, tr)
+		return rd, nil
+	}
+	br := bufio.NewReader(rd.raw)
+	rd.raw = br
+	plain, closer, err := decrypt(br)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if plain != nil {
+		if closer != nil {
+			rd.closers = append(rd.closers, closer)
+		}
+		// drain reads decrypted data, so that its integrity is
+		// checked to the end
+		br = bufio.NewReader(plain)
+		rd.raw = br
+	}
+	var r io.Reader = br
+	if cr, err := decompressExternal(br, name); err != nil {
+		rd.Close()
+		return nil, err
+	} else if cr != nil {
+		rd.closers = append(rd.closers, cr)
+		// so that decompressors registered for extension are not
+		// applied again
+		r, name = cr, ""
+	}
+	tr, err := untar.NewReader(r, name, untar.WithDecoderMemory(decoderMemory))
+	if errors.Is(err, untar.ErrUnknownFormat) && plain == nil && r == br && pgpEncrypted(br) {
+		var d *commandReader
+		if d, err = decryptPGP(br); err == nil {
+			rd.closers = append(rd.closers, d)
+			br = bufio.NewReader(d)
+			rd.raw = br
+			tr, err = untar.NewReader(br, name, untar.WithDecoderMemory(decoderMemory))
+		}
+	}
+	if err != nil {
+		rd.Close()
+		return nil, err
+	}
+	rd.Reader = tr
+	rd.closers = append(rd.closers, tr)
+	return rd, nil
+}
+
+// stdinName is archive name standing for standard input
+const stdinName = "-"
+
+// magic bytes of compressed streams
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+// compressed reports whether data starting with magic is compressed with one
+// of supported formats
+func compressed(magic []byte) bool {
+	for _, m := range [][]byte{gzipMagic, bzip2Magic, zstdMagic, xzMagic} {
+		if bytes.HasPrefix(magic, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveReader reads from possibly layered readers, closing all of them on
+// Close
+type archiveReader struct {
+	io.Reader
+	raw     io.Reader // archive file, before decompression
+	closers []io.Closer
+	size    int64 // archive file size, 0 if unknown
+	read    int64 // bytes read from archive file, accessed atomically
+}
+
+// consumed returns number of bytes read from archive file so far
+func (a *archiveReader) consumed() int64 { return atomic.LoadInt64(&a.read) }
+
+// countingReader counts bytes read from underlying reader
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
+
+// drain reads the rest of archive file, so that its digest covers the whole
+// file, including any data past the end of tar stream
+func (a *archiveReader) drain() error {
+	if _, err := io.Copy(io.Discard, a.Reader); err != nil {
+		return err
+	}
+	_, err := io.Copy(io.Discard, a.raw)
+	return err
+}
+
+func (a *archiveReader) Close() error {
+	var err error
+	for i := len(a.closers) - 1; i >= 0; i-- {
+		if err2 := a.closers[i].Close(); err2 != nil && err == nil {
+			err = err2
+		}
+	}
+	return err
 }
@@ -0,0 +1,154 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// usernsStage is the environment variable telling re-executed process which
+// stage of entering user namespace it is at
+const usernsStage = "UNTAR_USERNS_STAGE"
+
+// idRange is a range of subordinate ids from /etc/subuid or /etc/subgid
+type idRange struct{ start, count int }
+
+// enterUserns re-executes this program inside a new user namespace where
+// current user is root and subordinate ids of the user (if any) are mapped to
+// ids starting from 1. It returns true if the caller is already inside the
+// namespace and should proceed; otherwise it waits for re-executed process
+// and exits with its status.
+func enterUserns() (bool, error) {
+	switch os.Getenv(usernsStage) {
+	case "ready":
+		return true, nil
+	case "wait":
+		// ids are mapped now, but capabilities were dropped on execve done
+		// before mapping: exec again as namespace root to regain them
+		buf := make([]byte, 1)
+		if _, err := os.NewFile(3, "sync").Read(buf); err != nil {
+			return false, fmt.Errorf("waiting for id mapping: %w", err)
+		}
+		os.Setenv(usernsStage, "ready")
+		return false, syscall.Exec("/proc/self/exe", os.Args, os.Environ())
+	}
+	u, err := user.Current()
+	if err != nil {
+		return false, err
+	}
+	uid, gid := os.Getuid(), os.Getgid()
+	subuid, err := subIDs("/etc/subuid", u.Username, uid)
+	if err != nil {
+		return false, err
+	}
+	subgid, err := subIDs("/etc/subgid", u.Username, uid)
+	if err != nil {
+		return false, err
+	}
+	cmd := exec.Command("/proc/self/exe", os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWUSER}
+	var sync *os.File
+	if subuid == nil || subgid == nil {
+		// without subordinate ids only own ids can be mapped, which
+		// doesn't need helpers and is done by os/exec before execve
+		cmd.Env = append(os.Environ(), usernsStage+"=ready")
+		cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: uid, Size: 1}}
+		cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: gid, Size: 1}}
+	} else {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return false, err
+		}
+		defer r.Close()
+		sync = w
+		cmd.Env = append(os.Environ(), usernsStage+"=wait")
+		cmd.ExtraFiles = []*os.File{r}
+	}
+	if err := cmd.Start(); err != nil {
+		if sync != nil {
+			sync.Close()
+		}
+		return false, fmt.Errorf("starting process in user namespace: %w", err)
+	}
+	if sync != nil {
+		err := mapIDs(cmd.Process.Pid, uid, gid, subuid, subgid)
+		if err == nil {
+			_, err = sync.Write([]byte{0})
+		}
+		sync.Close()
+		if err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return false, err
+		}
+	}
+	err = cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		return false, err
+	}
+	os.Exit(0)
+	return false, nil
+}
+
+// mapIDs maps ids of user namespace of process pid with newuidmap and
+// newgidmap setuid helpers
+func mapIDs(pid, uid, gid int, subuid, subgid *idRange) error {
+	for _, m := range []struct {
+		helper string
+		id     int
+		sub    *idRange
+	}{
+		{"newuidmap", uid, subuid},
+		{"newgidmap", gid, subgid},
+	} {
+		args := []string{strconv.Itoa(pid),
+			"0", strconv.Itoa(m.id), "1",
+			"1", strconv.Itoa(m.sub.start), strconv.Itoa(m.sub.count),
+		}
+		if out, err := exec.Command(m.helper, args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %w: %s", m.helper, err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// subIDs returns the first range of subordinate ids of user with given name
+// or uid from file, nil if there are none
+func subIDs(file, name string, uid int) (*idRange, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Split(strings.TrimSpace(sc.Text()), ":")
+		if len(fields) != 3 || (fields[0] != name && fields[0] != strconv.Itoa(uid)) {
+			continue
+		}
+		start, err1 := strconv.Atoi(fields[1])
+		count, err2 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil || count <= 0 {
+			return nil, fmt.Errorf("%s: malformed line %q", file, sc.Text())
+		}
+		return &idRange{start: start, count: count}, nil
+	}
+	return nil, sc.Err()
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+func enterUserns() (bool, error) {
+	return false, errors.New("user namespaces are only supported on Linux")
+}
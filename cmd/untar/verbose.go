@@ -0,0 +1,34 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+
+	"github.com/artyom/untar"
+)
+
+// verbosePrinter prints extracted entries, see -v and -vv flags
+type verbosePrinter struct {
+	w      io.Writer
+	level  int
+	lister *lister // used on level 2
+}
+
+func newVerbosePrinter(w io.Writer, level int) *verbosePrinter {
+	return &verbosePrinter{w: w, level: level, lister: newLister(w)}
+}
+
+func (v *verbosePrinter) entry(e untar.Entry) {
+	// write errors are ignored, like those of progress output: they must
+	// not break extraction
+	hdr := e.Header
+	switch {
+	case v.level > 1:
+		_ = v.lister.entry(hdr)
+	case hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA:
+		fmt.Fprintf(v.w, "%s\t%s\t%s\n", hdr.Name, typeName(hdr.Typeflag), formatSize(hdr.Size))
+	default:
+		fmt.Fprintf(v.w, "%s\t%s\n", hdr.Name, typeName(hdr.Typeflag))
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/artyom/untar"
+)
+
+// verifyArchive reads the whole archive without extracting anything, so that
+// corruption is detected: tar headers are checked for valid checksums, bodies
+// of entries are read in full and decompression reaches the end of stream,
+// which verifies checksums of formats that have them, like gzip CRC. If sum
+// is not empty, SHA-256 of archive file is checked against it.
+func verifyArchive(archive, sum string, opts ...untar.Option) error {
+	var digest hash.Hash
+	if sum != "" {
+		digest = sha256.New()
+	}
+	rd, err := openArchive(archive, digest)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+	it := untar.NewIterator(rd, opts...)
+	for it.Next() {
+		if _, err := io.Copy(io.Discard, it.Reader()); err != nil {
+			return fmt.Errorf("%s: %w", it.Header().Name, err)
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	if err := rd.drain(); err != nil {
+		return err
+	}
+	return checkDigest(digest, sum)
+}
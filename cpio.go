@@ -0,0 +1,233 @@
+package untar
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// CPIOTar reads cpio archive of "newc" format (the one of Linux initramfs
+// images and RPM payloads) from r and returns reader of equivalent tar
+// stream, which can be passed to Untar, so that cpio archives are extracted
+// with the same checks and metadata handling. Hard linked files, which cpio
+// stores with data in the last link only, become tar hard links to the file
+// holding data. Sockets are skipped. Closing returned reader stops the
+// conversion.
+func CPIOTar(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() { pw.CloseWithError(cpioToTar(pw, r)) }()
+	return pr
+}
+
+const (
+	cpioHeaderSize = 110
+	cpioMaxName    = 4096 // limit on names and symlink targets
+)
+
+// cpioLink identifies hard linked file
+type cpioLink struct {
+	devmajor, devminor, ino int64
+}
+
+func cpioToTar(w io.Writer, r io.Reader) error {
+	br := bufio.NewReader(r)
+	tw := tar.NewWriter(w)
+	linked := make(map[cpioLink]string)         // name holding data of hard linked file
+	pending := make(map[cpioLink][]*tar.Header) // links seen before the one with data
+	var pendingOrder []cpioLink
+	var off int64
+	for {
+		hdr, key, nlink, err := readCPIOHeader(br, &off)
+		if err != nil {
+			return err
+		}
+		if hdr == nil {
+			break
+		}
+		if hdr.Typeflag == tar.TypeReg && nlink > 1 {
+			if target, ok := linked[key]; ok {
+				hdr.Typeflag, hdr.Linkname = tar.TypeLink, target
+			} else if hdr.Size == 0 {
+				if pending[key] == nil {
+					pendingOrder = append(pendingOrder, key)
+				}
+				pending[key] = append(pending[key], hdr)
+				continue
+			}
+		}
+		switch hdr.Typeflag {
+		case 0:
+			// sockets can't be stored in tar
+			err = cpioSkip(br, &off, hdr.Size)
+		case tar.TypeReg:
+			if err = tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if _, err = io.CopyN(tw, br, hdr.Size); err != nil {
+				return unexpectedEOF(err)
+			}
+			off += hdr.Size
+			if nlink > 1 {
+				linked[key] = hdr.Name
+				err = cpioLinks(tw, pending[key], hdr.Name)
+				delete(pending, key)
+			}
+		case tar.TypeSymlink:
+			if hdr.Size > cpioMaxName {
+				return fmt.Errorf("%s: symlink target is too long: %d bytes", hdr.Name, hdr.Size)
+			}
+			target := make([]byte, hdr.Size)
+			if _, err = io.ReadFull(br, target); err != nil {
+				return unexpectedEOF(err)
+			}
+			off += hdr.Size
+			hdr.Linkname, hdr.Size = string(target), 0
+			err = tw.WriteHeader(hdr)
+		default:
+			size := hdr.Size
+			hdr.Size = 0
+			if err = tw.WriteHeader(hdr); err == nil {
+				err = cpioSkip(br, &off, size)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if err := cpioAlign(br, &off); err != nil {
+			return err
+		}
+	}
+	// links to empty files: the first one becomes the file
+	for _, key := range pendingOrder {
+		hdrs := pending[key]
+		if len(hdrs) == 0 {
+			continue
+		}
+		if err := tw.WriteHeader(hdrs[0]); err != nil {
+			return err
+		}
+		if err := cpioLinks(tw, hdrs[1:], hdrs[0].Name); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// readCPIOHeader reads the next entry header, returning nil header at the
+// archive trailer, along with hard link identity and number of links.
+// Sockets, which tar cannot represent, get zero Typeflag.
+func readCPIOHeader(br *bufio.Reader, off *int64) (*tar.Header, cpioLink, int64, error) {
+	var key cpioLink
+	buf := make([]byte, cpioHeaderSize)
+	if _, err := io.ReadFull(br, buf); err != nil {
+		return nil, key, 0, unexpectedEOF(err)
+	}
+	*off += cpioHeaderSize
+	switch magic := string(buf[:6]); magic {
+	case "070701", "070702":
+	case "070707":
+		return nil, key, 0, errors.New("cpio archive of old portable format is not supported, only newc")
+	default:
+		return nil, key, 0, fmt.Errorf("invalid cpio header magic %q", magic)
+	}
+	var f [13]int64
+	for i := range f {
+		v, err := strconv.ParseUint(string(buf[6+i*8:14+i*8]), 16, 32)
+		if err != nil {
+			return nil, key, 0, fmt.Errorf("invalid cpio header field: %w", err)
+		}
+		f[i] = int64(v)
+	}
+	ino, mode, uid, gid, nlink, mtime, size := f[0], f[1], f[2], f[3], f[4], f[5], f[6]
+	key = cpioLink{devmajor: f[7], devminor: f[8], ino: ino}
+	if f[11] > cpioMaxName {
+		return nil, key, 0, fmt.Errorf("cpio entry name is too long: %d bytes", f[11])
+	}
+	name := make([]byte, f[11])
+	if _, err := io.ReadFull(br, name); err != nil {
+		return nil, key, 0, unexpectedEOF(err)
+	}
+	*off += f[11]
+	name = bytes.TrimRight(name, "\x00")
+	if err := cpioAlign(br, off); err != nil {
+		return nil, key, 0, err
+	}
+	if string(name) == "TRAILER!!!" {
+		return nil, key, 0, nil
+	}
+	hdr := &tar.Header{
+		Name:     string(name),
+		Mode:     mode & 07777,
+		Uid:      int(uid),
+		Gid:      int(gid),
+		Size:     size,
+		ModTime:  time.Unix(mtime, 0),
+		Devmajor: f[9],
+		Devminor: f[10],
+		Format:   tar.FormatPAX,
+	}
+	switch mode & 0170000 {
+	case 0100000:
+		hdr.Typeflag = tar.TypeReg
+	case 0040000:
+		hdr.Typeflag = tar.TypeDir
+	case 0120000:
+		hdr.Typeflag = tar.TypeSymlink
+	case 0020000:
+		hdr.Typeflag = tar.TypeChar
+	case 0060000:
+		hdr.Typeflag = tar.TypeBlock
+	case 0010000:
+		hdr.Typeflag = tar.TypeFifo
+	case 0140000:
+		hdr.Typeflag = 0 // socket
+	default:
+		return nil, key, 0, fmt.Errorf("%s: unsupported cpio file mode %#o", name, mode)
+	}
+	if hdr.Typeflag != tar.TypeChar && hdr.Typeflag != tar.TypeBlock {
+		hdr.Devmajor, hdr.Devminor = 0, 0
+	}
+	return hdr, key, nlink, nil
+}
+
+// cpioLinks writes hard links to target
+func cpioLinks(tw *tar.Writer, hdrs []*tar.Header, target string) error {
+	for _, hdr := range hdrs {
+		hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeLink, target, 0
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cpioSkip discards n bytes of entry data
+func cpioSkip(br *bufio.Reader, off *int64, n int64) error {
+	if _, err := io.CopyN(io.Discard, br, n); err != nil {
+		return unexpectedEOF(err)
+	}
+	*off += n
+	return nil
+}
+
+// cpioAlign skips padding to the 4-byte boundary
+func cpioAlign(br *bufio.Reader, off *int64) error {
+	if pad := (4 - *off%4) % 4; pad != 0 {
+		return cpioSkip(br, off, pad)
+	}
+	return nil
+}
+
+// unexpectedEOF reports end of data met in the middle of archive structure
+// as io.ErrUnexpectedEOF
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
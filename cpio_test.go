@@ -0,0 +1,196 @@
+package untar
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// cpioEntry is an entry of test cpio archive
+type cpioEntry struct {
+	name  string
+	mode  int64
+	ino   int64
+	nlink int64
+	data  string
+}
+
+// newc returns cpio archive of newc format holding given entries, followed
+// by trailer
+func newc(entries ...cpioEntry) []byte {
+	var buf bytes.Buffer
+	pad := func() {
+		for buf.Len()%4 != 0 {
+			buf.WriteByte(0)
+		}
+	}
+	for _, e := range append(entries, cpioEntry{name: "TRAILER!!!", nlink: 1}) {
+		fmt.Fprintf(&buf, "070701%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x",
+			e.ino, e.mode, 0, 0, e.nlink, 0, len(e.data), 0, 0, 1, 2, len(e.name)+1, 0)
+		buf.WriteString(e.name + "\x00")
+		pad()
+		buf.WriteString(e.data)
+		pad()
+	}
+	return buf.Bytes()
+}
+
+// tarEntries describes entries of tar stream read from r, one per line
+func tarEntries(r io.Reader) (string, error) {
+	var out strings.Builder
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return out.String(), nil
+		}
+		if err != nil {
+			return out.String(), err
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return out.String(), err
+		}
+		fmt.Fprintf(&out, "%c %s %o", hdr.Typeflag, hdr.Name, hdr.Mode)
+		switch hdr.Typeflag {
+		case tar.TypeLink, tar.TypeSymlink:
+			fmt.Fprintf(&out, " -> %s", hdr.Linkname)
+		case tar.TypeChar, tar.TypeBlock:
+			fmt.Fprintf(&out, " %d,%d", hdr.Devmajor, hdr.Devminor)
+		}
+		if len(b) != 0 {
+			fmt.Fprintf(&out, " %q", b)
+		}
+		out.WriteByte('\n')
+	}
+}
+
+func TestCPIOTar(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		archive []byte
+		want    string
+		err     string // error substring, empty if none expected
+	}{
+		{
+			name: "types",
+			archive: newc(
+				cpioEntry{name: "dir", mode: 0040755, nlink: 2},
+				cpioEntry{name: "dir/file", mode: 0100644, nlink: 1, data: "hello"},
+				cpioEntry{name: "dir/link", mode: 0120777, nlink: 1, data: "file"},
+				cpioEntry{name: "fifo", mode: 0010600, nlink: 1},
+				cpioEntry{name: "null", mode: 0020666, nlink: 1},
+				cpioEntry{name: "socket", mode: 0140755, nlink: 1},
+				cpioEntry{name: "last", mode: 0100600, nlink: 1, data: "odd"},
+			),
+			want: "5 dir 755\n" +
+				"0 dir/file 644 \"hello\"\n" +
+				"2 dir/link 777 -> file\n" +
+				"6 fifo 600\n" +
+				"3 null 666 1,2\n" +
+				"0 last 600 \"odd\"\n",
+		},
+		{
+			name: "hard links with data in last one",
+			archive: newc(
+				cpioEntry{name: "a", mode: 0100644, ino: 7, nlink: 3},
+				cpioEntry{name: "other", mode: 0100644, ino: 8, nlink: 1, data: "x"},
+				cpioEntry{name: "b", mode: 0100644, ino: 7, nlink: 3},
+				cpioEntry{name: "c", mode: 0100644, ino: 7, nlink: 3, data: "data"},
+			),
+			want: "0 other 644 \"x\"\n" +
+				"0 c 644 \"data\"\n" +
+				"1 a 644 -> c\n" +
+				"1 b 644 -> c\n",
+		},
+		{
+			name: "hard links with data in first one",
+			archive: newc(
+				cpioEntry{name: "a", mode: 0100644, ino: 7, nlink: 2, data: "data"},
+				cpioEntry{name: "b", mode: 0100644, ino: 7, nlink: 2},
+			),
+			want: "0 a 644 \"data\"\n" +
+				"1 b 644 -> a\n",
+		},
+		{
+			name: "hard links to empty file",
+			archive: newc(
+				cpioEntry{name: "a", mode: 0100644, ino: 7, nlink: 2},
+				cpioEntry{name: "file", mode: 0100644, ino: 8, nlink: 1, data: "x"},
+				cpioEntry{name: "b", mode: 0100644, ino: 7, nlink: 2},
+			),
+			want: "0 file 644 \"x\"\n" +
+				"0 a 644\n" +
+				"1 b 644 -> a\n",
+		},
+		{
+			name:    "old portable format",
+			archive: append([]byte("070707"), make([]byte, 200)...),
+			err:     "old portable format",
+		},
+		{
+			name:    "bad magic",
+			archive: append([]byte("123456"), make([]byte, 200)...),
+			err:     "invalid cpio header magic",
+		},
+		{
+			name:    "bad field",
+			archive: append([]byte("070701zzzzzzzz"), make([]byte, 200)...),
+			err:     "invalid cpio header field",
+		},
+		{
+			name:    "unsupported mode",
+			archive: newc(cpioEntry{name: "x", mode: 0170644, nlink: 1}),
+			err:     "unsupported cpio file mode",
+		},
+		{
+			name:    "long name",
+			archive: newc(cpioEntry{name: strings.Repeat("x", cpioMaxName+1), mode: 0100644, nlink: 1}),
+			err:     "name is too long",
+		},
+		{
+			name:    "truncated",
+			archive: newc(cpioEntry{name: "file", mode: 0100644, nlink: 1, data: "hello"})[:cpioHeaderSize+8+2],
+			err:     io.ErrUnexpectedEOF.Error(),
+		},
+		{
+			name:    "empty",
+			archive: nil,
+			err:     io.ErrUnexpectedEOF.Error(),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := CPIOTar(bytes.NewReader(tc.archive))
+			defer r.Close()
+			got, err := tarEntries(r)
+			switch {
+			case tc.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+				t.Fatalf("got error %v, want one containing %q", err, tc.err)
+			}
+			if got != tc.want {
+				t.Errorf("got entries:\n%swant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCPIOTarClose(t *testing.T) {
+	var entries []cpioEntry
+	for i := 0; i < 1000; i++ {
+		entries = append(entries, cpioEntry{name: fmt.Sprint(i), mode: 0100644, nlink: 1, data: strings.Repeat("x", 1000)})
+	}
+	r := CPIOTar(bytes.NewReader(newc(entries...)))
+	if _, err := r.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if _, err := io.ReadAll(r); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("read after Close: got error %v, want %v", err, io.ErrClosedPipe)
+	}
+}
@@ -0,0 +1,98 @@
+package untar
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DecompressorFunc returns reader of data decompressed from r.
+type DecompressorFunc func(r io.Reader) (io.ReadCloser, error)
+
+type decompressor struct {
+	magic []byte
+	ext   string
+	fn    DecompressorFunc
+}
+
+var (
+	decompressorsMu sync.RWMutex
+	decompressors   []decompressor
+)
+
+// RegisterDecompressor makes data starting with magic bytes handled by fn,
+// so that the untar command and functions like UntarImage and DebData can
+// read compression formats or encryption wrappers this package doesn't
+// support itself. If ext (like ".br") is not empty, data of files named with
+// this extension is handled by fn too, which is needed for formats without
+// magic bytes; magic may be empty then. Built-in formats take precedence.
+// It panics if magic or extension is already registered. RegisterDecompressor
+// is intended to be called from init functions.
+func RegisterDecompressor(magic []byte, ext string, fn DecompressorFunc) {
+	decompressorsMu.Lock()
+	defer decompressorsMu.Unlock()
+	if fn == nil {
+		panic("untar: RegisterDecompressor with nil function")
+	}
+	if len(magic) == 0 && ext == "" {
+		panic("untar: RegisterDecompressor with neither magic nor extension")
+	}
+	for _, d := range decompressors {
+		if len(magic) != 0 && bytes.Equal(d.magic, magic) {
+			panic("untar: RegisterDecompressor called twice for magic " + string(magic))
+		}
+		if ext != "" && d.ext == ext {
+			panic("untar: RegisterDecompressor called twice for extension " + ext)
+		}
+	}
+	decompressors = append(decompressors, decompressor{magic: append([]byte(nil), magic...), ext: ext, fn: fn})
+}
+
+// Decompressors returns sorted list of file extensions of registered
+// decompressors.
+func Decompressors() []string {
+	decompressorsMu.RLock()
+	defer decompressorsMu.RUnlock()
+	var out []string
+	for _, d := range decompressors {
+		if d.ext != "" {
+			out = append(out, d.ext)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Decompress passes data read from br through decompressor registered with
+// RegisterDecompressor for its magic bytes or, failing that, for extension
+// of file name. It returns nil reader and nil error if there is no matching
+// decompressor.
+func Decompress(br *bufio.Reader, name string) (io.ReadCloser, error) {
+	decompressorsMu.RLock()
+	var fn DecompressorFunc
+	for _, d := range decompressors {
+		if len(d.magic) == 0 {
+			continue
+		}
+		if magic, _ := br.Peek(len(d.magic)); bytes.Equal(magic, d.magic) {
+			fn = d.fn
+			break
+		}
+	}
+	if fn == nil && name != "" {
+		for _, d := range decompressors {
+			if d.ext != "" && strings.HasSuffix(name, d.ext) {
+				fn = d.fn
+				break
+			}
+		}
+	}
+	decompressorsMu.RUnlock()
+	if fn == nil {
+		return nil, nil
+	}
+	return fn(br)
+}
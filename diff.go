@@ -0,0 +1,207 @@
+package untar
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Difference describes how the destination tree differs from an archive
+// entry, see Diff.
+type Difference struct {
+	Header *tar.Header
+	Path   string   // file system path entry would be extracted to
+	What   []string // differing attributes, see DiffMissing and others
+}
+
+// Attributes reported in Difference.What.
+const (
+	DiffMissing  = "missing"  // path does not exist
+	DiffType     = "type"     // path has another file type
+	DiffSize     = "size"     // regular file size
+	DiffContents = "contents" // regular file contents, compared only if asked to
+	DiffTarget   = "target"   // symlink target or file hard link refers to
+	DiffDevice   = "device"   // device number
+	DiffMode     = "mode"     // permission bits
+	DiffModTime  = "mtime"    // modification time, in whole seconds
+	DiffOwner    = "owner"    // numeric owner or group
+)
+
+// Diff compares entries read from r with the already extracted tree at dst
+// without modifying anything, like "tar -d", calling fn for each entry that
+// differs. File contents are compared only if contents is true, otherwise
+// regular files are compared by size. Options selecting and renaming entries
+// apply as in Untar; ownership is compared only when Untar would change it.
+func Diff(r io.Reader, dst string, contents bool, fn func(Difference), opts ...Option) error {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return err
+	}
+	if !cfg.onOS() {
+		return fmt.Errorf("diff with custom file system: %w", errors.ErrUnsupported)
+	}
+	chown := (os.Getuid() == 0 || cfg.fixedOwner) && !cfg.noOwner
+	var buf []byte
+	if contents {
+		buf = make([]byte, 64<<10)
+	}
+	it := newIterator(r, cfg)
+	for it.Next() {
+		hdr := it.Header()
+		name := filepath.Join(dst, filepath.FromSlash(it.Path()))
+		what, err := cfg.diff(dst, name, hdr, it.Reader(), buf, chown)
+		if err != nil {
+			return fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		if len(what) != 0 {
+			fn(Difference{Header: hdr, Path: name, What: what})
+		}
+	}
+	return it.Err()
+}
+
+// diff returns attributes of path name that differ from entry. If buf is not
+// empty, contents of regular files are compared with rd using it.
+func (c *config) diff(dst, name string, hdr *tar.Header, rd io.Reader, buf []byte, chown bool) ([]string, error) {
+	st, err := c.compare(dst, name, hdr, chown)
+	if err != nil {
+		return nil, err
+	}
+	var what []string
+	for _, d := range []struct {
+		differs bool
+		what    string
+	}{
+		{st.fi == nil, DiffMissing},
+		{st.typ, DiffType},
+		{st.target, DiffTarget},
+		{st.size, DiffSize},
+		{st.device, DiffDevice},
+		{st.mode, DiffMode},
+		{st.modTime, DiffModTime},
+		{st.owner, DiffOwner},
+	} {
+		if d.differs {
+			what = append(what, d.what)
+		}
+	}
+	if st.fi != nil && !st.typ && !st.size && len(buf) != 0 &&
+		(hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA) {
+		same, err := sameContents(name, rd, buf)
+		if err != nil {
+			return nil, err
+		}
+		if !same {
+			what = append(what, DiffContents)
+		}
+	}
+	return what, nil
+}
+
+// entryState describes how path an entry would be extracted to differs from
+// the entry, see compare
+type entryState struct {
+	fi      os.FileInfo // nil if path does not exist
+	typ     bool        // path has another file type; nothing else is compared then
+	target  bool        // symlink target or file hard link refers to
+	size    bool        // regular file size
+	device  bool        // device number
+	mode    bool        // permission bits
+	modTime bool        // modification time, in whole seconds
+	owner   bool        // numeric owner or group
+}
+
+// compare compares path name with entry hdr extracted into dst, for Diff and
+// dry-run mode. Links are compared only by target, as their own metadata is
+// not restored. Symlink to directory kept in place of directory entry (see
+// WithKeepDirectorySymlink) matches the entry, as extraction leaves it and
+// the directory it points to intact. Ownership is compared only if chown is
+// true.
+func (c *config) compare(dst, name string, hdr *tar.Header, chown bool) (entryState, error) {
+	mode := hdr.FileInfo().Mode() &^ c.permMask
+	var want os.FileMode // file type wanted
+	switch hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA, tar.TypeLink:
+	case tar.TypeDir, tar.TypeSymlink, tar.TypeFifo, tar.TypeChar, tar.TypeBlock:
+		want = mode.Type()
+	default:
+		return entryState{}, fmt.Errorf("unsupported header type flag for %[2]q: %#[1]x (%[1]q)", hdr.Typeflag, hdr.Name)
+	}
+	var st entryState
+	fi, err := os.Lstat(name)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	st.fi = fi
+	if fi.Mode().Type() != want {
+		if fi.Mode()&os.ModeSymlink != 0 && want == os.ModeDir && c.keepDirSymlink {
+			if fi, err := os.Stat(name); err == nil && fi.IsDir() {
+				return st, nil
+			}
+		}
+		st.typ = true
+		return st, nil
+	}
+	switch hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA:
+		st.size = fi.Size() != hdr.Size
+	case tar.TypeLink:
+		target, _ := c.destPath(dst, hdr.Linkname)
+		tfi, err := os.Lstat(target)
+		st.target = err != nil || !os.SameFile(fi, tfi)
+		return st, nil
+	case tar.TypeSymlink:
+		// symlink permissions and times are not restored
+		s, err := os.Readlink(name)
+		st.target = err != nil || s != c.symlinkTarget(hdr, dst, name)
+		return st, nil
+	case tar.TypeChar, tar.TypeBlock:
+		rdev, ok := fileDevice(fi)
+		st.device = ok && rdev != uint64(devNo(hdr.Devmajor, hdr.Devminor))
+	}
+	const perm = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	st.mode = fi.Mode()&perm != mode&perm
+	st.modTime = fi.ModTime().Unix() != hdr.ModTime.Unix()
+	if uid, gid, ok := fileOwner(fi); ok && chown {
+		wantUID, wantGID, err := c.owner(hdr)
+		if err != nil {
+			return st, err
+		}
+		st.owner = uid != wantUID || gid != wantGID
+	}
+	return st, nil
+}
+
+// sameContents reports whether file name has the same contents as rd, which
+// is known to be of the same size
+func sameContents(name string, rd io.Reader, buf []byte) (bool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	a, b := buf[:len(buf)/2], buf[len(buf)/2:]
+	for {
+		n, rerr := io.ReadFull(rd, a)
+		if rerr != nil && rerr != io.EOF && rerr != io.ErrUnexpectedEOF {
+			return false, rerr
+		}
+		m, err := io.ReadFull(f, b[:n])
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return false, err
+		}
+		if !bytes.Equal(a[:n], b[:m]) {
+			return false, nil
+		}
+		if rerr != nil {
+			return true, nil
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package untar
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffAndPlan(t *testing.T) {
+	mtime := time.Unix(1e9, 0)
+	tree := []*tar.Header{
+		{Name: "f", Typeflag: tar.TypeReg, ModTime: mtime},
+		{Name: "d/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: mtime},
+		{Name: "l", Typeflag: tar.TypeSymlink, Linkname: "f", ModTime: mtime},
+	}
+	for _, tc := range []struct {
+		name    string
+		prepare func(dst string) error // changes extracted tree
+		keep    bool                   // WithKeepDirectorySymlink
+		diff    []string
+		plan    []Action
+	}{
+		{
+			name: "identical",
+			plan: []Action{ActionUnchanged, ActionUnchanged, ActionUnchanged},
+		},
+		{
+			name:    "missing",
+			prepare: func(dst string) error { return os.Remove(filepath.Join(dst, "f")) },
+			diff:    []string{"f: missing"},
+			plan:    []Action{ActionCreate, ActionUnchanged, ActionUnchanged},
+		},
+		{
+			name: "size",
+			prepare: func(dst string) error {
+				name := filepath.Join(dst, "f")
+				if err := os.WriteFile(name, []byte("longer"), 0644); err != nil {
+					return err
+				}
+				return os.Chtimes(name, mtime, mtime)
+			},
+			diff: []string{"f: size"},
+			plan: []Action{ActionOverwrite, ActionUnchanged, ActionUnchanged},
+		},
+		{
+			name:    "mode",
+			prepare: func(dst string) error { return os.Chmod(filepath.Join(dst, "f"), 0600) },
+			diff:    []string{"f: mode"},
+			plan:    []Action{ActionChmod, ActionUnchanged, ActionUnchanged},
+		},
+		{
+			name: "replaced with empty directory",
+			prepare: func(dst string) error {
+				name := filepath.Join(dst, "f")
+				if err := os.Remove(name); err != nil {
+					return err
+				}
+				return os.Mkdir(name, 0755)
+			},
+			diff: []string{"f: type"},
+			plan: []Action{ActionReplace, ActionUnchanged, ActionUnchanged},
+		},
+		{
+			name: "replaced with non-empty directory",
+			prepare: func(dst string) error {
+				name := filepath.Join(dst, "f")
+				if err := os.Remove(name); err != nil {
+					return err
+				}
+				return os.MkdirAll(filepath.Join(name, "x"), 0755)
+			},
+			diff: []string{"f: type"},
+			plan: []Action{ActionConflict, ActionUnchanged, ActionUnchanged},
+		},
+		{
+			name: "symlink target",
+			prepare: func(dst string) error {
+				name := filepath.Join(dst, "l")
+				if err := os.Remove(name); err != nil {
+					return err
+				}
+				return os.Symlink("d", name)
+			},
+			diff: []string{"l: target"},
+			plan: []Action{ActionUnchanged, ActionUnchanged, ActionOverwrite},
+		},
+		{
+			name:    "directory symlink",
+			prepare: replaceWithSymlink,
+			diff:    []string{"d/: type"},
+			plan:    []Action{ActionUnchanged, ActionReplace, ActionUnchanged},
+		},
+		{
+			name:    "kept directory symlink",
+			prepare: replaceWithSymlink,
+			keep:    true,
+			plan:    []Action{ActionUnchanged, ActionUnchanged, ActionUnchanged},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dst := t.TempDir()
+			if err := Untar(tarball(t, tree...), dst); err != nil {
+				t.Fatal(err)
+			}
+			if tc.prepare != nil {
+				if err := tc.prepare(dst); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var opts []Option
+			if tc.keep {
+				opts = append(opts, WithKeepDirectorySymlink())
+			}
+			var diff []string
+			err := Diff(tarball(t, tree...), dst, true, func(d Difference) {
+				for _, what := range d.What {
+					diff = append(diff, d.Header.Name+": "+what)
+				}
+			}, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equal(diff, tc.diff) {
+				t.Errorf("Diff reported %q, want %q", diff, tc.diff)
+			}
+			var plan []Action
+			opts = append(opts, WithDryRun(), WithEntryFunc(func(e Entry) {
+				plan = append(plan, e.Actions[0])
+			}))
+			if err := Untar(tarball(t, tree...), dst, opts...); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(plan, tc.plan) {
+				t.Errorf("dry run planned %q, want %q", plan, tc.plan)
+			}
+		})
+	}
+}
+
+// replaceWithSymlink replaces directory d in dst with symlink to directory
+// of different mode
+func replaceWithSymlink(dst string) error {
+	if err := os.Remove(filepath.Join(dst, "d")); err != nil {
+		return err
+	}
+	if err := os.Mkdir(filepath.Join(dst, "real"), 0700); err != nil {
+		return err
+	}
+	return os.Symlink("real", filepath.Join(dst, "d"))
+}
@@ -0,0 +1,86 @@
+package untar
+
+import (
+	"archive/tar"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ownerRWX are permissions new directories get during extraction, so that
+// entries can be written inside read-only directories
+const ownerRWX os.FileMode = 0700
+
+// pendingDir is directory which metadata is restored once all entries are
+// extracted, see restoreDirs
+type pendingDir struct {
+	hdr     *tar.Header
+	mode    os.FileMode // mode to set with WithExactPermissions
+	widened os.FileMode // permissions added on creation, to be removed
+}
+
+// deferDir records directory name to set its times (and remove permissions
+// widened on creation) after extraction
+func (c *config) deferDir(name string, hdr *tar.Header, mode, widened os.FileMode) {
+	if c.dirs == nil {
+		c.dirs = make(map[string]pendingDir)
+	}
+	if p, ok := c.dirs[name]; ok {
+		// directory appears in archive again, keep permissions to
+		// remove if it was created by the earlier entry
+		widened = p.widened & (ownerRWX &^ mode)
+	}
+	c.dirs[name] = pendingDir{hdr: hdr, mode: mode, widened: widened}
+}
+
+// restoreDirs sets metadata of directories recorded with deferDir, deepest
+// first, like GNU tar --delay-directory-restore does
+func (c *config) restoreDirs() error {
+	names := make([]string, 0, len(c.dirs))
+	for name := range c.dirs {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		di, dj := strings.Count(names[i], string(os.PathSeparator)), strings.Count(names[j], string(os.PathSeparator))
+		if di != dj {
+			return di > dj
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		p := c.dirs[name]
+		if err := c.restoreDir(name, p); err != nil {
+			if err := c.entryFailed(p.hdr, err); err != nil {
+				return err
+			}
+		}
+	}
+	c.dirs = nil
+	return nil
+}
+
+// restoreDir sets metadata of directory name recorded with deferDir
+func (c *config) restoreDir(name string, p pendingDir) error {
+	fi, err := c.fs.Lstat(name)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return nil // replaced by later entry
+	}
+	if c.exactPerms {
+		if err := c.fs.Chmod(name, p.mode&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+			return err
+		}
+	} else if p.widened != 0 {
+		if err := c.fs.Chmod(name, fi.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)&^p.widened); err != nil {
+			return err
+		}
+	}
+	if c.ntfsPerms && c.onOS() {
+		if err := setNTFSPermissions(name, p.hdr, p.mode); err != nil && !c.degraded("setacl", p.hdr.Name, err) {
+			return err
+		}
+	}
+	return c.setTimes(name, p.hdr)
+}
@@ -0,0 +1,316 @@
+package untar
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FS provides read-only access to contents of uncompressed tar archive
+// without extracting it. It implements fs.FS, fs.ReadDirFS, fs.ReadFileFS,
+// fs.StatFS and fs.ReadLinkFS, so it can be used with fs.WalkDir,
+// http.FileServerFS or template.ParseFS:
+//
+//	f, err := os.Open("site.tar")
+//	...
+//	fi, err := f.Stat()
+//	...
+//	fsys, err := untar.NewFS(f, fi.Size())
+//	...
+//	http.Handle("/", http.FileServerFS(fsys))
+//
+// Directories missing from archive but having entries inside
+// are reported with 0755 permissions; if archive has multiple entries with the
+// same name, the last one is used. Open follows symbolic links; links pointing
+// outside of archive are reported as not existing.
+//
+// Files opened from FS implement io.ReaderAt and io.Seeker; FileInfo.Sys of
+// entries returns their *tar.Header (for hard links, header of the file they
+// point to). Sparse files can't be read in place: they are listed, but
+// opening or reading them fails with error wrapping errors.ErrUnsupported.
+type FS struct {
+	idx  *tarIndex
+	dirs map[string][]string // directory name to sorted names of its children
+}
+
+// NewFS indexes uncompressed tar archive of given size read from r.
+func NewFS(r io.ReaderAt, size int64) (*FS, error) {
+	idx, err := newTarIndex(r, size)
+	if err != nil {
+		return nil, err
+	}
+	children := map[string]map[string]bool{".": {}}
+	for name := range idx.entries {
+		if !fs.ValidPath(name) {
+			delete(idx.entries, name)
+			continue
+		}
+		for name != "." {
+			dir := path.Dir(name)
+			if children[dir] == nil {
+				children[dir] = make(map[string]bool)
+			}
+			children[dir][path.Base(name)] = true
+			name = dir
+		}
+	}
+	fsys := &FS{idx: idx, dirs: make(map[string][]string, len(children))}
+	for dir, names := range children {
+		if e, ok := idx.entries[dir]; ok && e.hdr.Typeflag != tar.TypeDir {
+			continue // entry replaced by non-directory
+		}
+		list := make([]string, 0, len(names))
+		for name := range names {
+			list = append(list, name)
+		}
+		sort.Strings(list)
+		fsys.dirs[dir] = list
+	}
+	return fsys, nil
+}
+
+var errLinkLoop = errors.New("too many levels of symbolic links")
+
+// errSparse is returned on attempts to read sparse files, see FS
+var errSparse = fmt.Errorf("sparse file: %w", errors.ErrUnsupported)
+
+// resolve returns name of entry with no symbolic links in its path; if follow
+// is false, the last element is not followed
+func (f *FS) resolve(name string, follow bool) (string, error) {
+	var parts []string
+	if name != "." {
+		parts = strings.Split(name, "/")
+	}
+	cur, hops := ".", 0
+	for i := 0; i < len(parts); i++ {
+		next := path.Join(cur, parts[i])
+		e, ok := f.idx.entries[next]
+		if !ok {
+			if _, ok := f.dirs[next]; !ok {
+				return "", fs.ErrNotExist
+			}
+			cur = next
+			continue
+		}
+		last := i == len(parts)-1
+		if e.hdr.Typeflag != tar.TypeSymlink || (last && !follow) {
+			if !last && e.hdr.Typeflag != tar.TypeDir {
+				return "", fs.ErrNotExist
+			}
+			cur = next
+			continue
+		}
+		if hops++; hops > 40 {
+			return "", errLinkLoop
+		}
+		target := path.Join(cur, e.hdr.Linkname)
+		if path.IsAbs(e.hdr.Linkname) {
+			target = cleanName(e.hdr.Linkname)
+		}
+		if target == "" || target == ".." || strings.HasPrefix(target, "../") {
+			if target != "" {
+				return "", fs.ErrNotExist
+			}
+			target = "."
+		}
+		rest := append([]string(nil), parts[i+1:]...)
+		parts, cur, i = nil, ".", -1
+		if target != "." {
+			parts = strings.Split(target, "/")
+		}
+		parts = append(parts, rest...)
+	}
+	return cur, nil
+}
+
+// entry returns header of entry with resolved name, following hard links;
+// it returns nil for implicit directories
+func (f *FS) entry(name string) (*indexEntry, error) {
+	e, ok := f.idx.entries[name]
+	if !ok {
+		if _, ok := f.dirs[name]; ok || name == "." {
+			return nil, nil
+		}
+		return nil, fs.ErrNotExist
+	}
+	for i := 0; e.hdr.Typeflag == tar.TypeLink; i++ {
+		if i > 16 {
+			return nil, errLinkLoop
+		}
+		if e, ok = f.idx.entries[cleanName(e.hdr.Linkname)]; !ok {
+			return nil, fs.ErrNotExist
+		}
+	}
+	return &e, nil
+}
+
+func (f *FS) stat(op, name string, follow bool) (fs.FileInfo, *indexEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	resolved, err := f.resolve(name, follow)
+	if err != nil {
+		return nil, nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	e, err := f.entry(resolved)
+	if err != nil {
+		return nil, nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	base := path.Base(name)
+	if e == nil {
+		return dirInfo(base), nil, nil
+	}
+	return entryInfo{FileInfo: e.hdr.FileInfo(), name: base}, e, nil
+}
+
+// Stat returns FileInfo describing named entry, following symbolic links.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	fi, _, err := f.stat("stat", name, true)
+	return fi, err
+}
+
+// Lstat returns FileInfo describing named entry without following symbolic
+// link in the last element of name.
+func (f *FS) Lstat(name string) (fs.FileInfo, error) {
+	fi, _, err := f.stat("lstat", name, false)
+	return fi, err
+}
+
+// ReadLink returns target of named symbolic link.
+func (f *FS) ReadLink(name string) (string, error) {
+	_, e, err := f.stat("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if e == nil || e.hdr.Typeflag != tar.TypeSymlink {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return e.hdr.Linkname, nil
+}
+
+// ReadFile returns contents of named regular file, following symbolic links.
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	fi, e, err := f.stat("read", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+	if e.hdr.Typeflag != tar.TypeReg && e.hdr.Typeflag != tar.TypeRegA {
+		return []byte{}, nil
+	}
+	if e.sparse {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errSparse}
+	}
+	b := make([]byte, e.hdr.Size)
+	if _, err := f.idx.r.ReadAt(b, e.offset); err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return b, nil
+}
+
+// ReadDir returns entries of named directory sorted by name.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	fi, _, err := f.stat("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	dir, _ := f.resolve(name, true)
+	out := make([]fs.DirEntry, 0, len(f.dirs[dir]))
+	for _, child := range f.dirs[dir] {
+		fi, err := f.Lstat(path.Join(dir, child))
+		if err != nil {
+			continue
+		}
+		out = append(out, fs.FileInfoToDirEntry(fi))
+	}
+	return out, nil
+}
+
+// Open opens named entry for reading.
+func (f *FS) Open(name string) (fs.File, error) {
+	fi, e, err := f.stat("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		entries, err := f.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &openDir{info: fi, entries: entries}, nil
+	}
+	var size int64
+	if e.hdr.Typeflag == tar.TypeReg || e.hdr.Typeflag == tar.TypeRegA {
+		if e.sparse {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: errSparse}
+		}
+		size = e.hdr.Size
+	}
+	return &openFile{SectionReader: io.NewSectionReader(f.idx.r, e.offset, size), info: fi}, nil
+}
+
+// entryInfo is FileInfo of archive entry, possibly under another name
+type entryInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (fi entryInfo) Name() string { return fi.name }
+
+// dirInfo is FileInfo of implicit directory
+type dirInfo string
+
+func (d dirInfo) Name() string       { return string(d) }
+func (d dirInfo) Size() int64        { return 0 }
+func (d dirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0755 }
+func (d dirInfo) ModTime() time.Time { return time.Time{} }
+func (d dirInfo) IsDir() bool        { return true }
+func (d dirInfo) Sys() interface{}   { return nil }
+
+type openFile struct {
+	*io.SectionReader
+	info fs.FileInfo
+}
+
+func (f *openFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *openFile) Close() error               { return nil }
+
+type openDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+}
+
+func (d *openDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *openDir) Close() error               { return nil }
+
+func (d *openDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+func (d *openDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		out := d.entries
+		d.entries = nil
+		return out, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	out := d.entries[:n]
+	d.entries = d.entries[n:]
+	return out, nil
+}
@@ -0,0 +1,154 @@
+package untar
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// sparseTar returns archive holding sparse file of PAX 1.0 format with name
+// and 10 bytes of data: "hello" followed by a hole. It is made by hand, as
+// archive/tar cannot write sparse files.
+func sparseTar(name string) []byte {
+	block := func(name string, typ byte, size int) []byte {
+		b := make([]byte, 512)
+		copy(b, name)
+		copy(b[100:], "0000644\x00")
+		copy(b[108:], "0000000\x00")
+		copy(b[116:], "0000000\x00")
+		copy(b[124:], fmt.Sprintf("%011o\x00", size))
+		copy(b[136:], "00000000000\x00")
+		copy(b[148:], "        ")
+		b[156] = typ
+		copy(b[257:], "ustar\x0000")
+		var sum int
+		for _, c := range b {
+			sum += int(c)
+		}
+		copy(b[148:], fmt.Sprintf("%06o\x00", sum))
+		return b
+	}
+	pad := func(b []byte) []byte { return append(b, make([]byte, (512-len(b)%512)%512)...) }
+	var pax []byte
+	for _, kv := range [][2]string{
+		{"GNU.sparse.major", "1"},
+		{"GNU.sparse.minor", "0"},
+		{"GNU.sparse.name", name},
+		{"GNU.sparse.realsize", "10"},
+	} {
+		for n := len(kv[0]) + len(kv[1]) + 3; ; n++ {
+			if rec := fmt.Sprintf("%d %s=%s\n", n, kv[0], kv[1]); len(rec) == n {
+				pax = append(pax, rec...)
+				break
+			}
+		}
+	}
+	data := append(pad([]byte("1\n0\n5\n")), "hello"...)
+	var out []byte
+	out = append(out, block("PaxHeaders/"+name, tar.TypeXHeader, len(pax))...)
+	out = append(out, pad(pax)...)
+	out = append(out, block("GNUSparseFile.0/"+name, tar.TypeReg, len(data))...)
+	out = append(out, pad(data)...)
+	return append(out, make([]byte, 1024)...)
+}
+
+func TestFS(t *testing.T) {
+	archive := tarball(t,
+		&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755},
+		reg("dir/file"),
+		&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "dir/file"},
+		&tar.Header{Name: "dirlink", Typeflag: tar.TypeSymlink, Linkname: "dir"},
+		&tar.Header{Name: "hard", Typeflag: tar.TypeLink, Linkname: "dir/file"},
+		&tar.Header{Name: "out", Typeflag: tar.TypeSymlink, Linkname: "../x"},
+		&tar.Header{Name: "abs", Typeflag: tar.TypeSymlink, Linkname: "/dir/file"},
+		&tar.Header{Name: "loop", Typeflag: tar.TypeSymlink, Linkname: "loop"},
+		reg("implicit/file"),
+		reg("dup"),
+		&tar.Header{Name: "dup", Typeflag: tar.TypeReg, Size: 3},
+	)
+	b, err := io.ReadAll(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// replace end of archive marker with another archive
+	b = append(b[:len(b)-1024], sparseTar("sparse")...)
+	fsys, err := NewFS(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		data string
+		err  error
+	}{
+		{name: "dir/file", data: "dir/file"},
+		{name: "link", data: "dir/file"},
+		{name: "dirlink/file", data: "dir/file"},
+		{name: "hard", data: "dir/file"},
+		{name: "abs", data: "dir/file"},
+		{name: "implicit/file", data: "implicit/file"},
+		{name: "dup", data: "xxx"},
+		{name: "out", err: fs.ErrNotExist},
+		{name: "missing", err: fs.ErrNotExist},
+		{name: "dir/file/x", err: fs.ErrNotExist},
+		{name: "loop", err: errLinkLoop},
+		{name: "sparse", err: errors.ErrUnsupported},
+		{name: "/dir/file", err: fs.ErrInvalid},
+	} {
+		got, err := fsys.ReadFile(tc.name)
+		switch {
+		case tc.err == nil && err != nil:
+			t.Errorf("ReadFile(%q): unexpected error: %v", tc.name, err)
+		case tc.err != nil && !errors.Is(err, tc.err):
+			t.Errorf("ReadFile(%q): got error %v, want %v", tc.name, err, tc.err)
+		case string(got) != tc.data:
+			t.Errorf("ReadFile(%q) = %q, want %q", tc.name, got, tc.data)
+		}
+		if _, err := fsys.Open(tc.name); tc.err != nil && !errors.Is(err, tc.err) {
+			t.Errorf("Open(%q): got error %v, want %v", tc.name, err, tc.err)
+		}
+	}
+	fi, err := fsys.Stat("sparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 10 {
+		t.Errorf("sparse file size is %d, want 10", fi.Size())
+	}
+	if fi, err := fsys.Stat("implicit"); err != nil || fi.Mode() != fs.ModeDir|0755 {
+		t.Errorf("implicit directory: %v, %v", fi, err)
+	}
+	var names []string
+	if err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		names = append(names, p)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".", "abs", "dir", "dir/file", "dirlink", "dup", "hard", "implicit", "implicit/file", "link", "loop", "out", "sparse"}
+	if !equal(names, want) {
+		t.Errorf("walk visited %q, want %q", names, want)
+	}
+}
+
+func TestFSConformance(t *testing.T) {
+	archive := tarball(t,
+		&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755},
+		reg("dir/file"),
+		reg("implicit/sub/file"),
+		&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "dir/file"},
+		&tar.Header{Name: "hard", Typeflag: tar.TypeLink, Linkname: "dir/file"},
+	)
+	fsys, err := NewFS(archive, archive.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(fsys, "dir/file", "implicit/sub/file", "link", "hard"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,55 @@
+package untar
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/mod/module"
+	modzip "golang.org/x/mod/zip"
+)
+
+// UnzipModule extracts Go module zip file, as served by module proxies, to dst
+// directory, which must be empty or not exist. Module path and version are
+// checked to be valid and match "path@version/" prefix of all files; if both
+// are empty, they are taken from the first file. Zip contents are validated
+// against module zip restrictions (file names, sizes, case-insensitive
+// collisions) before anything is extracted. Module files are extracted
+// read-only, matching layout of module cache.
+func UnzipModule(zipFile, dst, path, version string) error {
+	if path == "" && version == "" {
+		var err error
+		if path, version, err = moduleFromZip(zipFile); err != nil {
+			return err
+		}
+	}
+	m := module.Version{Path: path, Version: version}
+	if err := module.Check(path, version); err != nil {
+		return err
+	}
+	return modzip.Unzip(dst, m, zipFile)
+}
+
+// moduleFromZip returns module path and version from "path@version/" prefix
+// of the first file in zip
+func moduleFromZip(zipFile string) (path, version string, err error) {
+	zr, err := zip.OpenReader(zipFile)
+	if err != nil {
+		return "", "", err
+	}
+	defer zr.Close()
+	if len(zr.File) == 0 {
+		return "", "", errors.New("module zip is empty")
+	}
+	name := zr.File[0].Name
+	at := strings.IndexByte(name, '@')
+	if at < 0 {
+		return "", "", fmt.Errorf("%s: file name has no module@version prefix", name)
+	}
+	slash := strings.IndexByte(name[at:], '/')
+	if slash < 0 {
+		return "", "", fmt.Errorf("%s: file name has no module@version prefix", name)
+	}
+	return name[:at], name[at+1 : at+slash], nil
+}
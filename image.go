@@ -0,0 +1,345 @@
+package untar
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ImageRef selects an image inside "docker save" (or OCI image layout)
+// archive.
+type ImageRef struct {
+	// Name is image name with optional tag, like "alpine:3.20"; it may be
+	// empty if archive holds a single image.
+	Name string
+	// Platform is "os/arch" or "os/arch/variant", like "linux/arm64"; if
+	// empty and image is available for multiple platforms, the one matching
+	// current architecture is used.
+	Platform string
+}
+
+// UntarImage assembles root file system of container image from archive
+// created with "docker save" (or holding OCI image layout) to dst, applying
+// image layers in order. Archive must be an uncompressed tar of given size.
+// Options apply to extraction of each layer, see WithWhiteouts for how layers
+// are combined.
+func UntarImage(r io.ReaderAt, size int64, dst string, ref ImageRef, opts ...Option) error {
+	return UntarImageContext(context.Background(), r, size, dst, ref, opts...)
+}
+
+// UntarImageContext works like UntarImage, but stops with ctx.Err() once ctx
+// is done.
+func UntarImageContext(ctx context.Context, r io.ReaderAt, size int64, dst string, ref ImageRef, opts ...Option) error {
+	idx, err := newTarIndex(r, size)
+	if err != nil {
+		return err
+	}
+	img, err := idx.findImage(ref)
+	if err != nil {
+		return err
+	}
+	opts = append(opts[:len(opts):len(opts)], WithWhiteouts())
+	for _, layer := range img.layers {
+		if err := idx.untarLayer(ctx, layer, dst, opts); err != nil {
+			return fmt.Errorf("layer %s: %w", layer, err)
+		}
+	}
+	return nil
+}
+
+func (x *tarIndex) untarLayer(ctx context.Context, name, dst string, opts []Option) error {
+	sr, err := x.open(name)
+	if err != nil {
+		return err
+	}
+	rd, err := decompress(sr, name)
+	if err != nil {
+		return err
+	}
+	if c, ok := rd.(io.Closer); ok {
+		defer c.Close()
+	}
+	return UntarContext(ctx, rd, dst, opts...)
+}
+
+// decompress detects compression of layer data by its magic bytes, returning
+// reader of uncompressed data. Decompressors registered with
+// RegisterDecompressor are tried for other data, see Decompress.
+func decompress(r io.Reader, name string) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+	if rd, err := Decompress(br, name); rd != nil || err != nil {
+		return rd, err
+	}
+	return br, nil
+}
+
+// image describes a single platform image found in archive
+type image struct {
+	names    []string
+	platform string
+	layers   []string // archive entry names of layers, lowest first
+}
+
+func (im *image) String() string {
+	name := "<untagged>"
+	if len(im.names) != 0 {
+		name = im.names[0]
+	}
+	if im.platform == "" {
+		return name
+	}
+	return name + " (" + im.platform + ")"
+}
+
+// OCI image layout structures, only fields used here
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Platform    *ociPlatform      `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociPlatform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+func (p *ociPlatform) String() string {
+	if p == nil || p.OS == "" {
+		return ""
+	}
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// ociManifest is either image index (with Manifests) or image manifest (with
+// Config and Layers)
+type ociManifest struct {
+	Manifests []ociDescriptor `json:"manifests"`
+	Config    ociDescriptor   `json:"config"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+// dockerManifest is an element of manifest.json written by "docker save"
+type dockerManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// findImage finds the only image in archive matching ref
+func (x *tarIndex) findImage(ref ImageRef) (*image, error) {
+	var all []*image
+	var err error
+	if _, ok := x.entries["index.json"]; ok {
+		all, err = x.ociImages()
+	} else if _, ok := x.entries["manifest.json"]; ok {
+		all, err = x.dockerImages()
+	} else {
+		return nil, errors.New("archive has neither index.json nor manifest.json, not a container image")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var found []*image
+	for _, im := range all {
+		if ref.Name != "" && !matchImageName(im.names, ref.Name) {
+			continue
+		}
+		if ref.Platform != "" && !matchPlatform(im.platform, ref.Platform) {
+			continue
+		}
+		found = append(found, im)
+	}
+	if len(found) > 1 && ref.Platform == "" {
+		var native []*image
+		for _, im := range found {
+			if matchPlatform(im.platform, "linux/"+runtime.GOARCH) {
+				native = append(native, im)
+			}
+		}
+		if len(native) != 0 {
+			found = native
+		}
+	}
+	switch len(found) {
+	case 1:
+		return found[0], nil
+	case 0:
+		return nil, fmt.Errorf("no image matches %s, available: %s", refString(ref), imageList(all))
+	}
+	return nil, fmt.Errorf("multiple images match %s, use name and platform to select one of: %s", refString(ref), imageList(found))
+}
+
+func (x *tarIndex) ociImages() ([]*image, error) {
+	var index ociManifest
+	if err := x.readJSON("index.json", &index); err != nil {
+		return nil, err
+	}
+	var out []*image
+	for _, d := range index.Manifests {
+		var names []string
+		for _, key := range []string{"io.containerd.image.name", "org.opencontainers.image.ref.name"} {
+			if s := d.Annotations[key]; s != "" {
+				names = append(names, s)
+			}
+		}
+		images, err := x.ociExpand(d, names, 0)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, images...)
+	}
+	return out, nil
+}
+
+// ociExpand returns images described by descriptor, which may point to either
+// image manifest or nested image index
+func (x *tarIndex) ociExpand(d ociDescriptor, names []string, depth int) ([]*image, error) {
+	if depth > 4 {
+		return nil, errors.New("image index nesting is too deep")
+	}
+	if d.Annotations["vnd.docker.reference.type"] == "attestation-manifest" {
+		return nil, nil
+	}
+	var m ociManifest
+	if err := x.readJSON(blobPath(d.Digest), &m); err != nil {
+		return nil, err
+	}
+	if len(m.Manifests) != 0 {
+		var out []*image
+		for _, child := range m.Manifests {
+			images, err := x.ociExpand(child, names, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, images...)
+		}
+		return out, nil
+	}
+	im := &image{names: names, platform: d.Platform.String()}
+	if im.platform == "" {
+		var p ociPlatform
+		if err := x.readJSON(blobPath(m.Config.Digest), &p); err == nil {
+			im.platform = p.String()
+		}
+	}
+	if im.platform == "unknown/unknown" {
+		return nil, nil
+	}
+	for _, l := range m.Layers {
+		im.layers = append(im.layers, blobPath(l.Digest))
+	}
+	return []*image{im}, nil
+}
+
+func (x *tarIndex) dockerImages() ([]*image, error) {
+	var manifests []dockerManifest
+	if err := x.readJSON("manifest.json", &manifests); err != nil {
+		return nil, err
+	}
+	var out []*image
+	for _, m := range manifests {
+		im := &image{names: m.RepoTags, layers: m.Layers}
+		var p ociPlatform
+		if err := x.readJSON(m.Config, &p); err == nil {
+			im.platform = p.String()
+		}
+		out = append(out, im)
+	}
+	return out, nil
+}
+
+func (x *tarIndex) readJSON(name string, v interface{}) error {
+	sr, err := x.open(name)
+	if err != nil {
+		return err
+	}
+	if err := json.NewDecoder(io.LimitReader(sr, 16<<20)).Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// blobPath returns name of OCI image layout blob with given digest
+func blobPath(digest string) string {
+	return "blobs/" + strings.Replace(digest, ":", "/", 1)
+}
+
+func matchImageName(names []string, want string) bool {
+	want = normalizeImageName(want)
+	for _, name := range names {
+		if normalizeImageName(name) == want {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeImageName strips default registry and adds default tag to image
+// name, so that "docker.io/library/alpine:latest" and "alpine" are equal
+func normalizeImageName(name string) string {
+	name = strings.TrimPrefix(name, "docker.io/")
+	name = strings.TrimPrefix(name, "library/")
+	if !strings.Contains(name, "@") && !strings.Contains(name[strings.LastIndexByte(name, '/')+1:], ":") {
+		name += ":latest"
+	}
+	return name
+}
+
+// matchPlatform reports whether platform "os/arch[/variant]" satisfies want;
+// variant is only compared if want has it
+func matchPlatform(platform, want string) bool {
+	if platform == want {
+		return true
+	}
+	p, w := strings.Split(platform, "/"), strings.Split(want, "/")
+	return len(w) == 2 && len(p) == 3 && p[0] == w[0] && p[1] == w[1]
+}
+
+func refString(ref ImageRef) string {
+	switch {
+	case ref.Name == "" && ref.Platform == "":
+		return "any name"
+	case ref.Platform == "":
+		return ref.Name
+	case ref.Name == "":
+		return "platform " + ref.Platform
+	}
+	return ref.Name + " for " + ref.Platform
+}
+
+func imageList(images []*image) string {
+	if len(images) == 0 {
+		return "none"
+	}
+	s := make([]string, len(images))
+	for i, im := range images {
+		s[i] = im.String()
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,76 @@
+package untar
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+)
+
+// tarIndex maps names of uncompressed tar archive entries to their headers
+// and data offsets, allowing random access to entry contents
+type tarIndex struct {
+	r       io.ReaderAt
+	entries map[string]indexEntry
+}
+
+type indexEntry struct {
+	hdr    *tar.Header
+	offset int64 // offset of entry data in archive
+	sparse bool  // data is stored without holes, so it can't be read at offset
+}
+
+func newTarIndex(r io.ReaderAt, size int64) (*tarIndex, error) {
+	idx := &tarIndex{r: r, entries: make(map[string]indexEntry)}
+	sr := io.NewSectionReader(r, 0, size)
+	tr := tar.NewReader(sr)
+	for {
+		hdr, err := tr.Next()
+		switch err {
+		case nil:
+		case io.EOF:
+			return idx, nil
+		default:
+			return nil, err
+		}
+		// tar.Reader does not read ahead, so after Next underlying
+		// reader is positioned at the start of entry data
+		off, err := sr.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		if name := cleanName(hdr.Name); name != "" {
+			idx.entries[name] = indexEntry{hdr: hdr, offset: off, sparse: isSparse(hdr)}
+		}
+	}
+}
+
+// open returns reader of named regular file contents, following symlinks and
+// hard links
+func (x *tarIndex) open(name string) (*io.SectionReader, error) {
+	orig := name
+	for i := 0; i < 16; i++ {
+		name = cleanName(name)
+		e, ok := x.entries[name]
+		if !ok {
+			return nil, fmt.Errorf("%s: no such archive entry", orig)
+		}
+		switch e.hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA, tar.TypeGNUSparse:
+			if e.sparse {
+				return nil, fmt.Errorf("%s: sparse file: %w", orig, errors.ErrUnsupported)
+			}
+			return io.NewSectionReader(x.r, e.offset, e.hdr.Size), nil
+		case tar.TypeLink:
+			name = e.hdr.Linkname
+		case tar.TypeSymlink:
+			if name = e.hdr.Linkname; !path.IsAbs(name) {
+				name = path.Join(path.Dir(e.hdr.Name), name)
+			}
+		default:
+			return nil, fmt.Errorf("%s: not a regular file", orig)
+		}
+	}
+	return nil, fmt.Errorf("%s: too many levels of links", orig)
+}
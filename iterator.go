@@ -0,0 +1,163 @@
+package untar
+
+import (
+	"archive/tar"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnsafePath is returned for entries with names (or hard link targets)
+// pointing outside of the destination, like "../etc/passwd".
+var ErrUnsafePath = errors.New("path points outside of destination")
+
+// Iterator reads tar stream entry by entry, leaving handling of entries to the
+// caller:
+//
+//	it := untar.NewIterator(r)
+//	for it.Next() {
+//		hdr, rd := it.Header(), it.Reader()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// Iterator applies selection options (filters, excludes, members), skips
+// entries with extended header records and checks that entry names and hard
+// link targets stay inside destination (unless WithUnsafe is used). Untar is
+// built on top of it.
+type Iterator struct {
+	cfg  *config
+	r    io.Reader
+	tr   *tar.Reader
+	buf  []byte // used for trailing data check, may be nil
+	hdr  *tar.Header
+	path string
+	err  error
+
+	sparse bool // current entry is a sparse file
+
+	entries int   // selected entries, see WithLimits
+	total   int64 // size of selected regular files
+}
+
+// NewIterator returns Iterator reading tar stream from r. Options that don't
+// select entries have no effect, except for WithStats, which counts skipped
+// entries, WithTrailingData, WithIgnoreZeros and WithLimits.
+func NewIterator(r io.Reader, opts ...Option) *Iterator {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return &Iterator{err: err}
+	}
+	return newIterator(r, cfg)
+}
+
+func newIterator(r io.Reader, cfg *config) *Iterator {
+	if cfg.zeros {
+		r = bufio.NewReader(r)
+	}
+	return &Iterator{cfg: cfg, r: r, tr: tar.NewReader(r)}
+}
+
+// Next advances to the next selected entry, returning false at the end of
+// stream or on error, see Err.
+func (it *Iterator) Next() bool {
+	if it.err != nil || it.tr == nil {
+		return false
+	}
+	cfg := it.cfg
+	for {
+		if cfg.members != nil && cfg.members.done() {
+			it.tr = nil
+			return false
+		}
+		hdr, err := it.tr.Next()
+		switch err {
+		case nil:
+		case io.EOF:
+			if cfg.zeros {
+				var more bool
+				if more, it.err = nextStream(it.r.(*bufio.Reader)); more {
+					it.tr = tar.NewReader(it.r)
+					continue
+				}
+			} else {
+				it.err = cfg.checkTrailing(it.r, it.buf)
+			}
+			if it.err == nil && cfg.members != nil {
+				it.err = cfg.members.missing()
+			}
+			it.tr = nil
+			return false
+		default:
+			it.err = err
+			return false
+		}
+		it.sparse = isSparse(hdr)
+		if hdr.Typeflag == tar.TypeGNUSparse {
+			hdr.Typeflag = tar.TypeReg // reader expands holes
+		}
+		if cfg.strict {
+			if it.err = checkHeader(hdr); it.err != nil {
+				return false
+			}
+		}
+		switch hdr.Typeflag {
+		case tar.TypeXGlobalHeader, tar.TypeXHeader:
+			continue
+		}
+		if !cfg.selected(hdr) {
+			cfg.stats.Skipped++
+			continue
+		}
+		name, ok := cfg.relPath(hdr.Name)
+		if !ok {
+			cfg.stats.Skipped++
+			continue
+		}
+		if unsafePath(name) && !cfg.unsafe {
+			it.err = fmt.Errorf("%s: %w", hdr.Name, ErrUnsafePath)
+			return false
+		}
+		if hdr.Typeflag == tar.TypeLink && !cfg.unsafe {
+			if target, ok := cfg.relPath(hdr.Linkname); ok && unsafePath(target) {
+				it.err = fmt.Errorf("%s: hard link target %s: %w", hdr.Name, hdr.Linkname, ErrUnsafePath)
+				return false
+			}
+		}
+		if it.err = it.checkLimits(hdr); it.err != nil {
+			return false
+		}
+		it.hdr, it.path = hdr, name
+		return true
+	}
+}
+
+// Header returns header of the current entry. Sparse files of old GNU format
+// are reported as regular files.
+func (it *Iterator) Header() *tar.Header { return it.hdr }
+
+// Path returns clean slash-separated path of the current entry relative to
+// destination, after options like WithStripComponents are applied. It is
+// empty for entry referring to destination itself.
+func (it *Iterator) Path() string { return it.path }
+
+// Reader returns reader of the current entry contents.
+func (it *Iterator) Reader() io.Reader { return it.tr }
+
+// Err returns error that stopped iteration, if any.
+func (it *Iterator) Err() error { return it.err }
+
+// unsafePath reports whether clean relative path escapes its root. On systems
+// with other path separator than slash, names containing it or a volume name
+// are unsafe too, as joining them with destination may lead outside of it.
+func unsafePath(name string) bool {
+	if filepath.Separator != '/' && (strings.ContainsRune(name, filepath.Separator) || filepath.VolumeName(name) != "") {
+		return true
+	}
+	return name == ".." || strings.HasPrefix(name, "../")
+}
@@ -0,0 +1,64 @@
+package untar
+
+import (
+	"archive/tar"
+	"fmt"
+	"strings"
+)
+
+// WithKeepGoing makes Untar continue after entries it fails to extract, like
+// ones it has no permission to write, of unsupported types or with bad link
+// targets, instead of stopping on the first error. Once the rest of archive
+// is extracted, Untar returns EntryErrors listing failures. Errors reading
+// the archive itself still abort extraction.
+func WithKeepGoing() Option {
+	return func(c *config) { c.keepGoing = true }
+}
+
+// WithRemovePartial makes Untar remove regular files it fails to write in
+// full, like when extraction is cancelled or archive is truncated, instead of
+// leaving them partially written.
+func WithRemovePartial() Option {
+	return func(c *config) { c.removePartial = true }
+}
+
+// EntryErrors is returned by Untar used WithKeepGoing if some entries failed
+// to extract; each error describes a single entry.
+type EntryErrors []error
+
+func (e EntryErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d entries failed to extract:", len(e))
+	for _, err := range e {
+		b.WriteString("\n\t")
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+func (e EntryErrors) Unwrap() []error { return e }
+
+// entryFailed records error extracting entry hdr if extraction keeps going,
+// returning nil, otherwise it returns err
+func (c *config) entryFailed(hdr *tar.Header, err error) error {
+	if !c.keepGoing {
+		return err
+	}
+	if !strings.Contains(err.Error(), hdr.Name) {
+		err = fmt.Errorf("%s: %w", hdr.Name, err)
+	}
+	c.failed = append(c.failed, err)
+	c.stats.Failed++
+	return nil
+}
+
+// entryErrors returns errors recorded with entryFailed
+func (c *config) entryErrors() error {
+	if len(c.failed) == 0 {
+		return nil
+	}
+	return EntryErrors(c.failed)
+}
@@ -0,0 +1,45 @@
+package untar
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+)
+
+// ErrLimitExceeded is returned when archive exceeds one of limits set with
+// WithLimits.
+var ErrLimitExceeded = errors.New("archive exceeds extraction limit")
+
+// Limits restrict how much an archive may extract, protecting against archive
+// bombs: small archives expanding to huge number of files or amount of data.
+// Zero values mean no limit.
+type Limits struct {
+	Entries   int   // number of entries
+	FileSize  int64 // size of a single regular file
+	TotalSize int64 // total size of regular files
+}
+
+// WithLimits makes extraction stop with ErrLimitExceeded once archive is
+// found to exceed any of the limits. Limits are checked against entry headers
+// before entry contents are written, and apply to selected entries only.
+func WithLimits(l Limits) Option {
+	return func(c *config) { c.limits = l }
+}
+
+// checkLimits counts selected entry hdr against limits
+func (it *Iterator) checkLimits(hdr *tar.Header) error {
+	l := it.cfg.limits
+	it.entries++
+	if hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA {
+		it.total += hdr.Size
+	}
+	switch {
+	case l.Entries > 0 && it.entries > l.Entries:
+		return fmt.Errorf("%s: %w: over %d entries", hdr.Name, ErrLimitExceeded, l.Entries)
+	case l.FileSize > 0 && hdr.Size > l.FileSize && (hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA):
+		return fmt.Errorf("%s: %w: file size %d is over %d", hdr.Name, ErrLimitExceeded, hdr.Size, l.FileSize)
+	case l.TotalSize > 0 && it.total > l.TotalSize:
+		return fmt.Errorf("%s: %w: total size of files is over %d", hdr.Name, ErrLimitExceeded, l.TotalSize)
+	}
+	return nil
+}
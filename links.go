@@ -0,0 +1,106 @@
+package untar
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// pendingLink is hard link which target was not extracted yet when the link
+// entry was read, see linkLater
+type pendingLink struct {
+	hdr          *tar.Header
+	target, name string
+}
+
+// linkLater records hard link to create after the rest of archive is
+// extracted; archives may have links preceding their targets
+func (c *config) linkLater(hdr *tar.Header, target, name string) {
+	c.links = append(c.links, pendingLink{hdr: hdr, target: target, name: name})
+}
+
+// resolveLinks creates hard links recorded with linkLater
+func (c *config) resolveLinks() error {
+	links := c.links
+	c.links = nil
+	for _, l := range links {
+		var err error
+		if _, serr := c.fs.Lstat(l.target); os.IsNotExist(serr) {
+			err = fmt.Errorf("%s: hard link target %q is not extracted", l.hdr.Name, l.hdr.Linkname)
+		} else if err = c.hardlink(l.hdr, l.target, l.name); os.IsExist(err) {
+			if c.fs.Remove(l.name) == nil {
+				err = c.hardlink(l.hdr, l.target, l.name)
+			}
+		}
+		if err != nil {
+			if c.degraded("link", l.hdr.Name, err) {
+				c.stats.Skipped++
+				continue
+			}
+			if err := c.entryFailed(l.hdr, err); err != nil {
+				return err
+			}
+			continue
+		}
+		var ino uint64
+		if fi, err := c.fs.Lstat(l.name); err == nil {
+			ino = inode(fi)
+		}
+		c.stats.link(l.hdr.Linkname, l.hdr.Name, ino)
+		c.entryDone(Entry{Header: l.hdr, Path: l.name})
+	}
+	return nil
+}
+
+// hardlink creates hard link name to target. If file system doesn't allow
+// the link, target is copied instead with a warning.
+func (c *config) hardlink(hdr *tar.Header, target, name string) error {
+	err := c.link(target, name)
+	if err == nil || !c.onOS() || !linkDenied(err) {
+		return err
+	}
+	// only regular files are copied: os.Open follows symbolic links, which
+	// may point outside of destination
+	lfi, oerr := os.Lstat(target)
+	if oerr != nil || !lfi.Mode().IsRegular() {
+		return err
+	}
+	f, oerr := os.Open(target)
+	if oerr != nil {
+		return err
+	}
+	defer f.Close()
+	fi, oerr := f.Stat()
+	if oerr != nil || !os.SameFile(fi, lfi) {
+		return err
+	}
+	c.warn(fmt.Errorf("%s: cannot create hard link (%v), copying %s instead", hdr.Name, err, hdr.Linkname))
+	if _, _, err := c.writeFile(name, fi.Mode().Perm(), f, nil, false); err != nil {
+		return err
+	}
+	return c.fs.Chtimes(name, fi.ModTime(), fi.ModTime())
+}
+
+// linkDenied reports whether link error means that file system doesn't
+// permit the link, rather than that paths are wrong
+func linkDenied(err error) bool {
+	return errors.Is(err, syscall.EXDEV) ||
+		errors.Is(err, syscall.EMLINK) ||
+		errors.Is(err, syscall.EPERM) ||
+		errors.Is(err, syscall.EOPNOTSUPP)
+}
+
+// onOS reports whether extraction writes to the operating system file system
+func (c *config) onOS() bool {
+	fsys := c.fs
+	if r, ok := fsys.(*rollbackFS); ok {
+		fsys = r.fs
+	}
+	if a, ok := fsys.(*auditFS); ok {
+		fsys = a.fs
+	}
+	_, ok := fsys.(osFS)
+	return ok
+}
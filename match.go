@@ -0,0 +1,263 @@
+package untar
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// MatchMode controls how name patterns are matched against archive entry
+// names. Patterns are shell globs: "*" matches any sequence of characters,
+// "?" matches any single character, "[...]" matches a character class
+// ("[!...]" or "[^...]" negates it), backslash escapes the next character.
+// "**" matches any sequence of characters including "/", regardless of
+// WildcardsMatchSlash setting.
+//
+// A pattern matching a directory also matches everything inside it.
+type MatchMode struct {
+	// Anchored patterns must match the beginning of entry name. Unanchored
+	// patterns may match any trailing sequence of name elements, so "*.o"
+	// matches both "main.o" and "src/main.o".
+	Anchored bool
+	// WildcardsMatchSlash allows "*", "?" and character classes to match
+	// "/" separator.
+	WildcardsMatchSlash bool
+	// IgnoreCase makes matching case-insensitive.
+	IgnoreCase bool
+}
+
+// DefaultMatchMode is used for exclude patterns unless overridden with
+// WithMatchMode; it follows GNU tar defaults for exclusion patterns.
+var DefaultMatchMode = MatchMode{WildcardsMatchSlash: true}
+
+// ErrBadPattern is returned when pattern is malformed.
+var ErrBadPattern = errors.New("syntax error in pattern")
+
+// pattern is a glob matched against entry names according to its mode
+type pattern struct {
+	glob string
+	mode MatchMode
+}
+
+func newPattern(glob string, mode MatchMode) (*pattern, error) {
+	glob = strings.TrimRight(strings.TrimLeft(glob, "/"), "/")
+	if strings.HasPrefix(glob, "./") {
+		glob = glob[2:]
+	}
+	if mode.IgnoreCase {
+		glob = strings.ToLower(glob)
+	}
+	if err := validateGlob(glob); err != nil {
+		return nil, err
+	}
+	return &pattern{glob: glob, mode: mode}, nil
+}
+
+// match reports whether pattern matches name or any of its parent
+// directories, honoring pattern mode
+func (p *pattern) match(name string) bool {
+	name = cleanName(name)
+	if name == "" {
+		return false
+	}
+	if p.mode.IgnoreCase {
+		name = strings.ToLower(name)
+	}
+	for {
+		if p.matchLeading(name) {
+			return true
+		}
+		if p.mode.Anchored {
+			return false
+		}
+		i := strings.IndexByte(name, '/')
+		if i < 0 {
+			return false
+		}
+		name = name[i+1:]
+	}
+}
+
+// matchExact reports whether pattern matches the whole name
+func (p *pattern) matchExact(name string) bool {
+	name = cleanName(name)
+	if p.mode.IgnoreCase {
+		name = strings.ToLower(name)
+	}
+	return name != "" && globMatch(p.glob, name, p.mode.WildcardsMatchSlash)
+}
+
+// matchLeading reports whether pattern matches name or any of its leading
+// directory prefixes
+func (p *pattern) matchLeading(name string) bool {
+	for i := 1; i <= len(name); i++ {
+		if i < len(name) && name[i] != '/' {
+			continue
+		}
+		if globMatch(p.glob, name[:i], p.mode.WildcardsMatchSlash) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateGlob(glob string) error {
+	for i := 0; i < len(glob); i++ {
+		switch glob[i] {
+		case '\\':
+			if i++; i == len(glob) {
+				return ErrBadPattern
+			}
+		case '[':
+			_, n, ok := matchClass(glob[i:], 0)
+			if !ok {
+				return ErrBadPattern
+			}
+			i += n - 1
+		}
+	}
+	return nil
+}
+
+// globMatch reports whether name matches glob; if slash is false, wildcards
+// do not match '/'
+func globMatch(glob, name string, slash bool) bool {
+	// star records position after the last '*' seen and position in name
+	// it is currently assumed to match up to, for backtracking
+	starGlob, starName := -1, 0
+	starSlash := slash // whether the last star matches '/'
+	// the same for the last star matching '/', which takes over once
+	// the last star can't
+	slashGlob, slashName := -1, 0
+	gi, ni := 0, 0
+	for ni < len(name) || gi < len(glob) {
+		if gi < len(glob) {
+			switch c := glob[gi]; c {
+			case '*':
+				starSlash = slash
+				if gi+1 < len(glob) && glob[gi+1] == '*' {
+					starSlash = true
+					gi++
+				}
+				starGlob, starName = gi+1, ni
+				if starSlash {
+					slashGlob, slashName = starGlob, starName
+				}
+				gi++
+				continue
+			case '?':
+				if ni < len(name) {
+					r, size := utf8.DecodeRuneInString(name[ni:])
+					if slash || r != '/' {
+						gi++
+						ni += size
+						continue
+					}
+				}
+			case '[':
+				if ni < len(name) {
+					r, size := utf8.DecodeRuneInString(name[ni:])
+					if ok, n, _ := matchClass(glob[gi:], r); ok && (slash || r != '/') {
+						gi += n
+						ni += size
+						continue
+					}
+				}
+			case '\\':
+				if gi+1 < len(glob) && ni < len(name) && name[ni] == glob[gi+1] {
+					gi += 2
+					ni++
+					continue
+				}
+			default:
+				if ni < len(name) && name[ni] == c {
+					gi++
+					ni++
+					continue
+				}
+			}
+		}
+		// mismatch: let the last star consume one more character
+		if starGlob >= 0 && starName < len(name) && (starSlash || name[starName] != '/') {
+			_, size := utf8.DecodeRuneInString(name[starName:])
+			starName += size
+			if starSlash {
+				slashName = starName
+			}
+			gi, ni = starGlob, starName
+			continue
+		}
+		if slashGlob < 0 || slashName >= len(name) {
+			return false
+		}
+		_, size := utf8.DecodeRuneInString(name[slashName:])
+		slashName += size
+		starGlob, starName, starSlash = slashGlob, slashName, true
+		gi, ni = starGlob, starName
+	}
+	return true
+}
+
+// matchClass matches rune r against character class at the start of glob,
+// returning whether it matched, length of class in glob and whether class is
+// well-formed
+func matchClass(glob string, r rune) (matched bool, n int, ok bool) {
+	i := 1 // skip '['
+	negate := false
+	if i < len(glob) && (glob[i] == '!' || glob[i] == '^') {
+		negate = true
+		i++
+	}
+	for first := true; ; first = false {
+		if i >= len(glob) {
+			return false, 0, false
+		}
+		if glob[i] == ']' && !first {
+			return matched != negate, i + 1, true
+		}
+		lo, size, err := classChar(glob[i:])
+		if err != nil {
+			return false, 0, false
+		}
+		i += size
+		hi := lo
+		if i+1 < len(glob) && glob[i] == '-' && glob[i+1] != ']' {
+			if hi, size, err = classChar(glob[i+1:]); err != nil {
+				return false, 0, false
+			}
+			i += 1 + size
+		}
+		if lo <= r && r <= hi {
+			matched = true
+		}
+	}
+}
+
+func classChar(s string) (rune, int, error) {
+	n := 0
+	if s[0] == '\\' {
+		if len(s) == 1 {
+			return 0, 0, ErrBadPattern
+		}
+		n = 1
+	}
+	r, size := utf8.DecodeRuneInString(s[n:])
+	return r, n + size, nil
+}
+
+// ReadPatterns reads patterns from r, one per line. Empty lines and lines
+// starting with # are ignored.
+func ReadPatterns(r io.Reader) ([]string, error) {
+	var out []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out, sc.Err()
+}
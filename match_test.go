@@ -0,0 +1,160 @@
+package untar
+
+import (
+	"archive/tar"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGlobMatch(t *testing.T) {
+	for _, tc := range []struct {
+		glob, name string
+		slash      bool // wildcards match slash
+		want       bool
+	}{
+		{"*.o", "main.o", false, true},
+		{"*.o", "src/main.o", false, false},
+		{"*.o", "src/main.o", true, true},
+		{"**.o", "src/main.o", false, true},
+		{"docs/**", "docs/a/b.txt", false, true},
+		{"docs/**/*.md", "docs/a/b/c.md", false, true},
+		{"docs/**/*.md", "docs/a/b/c.txt", false, false},
+		{"a?c", "abc", false, true},
+		{"a?c", "a/c", false, false},
+		{"a?c", "a/c", true, true},
+		{"a?c", "ac", false, false},
+		{"[a-c]x", "bx", false, true},
+		{"[a-c]x", "dx", false, false},
+		{"[!a-c]x", "dx", false, true},
+		{"[^a-c]x", "ax", false, false},
+		{"[]]", "]", false, true},
+		{"a[/]b", "a/b", false, false},
+		{`\*`, "*", false, true},
+		{`\*`, "x", false, false},
+		{"файл*", "файл.txt", false, true},
+		{"?", "ж", false, true},
+		{"*", "", false, true},
+		{"", "", false, true},
+		{"a*b*c", "axxbyyc", false, true},
+		{"a*b*c", "axxbyy", false, false},
+		{"**/x/*.go", "a/x/b/x/c.go", false, true},
+		{"**/x/*.go", "a/x/b/c.go", false, false},
+		{"a/**/b*/c", "a/b1/b2/c", false, true},
+		{"a/**", "a", false, false},
+	} {
+		if got := globMatch(tc.glob, tc.name, tc.slash); got != tc.want {
+			t.Errorf("globMatch(%q, %q, %v) = %v, want %v", tc.glob, tc.name, tc.slash, got, tc.want)
+		}
+	}
+}
+
+func TestBadPattern(t *testing.T) {
+	for _, glob := range []string{"[", "[a", "[a-", "a\\", "[\\"} {
+		if _, err := newPattern(glob, MatchMode{}); !errors.Is(err, ErrBadPattern) {
+			t.Errorf("pattern %q: got error %v, want %v", glob, err, ErrBadPattern)
+		}
+	}
+}
+
+func TestPatternMatch(t *testing.T) {
+	anchored := MatchMode{Anchored: true}
+	for _, tc := range []struct {
+		glob string
+		mode MatchMode
+		name string
+		want bool
+	}{
+		{"*.o", MatchMode{}, "src/main.o", true},
+		{"*.o", anchored, "src/main.o", false},
+		{"src", anchored, "src/main.o", true},
+		{"src", anchored, "./src/main.o", true},
+		{"/src/", anchored, "src", true},
+		{"./src", anchored, "src/main.o", true},
+		{"src", anchored, "srcs/main.o", false},
+		{"main.o", MatchMode{}, "src/main.o", true},
+		{"main.o", anchored, "src/main.o", false},
+		{"SRC", MatchMode{IgnoreCase: true}, "src/Main.o", true},
+		{"SRC", MatchMode{}, "src/Main.o", false},
+		{"*", anchored, ".", false},
+	} {
+		p, err := newPattern(tc.glob, tc.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.match(tc.name); got != tc.want {
+			t.Errorf("pattern %q with %+v matching %q = %v, want %v", tc.glob, tc.mode, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestIncludeExclude(t *testing.T) {
+	names := []string{"docs/", "docs/a.md", "docs/sub/b.md", "docs/x.o", "src/main.go", "src/main.o", "README.md"}
+	for _, tc := range []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{
+			name: "include",
+			opts: []Option{WithInclude("docs/**")},
+			want: []string{"docs/a.md", "docs/sub/b.md", "docs/x.o"},
+		},
+		{
+			name: "include directory",
+			opts: []Option{WithInclude("docs")},
+			want: []string{"docs/", "docs/a.md", "docs/sub/b.md", "docs/x.o"},
+		},
+		{
+			name: "include is anchored",
+			opts: []Option{WithInclude("*.md"), WithMatchMode(MatchMode{})},
+			want: []string{"README.md"},
+		},
+		{
+			name: "wildcards match slash by default",
+			opts: []Option{WithInclude("*.md")},
+			want: []string{"docs/a.md", "docs/sub/b.md", "README.md"},
+		},
+		{
+			name: "exclude on top of include",
+			opts: []Option{WithInclude("docs/**"), WithExclude("*.o")},
+			want: []string{"docs/a.md", "docs/sub/b.md"},
+		},
+		{
+			name: "exclude unanchored by default",
+			opts: []Option{WithExclude("*.o", "sub")},
+			want: []string{"docs/", "docs/a.md", "src/main.go", "README.md"},
+		},
+		{
+			name: "several includes",
+			opts: []Option{WithInclude("src/*.go", "README.md")},
+			want: []string{"src/main.go", "README.md"},
+		},
+		{
+			name: "include matching nothing",
+			opts: []Option{WithInclude("nothing")},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var hdrs []*tar.Header
+			for _, name := range names {
+				typ := byte(tar.TypeReg)
+				if strings.HasSuffix(name, "/") {
+					typ = tar.TypeDir
+				}
+				hdrs = append(hdrs, &tar.Header{Name: name, Typeflag: typ})
+			}
+			it := NewIterator(tarball(t, hdrs...), tc.opts...)
+			var got []string
+			for it.Next() {
+				got = append(got, it.Header().Name)
+			}
+			if err := it.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if !equal(got, tc.want) {
+				t.Errorf("got entries %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
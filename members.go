@@ -0,0 +1,127 @@
+package untar
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotFound is returned when some of members given to WithMembers are not
+// found in the archive.
+var ErrNotFound = errors.New("not found in archive")
+
+// WithMembers restricts extraction to entries named by arguments, which may
+// be glob patterns (see MatchMode) matched against the whole entry name. An
+// entry matching a directory selects everything inside it, unless
+// WithOccurrence is used. Directory entries leading to members are extracted
+// too. Patterns are always anchored; other matching settings come from
+// WithMatchMode. If some member is not found by the end of archive, Untar
+// fails with ErrNotFound.
+func WithMembers(names ...string) Option {
+	return func(c *config) { c.memberNames = append(c.memberNames, names...) }
+}
+
+// WithOccurrence makes Untar extract only the n-th occurrence of each member
+// given to WithMembers, and stop reading archive once all members without
+// wildcards were found n times. With this option, members only select
+// entries with exactly matching names. Useful to avoid reading the whole
+// archive when only a few early entries are needed.
+func WithOccurrence(n int) Option {
+	return func(c *config) { c.occurrence = n }
+}
+
+// memberSet tracks entries selected with WithMembers
+type memberSet struct {
+	names      []string
+	patterns   []*pattern
+	counts     []int
+	occurrence int
+	wildcards  bool // some patterns have wildcards
+}
+
+func newMemberSet(names []string, mode MatchMode, occurrence int) (*memberSet, error) {
+	mode.Anchored = true
+	m := &memberSet{names: names, counts: make([]int, len(names)), occurrence: occurrence}
+	for _, name := range names {
+		p, err := newPattern(name, mode)
+		if err != nil {
+			return nil, fmt.Errorf("member %q: %w", name, err)
+		}
+		m.patterns = append(m.patterns, p)
+		if strings.ContainsAny(p.glob, `*?[\`) {
+			m.wildcards = true
+		}
+	}
+	return m, nil
+}
+
+// selected reports whether entry is to be extracted
+func (m *memberSet) selected(hdr *tar.Header) bool {
+	for i, p := range m.patterns {
+		if m.occurrence <= 0 {
+			if p.match(hdr.Name) {
+				m.counts[i]++
+				return true
+			}
+			continue
+		}
+		if !p.matchExact(hdr.Name) {
+			continue
+		}
+		m.counts[i]++
+		if m.counts[i] == m.occurrence {
+			return true
+		}
+	}
+	return hdr.Typeflag == tar.TypeDir && m.parent(hdr.Name)
+}
+
+// done reports whether no more entries can be selected with occurrence set
+func (m *memberSet) done() bool {
+	if m.occurrence <= 0 || m.wildcards {
+		return false
+	}
+	for _, n := range m.counts {
+		if n < m.occurrence {
+			return false
+		}
+	}
+	return true
+}
+
+// parent reports whether directory name leads to some of the members, judging
+// by the literal prefix of patterns
+func (m *memberSet) parent(name string) bool {
+	name = cleanName(name)
+	if name == "" {
+		return false
+	}
+	for _, p := range m.patterns {
+		prefix := p.glob
+		if p.mode.IgnoreCase {
+			name = strings.ToLower(name)
+		}
+		if i := strings.IndexAny(prefix, `*?[\`); i >= 0 {
+			prefix = prefix[:i]
+		}
+		if strings.HasPrefix(prefix, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// missing returns ErrNotFound listing members that were not found
+func (m *memberSet) missing() error {
+	var names []string
+	for i := range m.patterns {
+		if m.counts[i] == 0 || m.counts[i] < m.occurrence {
+			names = append(names, m.names[i])
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", strings.Join(names, ", "), ErrNotFound)
+}
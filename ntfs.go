@@ -0,0 +1,46 @@
+package untar
+
+import "os"
+
+// WithNTFSPermissions makes Untar on Windows translate permissions of
+// extracted files and directories to NTFS access control lists, replacing
+// inherited ones: read, write and execute bits of owner, group and others
+// become access allowed entries for file owner, its group and Everyone; owner
+// may always change permissions, as on Unix. If user and group names of an
+// entry are accounts known to the system, they become owner and group of the
+// file where the process is permitted to assign them (this takes
+// SeRestorePrivilege). Symbolic links are left as is. The option has no
+// effect on other platforms and with WithFS.
+func WithNTFSPermissions() Option {
+	return func(c *config) { c.ntfsPerms = true }
+}
+
+// ntfsSDDL returns security descriptor string with access control list
+// matching permission bits of mode, see WithNTFSPermissions; group is string
+// form of group SID, if empty, group permissions are not granted
+func ntfsSDDL(mode os.FileMode, group string) string {
+	rights := func(bits os.FileMode) string {
+		var s string
+		if bits&4 != 0 {
+			s += "FR"
+		}
+		if bits&2 != 0 {
+			s += "FW"
+		}
+		if bits&1 != 0 {
+			s += "FX"
+		}
+		return s
+	}
+	// OW is "owner rights" principal, which takes over implicit rights
+	// of owner to read and change permissions, so they are granted
+	// explicitly
+	sddl := "D:P(A;;RCWD" + rights(mode>>6&7) + ";;;OW)"
+	if r := rights(mode >> 3 & 7); r != "" && group != "" {
+		sddl += "(A;;" + r + ";;;" + group + ")"
+	}
+	if r := rights(mode & 7); r != "" {
+		sddl += "(A;;" + r + ";;;WD)"
+	}
+	return sddl
+}
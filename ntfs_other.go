@@ -0,0 +1,11 @@
+//go:build !windows
+// +build !windows
+
+package untar
+
+import (
+	"archive/tar"
+	"os"
+)
+
+func setNTFSPermissions(name string, hdr *tar.Header, mode os.FileMode) error { return nil }
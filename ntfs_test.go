@@ -0,0 +1,26 @@
+package untar
+
+import (
+	"os"
+	"testing"
+)
+
+func TestNTFSSDDL(t *testing.T) {
+	const group = "S-1-5-32-545"
+	for _, tc := range []struct {
+		mode  os.FileMode
+		group string
+		want  string
+	}{
+		{0644, group, "D:P(A;;RCWDFRFW;;;OW)(A;;FR;;;" + group + ")(A;;FR;;;WD)"},
+		{0755, group, "D:P(A;;RCWDFRFWFX;;;OW)(A;;FRFX;;;" + group + ")(A;;FRFX;;;WD)"},
+		{0600, group, "D:P(A;;RCWDFRFW;;;OW)"},
+		{0640, "", "D:P(A;;RCWDFRFW;;;OW)"},
+		{0004, group, "D:P(A;;RCWD;;;OW)(A;;FR;;;WD)"},
+		{os.ModeDir | 0750, group, "D:P(A;;RCWDFRFWFX;;;OW)(A;;FRFX;;;" + group + ")"},
+	} {
+		if got := ntfsSDDL(tc.mode, tc.group); got != tc.want {
+			t.Errorf("ntfsSDDL(%v, %q):\ngot  %s\nwant %s", tc.mode, tc.group, got, tc.want)
+		}
+	}
+}
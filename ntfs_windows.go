@@ -0,0 +1,71 @@
+//go:build windows
+// +build windows
+
+package untar
+
+import (
+	"archive/tar"
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// setNTFSPermissions replaces access control list of file name with one
+// matching permission bits of mode, setting its owner and group from hdr
+// where possible, see WithNTFSPermissions
+func setNTFSPermissions(name string, hdr *tar.Header, mode os.FileMode) error {
+	owner, group := accountSID(hdr.Uname), accountSID(hdr.Gname)
+	groupSID := group
+	if groupSID == nil {
+		sd, err := windows.GetNamedSecurityInfo(name, windows.SE_FILE_OBJECT, windows.GROUP_SECURITY_INFORMATION)
+		if err != nil {
+			return &os.PathError{Op: "getacl", Path: name, Err: err}
+		}
+		if groupSID, _, err = sd.Group(); err != nil {
+			return &os.PathError{Op: "getacl", Path: name, Err: err}
+		}
+	}
+	var groupStr string
+	if groupSID != nil {
+		groupStr = groupSID.String()
+	}
+	sd, err := windows.SecurityDescriptorFromString(ntfsSDDL(mode, groupStr))
+	if err != nil {
+		return err
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return err
+	}
+	info := windows.SECURITY_INFORMATION(windows.DACL_SECURITY_INFORMATION | windows.PROTECTED_DACL_SECURITY_INFORMATION)
+	if owner != nil {
+		info |= windows.OWNER_SECURITY_INFORMATION
+	}
+	if group != nil {
+		info |= windows.GROUP_SECURITY_INFORMATION
+	}
+	err = windows.SetNamedSecurityInfo(name, windows.SE_FILE_OBJECT, info, owner, group, dacl, nil)
+	if err != nil && (owner != nil || group != nil) &&
+		(errors.Is(err, windows.ERROR_INVALID_OWNER) || errors.Is(err, windows.ERROR_ACCESS_DENIED) || errors.Is(err, windows.ERROR_PRIVILEGE_NOT_HELD)) {
+		// not permitted to assign these accounts, keep the current ones
+		info &^= windows.OWNER_SECURITY_INFORMATION | windows.GROUP_SECURITY_INFORMATION
+		err = windows.SetNamedSecurityInfo(name, windows.SE_FILE_OBJECT, info, nil, nil, dacl, nil)
+	}
+	if err != nil {
+		return &os.PathError{Op: "setacl", Path: name, Err: err}
+	}
+	return nil
+}
+
+// accountSID returns SID of named account, nil if it is unknown
+func accountSID(name string) *windows.SID {
+	if name == "" {
+		return nil
+	}
+	sid, _, _, err := windows.LookupSID("", name)
+	if err != nil {
+		return nil
+	}
+	return sid
+}
@@ -0,0 +1,384 @@
+package untar
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Option modifies behavior of Untar.
+type Option func(*config)
+
+// config holds settings gathered from options
+type config struct {
+	filters []func(*tar.Header) bool
+	strip   int
+	subdir  string
+
+	transformExprs []string
+	transforms     []*transform
+
+	keepDirSymlink bool
+	symlinks       int // one of symlinks* constants
+
+	unsafe   bool
+	safeDirs map[string]bool // real directories checked by checkPath
+
+	newSymlinks map[string]bool // symbolic links created by Untar, see checkPath
+
+	matchMode MatchMode
+	includes  []string
+	include   []*pattern // compiled includes
+	excludes  []string
+	presets   []string   // excludes always matched unanchored
+	exclude   []*pattern // compiled excludes
+
+	memberNames []string
+	occurrence  int
+	members     *memberSet // nil if all entries are extracted
+
+	whiteouts  bool
+	overlay    bool            // whiteouts in overlayfs format
+	layerPaths map[string]bool // paths extracted with whiteouts enabled
+
+	bufSize   int
+	trailing  TrailingData
+	zeros     bool // see WithIgnoreZeros
+	overwrite Overwrite
+	strict    bool
+
+	dryRun  bool
+	planned map[string]plannedEntry // entries seen in dry-run mode, by path
+	verify  bool
+	digests bool
+
+	skipIdentical   bool
+	compareContents bool
+
+	dirs  map[string]pendingDir // directories to restore metadata of
+	links []pendingLink         // hard links to targets not extracted yet
+
+	baseline  string
+	extracted map[string]bool // paths of extracted entries, with baseline
+
+	xattrs     bool
+	selinux    bool
+	noSpecial  bool
+	permMask   os.FileMode
+	exactPerms bool
+	ntfsPerms  bool // see WithNTFSPermissions
+	noOwner    bool
+	uidMap     []IDMap // see WithIDMap
+	gidMap     []IDMap
+	names      *nameCache // see WithOwnerNames
+	rollback   bool       // see WithRollback
+	fixedOwner bool       // see WithOwner
+	uid, gid   int
+
+	bestEffort bool
+	failedOps  map[string]bool // operations failed in best-effort mode
+
+	limits        Limits
+	spaceCheck    bool
+	spaceNeed     int64  // total size of files, see WithSpaceCheck
+	spaceFree     int64  // estimate of free space left
+	spaceDir      string // directory free space is queried for
+	keepGoing     bool
+	removePartial bool
+	failed        []error // entries failed to extract, see WithKeepGoing
+
+	workers int
+	mu      sync.Mutex // guards failedOps and warnings reported by workers
+
+	fs        WriteFS
+	audit     *auditLog
+	backupDir string
+
+	stats     *Stats
+	warnFunc  func(error)
+	entryFunc []func(Entry)
+
+	progressFunc []func(Progress)
+	input        *countingReader // tar stream, set if progress is reported
+
+	decoderMemory int64 // see WithDecoderMemory
+}
+
+func newConfig(opts []Option) (*config, error) {
+	cfg := &config{matchMode: DefaultMatchMode, trailing: TrailingIgnore, overwrite: OverwriteAlways, fs: osFS{}}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if err := cfg.checkFS(); err != nil {
+		return nil, err
+	}
+	if cfg.baseline != "" && cfg.dryRun {
+		return nil, errors.New("baseline cannot be used in dry-run mode")
+	}
+	if cfg.audit != nil && !cfg.dryRun {
+		cfg.fs = &auditFS{fs: cfg.fs, log: cfg.audit, backupDir: cfg.backupDir}
+	}
+	if cfg.rollback && !cfg.dryRun {
+		cfg.fs = &rollbackFS{fs: cfg.fs}
+	}
+	switch cfg.trailing {
+	case TrailingIgnore, TrailingWarn, TrailingError:
+	default:
+		return nil, fmt.Errorf("unsupported trailing data policy %q", cfg.trailing)
+	}
+	switch cfg.overwrite {
+	case OverwriteAlways, OverwriteNever, OverwriteKeepNewer, OverwriteError:
+	default:
+		return nil, fmt.Errorf("unsupported overwrite policy %q", cfg.overwrite)
+	}
+	for _, s := range cfg.includes {
+		p, err := newPattern(s, MatchMode{
+			Anchored:            true,
+			WildcardsMatchSlash: cfg.matchMode.WildcardsMatchSlash,
+			IgnoreCase:          cfg.matchMode.IgnoreCase,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("include pattern %q: %w", s, err)
+		}
+		cfg.include = append(cfg.include, p)
+	}
+	for _, s := range cfg.excludes {
+		p, err := newPattern(s, cfg.matchMode)
+		if err != nil {
+			return nil, fmt.Errorf("exclude pattern %q: %w", s, err)
+		}
+		cfg.exclude = append(cfg.exclude, p)
+	}
+	for _, s := range cfg.presets {
+		p, err := newPattern(s, MatchMode{IgnoreCase: cfg.matchMode.IgnoreCase})
+		if err != nil {
+			return nil, fmt.Errorf("exclude pattern %q: %w", s, err)
+		}
+		cfg.exclude = append(cfg.exclude, p)
+	}
+	if len(cfg.memberNames) != 0 {
+		m, err := newMemberSet(cfg.memberNames, cfg.matchMode, cfg.occurrence)
+		if err != nil {
+			return nil, err
+		}
+		cfg.members = m
+	}
+	for _, s := range cfg.transformExprs {
+		t, err := parseTransform(s)
+		if err != nil {
+			return nil, err
+		}
+		cfg.transforms = append(cfg.transforms, t)
+	}
+	cfg.subdir = cleanName(cfg.subdir)
+	if cfg.stats == nil {
+		cfg.stats = &Stats{}
+	}
+	return cfg, nil
+}
+
+// WithFilter adds a function deciding whether archive entry should be
+// extracted; entries for which any of the filters return false are skipped.
+// Filters must not modify headers.
+func WithFilter(fn func(hdr *tar.Header) bool) Option {
+	return func(c *config) { c.filters = append(c.filters, fn) }
+}
+
+// WithStripComponents removes n leading path elements from entry names (and
+// hard link targets) before extraction, like GNU tar --strip-components;
+// entries that have no path elements left are skipped.
+func WithStripComponents(n int) Option {
+	return func(c *config) { c.strip = n }
+}
+
+// WithSubdir extracts only entries inside directory dir of the archive,
+// removing dir prefix from their names, so that directory contents end up
+// right in the destination. It is applied before WithStripComponents.
+func WithSubdir(dir string) Option {
+	return func(c *config) { c.subdir = dir }
+}
+
+// WithKeepDirectorySymlink preserves existing symlinks to directories when
+// archive has directory entries with the same names, extracting directory
+// contents through such symlinks (GNU tar --keep-directory-symlink). By
+// default symlink is replaced with a real directory.
+func WithKeepDirectorySymlink() Option {
+	return func(c *config) { c.keepDirSymlink = true }
+}
+
+// WithExactPermissions makes Untar set permissions of extracted entries
+// exactly as stored in archive, ignoring umask (see also WithPermissionMask).
+// Entries are created accessible only to the owner and get their permissions
+// with chmod once written; existing files get permissions of archive entries
+// too. Unlike changing umask, this is safe to use in programs creating files
+// concurrently.
+func WithExactPermissions() Option {
+	return func(c *config) { c.exactPerms = true }
+}
+
+// WithExclude skips entries with names matching any of the given patterns,
+// see MatchMode for pattern syntax.
+func WithExclude(patterns ...string) Option {
+	return func(c *config) { c.excludes = append(c.excludes, patterns...) }
+}
+
+// WithInclude extracts only entries with names matching any of the given
+// patterns; exclude patterns are applied on top of it. Patterns are always
+// anchored, other matching settings come from WithMatchMode, see MatchMode
+// for syntax. Unlike WithMembers, patterns that match nothing are not an
+// error.
+func WithInclude(patterns ...string) Option {
+	return func(c *config) { c.includes = append(c.includes, patterns...) }
+}
+
+// VCSPatterns match files and directories of version control systems, as
+// skipped by GNU tar --exclude-vcs.
+var VCSPatterns = []string{
+	"CVS", ".cvsignore",
+	"RCS", "SCCS",
+	".git", ".gitignore", ".gitattributes", ".gitmodules",
+	".arch-ids", "{arch}", "=RELEASE-ID", "=meta-update", "=update",
+	".bzr", ".bzrignore", ".bzrtags",
+	".hg", ".hgignore", ".hgtags",
+	"_darcs",
+	".svn",
+}
+
+// BackupPatterns match editor backup and lock files, as skipped by GNU tar
+// --exclude-backups.
+var BackupPatterns = []string{".#*", "*~", "#*#"}
+
+// WithExcludeVCS skips entries matching VCSPatterns at any directory level,
+// regardless of MatchMode.Anchored setting.
+func WithExcludeVCS() Option {
+	return func(c *config) { c.presets = append(c.presets, VCSPatterns...) }
+}
+
+// WithExcludeBackups skips entries matching BackupPatterns at any directory
+// level, regardless of MatchMode.Anchored setting.
+func WithExcludeBackups() Option {
+	return func(c *config) { c.presets = append(c.presets, BackupPatterns...) }
+}
+
+// WithMatchMode sets how patterns are matched against entry names, overriding
+// DefaultMatchMode.
+func WithMatchMode(m MatchMode) Option {
+	return func(c *config) { c.matchMode = m }
+}
+
+// WithBufferSize sets the size of buffer used to copy file contents; by
+// default buffers of 512 KiB are taken from a shared pool. Use it to reduce
+// memory footprint in constrained environments.
+func WithBufferSize(n int) Option {
+	return func(c *config) {
+		if n == defaultBufSize {
+			n = 0
+		}
+		c.bufSize = n
+	}
+}
+
+// Entry describes archive entry processed by Untar.
+type Entry struct {
+	Header *tar.Header
+	Path   string // file system path entry was extracted to
+
+	// Actions is the list of changes extraction would make, starting with
+	// the primary one; only filled in dry-run mode, see WithDryRun.
+	Actions []Action
+
+	// Unchanged is set if existing file was left intact as identical to
+	// the entry, see WithSkipIdentical.
+	Unchanged bool
+
+	// Digest is SHA-256 hash of regular file data as read from archive;
+	// only filled with WithDigests.
+	Digest []byte
+}
+
+// WithEntryFunc registers a function called after each archive entry is
+// extracted. Functions are called in the order they were registered.
+func WithEntryFunc(fn func(Entry)) Option {
+	return func(c *config) { c.entryFunc = append(c.entryFunc, fn) }
+}
+
+// entryDone updates statistics and calls entry callbacks
+func (c *config) entryDone(e Entry) {
+	c.stats.count(e.Header)
+	if c.extracted != nil {
+		c.extracted[e.Path] = true
+	}
+	for _, fn := range c.entryFunc {
+		fn(e)
+	}
+	if len(c.progressFunc) != 0 {
+		c.progress(e.Header.Name)
+	}
+}
+
+// destPath returns file system path for archive entry name, reporting false
+// if entry has to be skipped, see relPath
+func (c *config) destPath(dst, name string) (string, bool) {
+	rel, ok := c.relPath(name)
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(dst, filepath.FromSlash(rel)), true
+}
+
+// relPath returns slash-separated path of entry name relative to destination,
+// reporting false if entry has to be skipped as it's outside of subdirectory
+// or has no path elements left after transforming or stripping
+func (c *config) relPath(name string) (string, bool) {
+	if len(c.transforms) != 0 {
+		if name = c.transformName(name); name == "" {
+			return "", false
+		}
+	}
+	rel := cleanName(name)
+	if c.subdir != "" {
+		var ok bool
+		if rel, ok = trimSubdir(rel, c.subdir); !ok {
+			return "", false
+		}
+	}
+	rel = stripComponents(rel, c.strip)
+	if rel == "" && c.strip > 0 {
+		return "", false
+	}
+	return rel, true
+}
+
+// selected reports whether entry passes all filters
+func (c *config) selected(hdr *tar.Header) bool {
+	if c.noSpecial && isSpecial(hdr) {
+		return false
+	}
+	if len(c.include) != 0 && !c.included(hdr.Name) {
+		return false
+	}
+	for _, p := range c.exclude {
+		if p.match(hdr.Name) {
+			return false
+		}
+	}
+	for _, fn := range c.filters {
+		if !fn(hdr) {
+			return false
+		}
+	}
+	return c.members == nil || c.members.selected(hdr)
+}
+
+// included reports whether name matches any of include patterns
+func (c *config) included(name string) bool {
+	for _, p := range c.include {
+		if p.match(name) {
+			return true
+		}
+	}
+	return false
+}
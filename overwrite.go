@@ -0,0 +1,45 @@
+package untar
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+)
+
+// Overwrite controls what Untar does when archive entry other than directory
+// would replace an existing file, see WithOverwrite. Existing directories are
+// always merged with archive contents.
+type Overwrite string
+
+const (
+	OverwriteAlways    Overwrite = "always"           // replace existing files
+	OverwriteNever     Overwrite = "never"            // keep existing files, skipping entries
+	OverwriteKeepNewer Overwrite = "keep-newer-files" // keep existing files newer than entries
+	OverwriteError     Overwrite = "error"            // fail with error wrapping os.ErrExist
+)
+
+// WithOverwrite sets how existing files are treated, by default
+// (OverwriteAlways) they are replaced. Entries skipped because of this policy
+// are counted in Stats.Skipped.
+func WithOverwrite(policy Overwrite) Option {
+	return func(c *config) { c.overwrite = policy }
+}
+
+// keepExisting reports whether existing file at path name has to be kept
+// instead of extracting entry over it, according to overwrite policy
+func (c *config) keepExisting(name string, hdr *tar.Header) (bool, error) {
+	if c.overwrite == OverwriteAlways || hdr.Typeflag == tar.TypeDir {
+		return false, nil
+	}
+	fi, err := c.fs.Lstat(name)
+	if err != nil {
+		return false, nil
+	}
+	switch c.overwrite {
+	case OverwriteNever:
+		return true, nil
+	case OverwriteKeepNewer:
+		return fi.ModTime().After(hdr.ModTime), nil
+	}
+	return false, fmt.Errorf("%s: %w", hdr.Name, os.ErrExist)
+}
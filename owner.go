@@ -0,0 +1,144 @@
+package untar
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+)
+
+// IDMap maps a range of user or group ids, in the same way as lines of
+// /proc/PID/uid_map do: archive ids ContainerID to ContainerID+Size-1 are
+// restored as host ids HostID to HostID+Size-1.
+type IDMap struct {
+	ContainerID int
+	HostID      int
+	Size        int
+}
+
+// ErrUnmappedID is returned for entries owned by user or group id not covered
+// by mappings given to WithIDMap.
+var ErrUnmappedID = errors.New("owner id is not mapped")
+
+// WithIDMap shifts ownership of extracted entries into host id ranges, like
+// those allocated to a user namespace, so that container root file system is
+// extracted owned by its namespace. Nil uids or gids leave corresponding ids
+// as is. Entries owned by ids outside of given ranges fail with
+// ErrUnmappedID. Ownership is only restored if run as root.
+func WithIDMap(uids, gids []IDMap) Option {
+	return func(c *config) { c.uidMap, c.gidMap = uids, gids }
+}
+
+// WithOwnerNames makes Untar restore ownership by user and group names stored
+// in archive, looking them up on the local system, so that archives moved
+// between machines with different id assignments end up owned by the right
+// accounts. Numeric ids are used for names that are empty or not found, and
+// only they are subject to WithIDMap.
+func WithOwnerNames() Option {
+	return func(c *config) { c.names = &nameCache{} }
+}
+
+// WithOwner makes all extracted entries owned by given user and group ids,
+// like when unpacking into a service account's directory; -1 keeps
+// corresponding id from archive, or, if not run as root, id of the current
+// process. Unlike restoring ownership from archive, this is done even if not
+// run as root, which is only permitted for the current user and its groups.
+func WithOwner(uid, gid int) Option {
+	return func(c *config) { c.fixedOwner, c.uid, c.gid = true, uid, gid }
+}
+
+// owner returns user and group ids extracted entry should be owned by
+func (c *config) owner(hdr *tar.Header) (uid, gid int, err error) {
+	if c.fixedOwner && os.Getuid() != 0 {
+		uid, gid = os.Getuid(), os.Getgid()
+		if c.uid >= 0 {
+			uid = c.uid
+		}
+		if c.gid >= 0 {
+			gid = c.gid
+		}
+		return uid, gid, nil
+	}
+	if c.fixedOwner && c.uid >= 0 {
+		uid = c.uid
+	} else if id, ok := c.names.uid(hdr.Uname); ok {
+		uid = id
+	} else if uid, err = mapID(c.uidMap, hdr.Uid); err != nil {
+		return 0, 0, fmt.Errorf("user id %d: %w", hdr.Uid, err)
+	}
+	if c.fixedOwner && c.gid >= 0 {
+		gid = c.gid
+	} else if id, ok := c.names.gid(hdr.Gname); ok {
+		gid = id
+	} else if gid, err = mapID(c.gidMap, hdr.Gid); err != nil {
+		return 0, 0, fmt.Errorf("group id %d: %w", hdr.Gid, err)
+	}
+	return uid, gid, nil
+}
+
+// nameCache caches lookups of user and group names, nil cache finds nothing
+type nameCache struct {
+	mu     sync.Mutex
+	users  map[string]int // -1 for unknown names
+	groups map[string]int
+}
+
+func (nc *nameCache) uid(name string) (int, bool) {
+	if nc == nil || name == "" {
+		return 0, false
+	}
+	return nc.lookup(&nc.users, name, func() (string, error) {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return "", err
+		}
+		return u.Uid, nil
+	})
+}
+
+func (nc *nameCache) gid(name string) (int, bool) {
+	if nc == nil || name == "" {
+		return 0, false
+	}
+	return nc.lookup(&nc.groups, name, func() (string, error) {
+		g, err := user.LookupGroup(name)
+		if err != nil {
+			return "", err
+		}
+		return g.Gid, nil
+	})
+}
+
+func (nc *nameCache) lookup(m *map[string]int, name string, fn func() (string, error)) (int, bool) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	id, ok := (*m)[name]
+	if !ok {
+		id = -1
+		if s, err := fn(); err == nil {
+			if n, err := strconv.Atoi(s); err == nil {
+				id = n
+			}
+		}
+		if *m == nil {
+			*m = make(map[string]int)
+		}
+		(*m)[name] = id
+	}
+	return id, id >= 0
+}
+
+func mapID(m []IDMap, id int) (int, error) {
+	if m == nil {
+		return id, nil
+	}
+	for _, r := range m {
+		if id >= r.ContainerID && id < r.ContainerID+r.Size {
+			return r.HostID + id - r.ContainerID, nil
+		}
+	}
+	return 0, ErrUnmappedID
+}
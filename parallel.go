@@ -0,0 +1,157 @@
+package untar
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// WithWorkers makes Untar write regular files of up to 1 MiB with n
+// goroutines, while archive is read by the calling one: on fast storage
+// extraction of many small files is bound by system calls made for each of
+// them, not by reading. Files are written after their directories are
+// created; entries of other types wait for pending writes to finish. Entry
+// callbacks (see WithEntryFunc) may be called out of archive order, but not
+// concurrently.
+//
+// The option has no effect with WithFS, WithDryRun, WithVerify,
+// WithSkipIdentical, WithAuditLog and whiteouts, or if n is less than 2.
+func WithWorkers(n int) Option {
+	return func(c *config) { c.workers = n }
+}
+
+// maxParallelSize is the size of the largest file written by workers, larger
+// files are written by the goroutine reading archive
+const maxParallelSize = 1 << 20
+
+// fileJob is a regular file written by worker
+type fileJob struct {
+	hdr        *tar.Header
+	name       string
+	mode, perm os.FileMode
+	data       []byte
+	sparse     bool
+	chown      bool
+
+	n, disk int64 // results
+	err     error
+}
+
+// writerPool writes files with a number of goroutines
+type writerPool struct {
+	cfg     *config
+	jobs    chan *fileJob
+	done    chan *fileJob
+	wg      sync.WaitGroup
+	pending map[string]bool // names of files being written
+	err     error           // first write error
+}
+
+// newWriterPool starts workers if extraction can use them, otherwise it
+// returns nil
+func (c *config) newWriterPool() *writerPool {
+	if c.workers < 2 || !c.onOS() || c.audit != nil || c.dryRun || c.verify || c.digests || c.skipIdentical || c.whiteouts {
+		return nil
+	}
+	p := &writerPool{
+		cfg:     c,
+		jobs:    make(chan *fileJob, c.workers),
+		done:    make(chan *fileJob, c.workers),
+		pending: make(map[string]bool),
+	}
+	p.wg.Add(c.workers)
+	for i := 0; i < c.workers; i++ {
+		go func() {
+			defer p.wg.Done()
+			for j := range p.jobs {
+				j.n, j.disk, j.err = c.writeFile(j.name, j.perm, bytes.NewReader(j.data), nil, j.sparse)
+				if j.err == nil {
+					j.err = c.setTimes(j.name, j.hdr)
+				}
+				if j.err == nil {
+					j.err = c.setMeta(j.name, j.hdr, j.mode, j.chown)
+				}
+				j.data = nil
+				p.done <- j
+			}
+		}()
+	}
+	return p
+}
+
+// add reads file contents from rd and queues it for writing
+func (p *writerPool) add(rd io.Reader, j *fileJob) error {
+	j.data = make([]byte, j.hdr.Size)
+	if _, err := io.ReadFull(rd, j.data); err != nil {
+		return err
+	}
+	p.pending[j.name] = true
+	for {
+		select {
+		case p.jobs <- j:
+			return p.err
+		case j := <-p.done:
+			p.finish(j)
+		}
+	}
+}
+
+// finish accounts for written file
+func (p *writerPool) finish(j *fileJob) {
+	delete(p.pending, j.name)
+	if j.err != nil {
+		if err := p.cfg.entryFailed(j.hdr, j.err); err != nil && p.err == nil {
+			p.err = err
+		}
+		return
+	}
+	p.cfg.stats.Bytes += j.n
+	p.cfg.stats.DiskBytes += j.disk
+	p.cfg.entryDone(Entry{Header: j.hdr, Path: j.name})
+}
+
+// sync waits for pending writes entry hdr extracted to path name may depend
+// on, returning the first write error
+func (p *writerPool) sync(name string, hdr *tar.Header) error {
+	switch hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA, tar.TypeDir:
+		if !p.pending[name] {
+			return p.collect()
+		}
+	}
+	return p.wait()
+}
+
+// collect accounts for files written so far
+func (p *writerPool) collect() error {
+	for {
+		select {
+		case j := <-p.done:
+			p.finish(j)
+		default:
+			return p.err
+		}
+	}
+}
+
+// wait waits for all pending writes, returning the first write error
+func (p *writerPool) wait() error {
+	for len(p.pending) != 0 {
+		p.finish(<-p.done)
+	}
+	return p.err
+}
+
+// close stops workers once pending writes are done
+func (p *writerPool) close() {
+	close(p.jobs)
+	go func() {
+		p.wg.Wait()
+		close(p.done)
+	}()
+	for j := range p.done {
+		p.finish(j)
+	}
+}
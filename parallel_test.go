@@ -0,0 +1,86 @@
+package untar
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestWorkers(t *testing.T) {
+	var many []*tar.Header
+	for i := 0; i < 100; i++ {
+		many = append(many, reg(fmt.Sprintf("d%d/f%d", i%7, i)))
+	}
+	for _, tc := range []struct {
+		name    string
+		entries []*tar.Header
+	}{
+		{
+			name:    "many files",
+			entries: many,
+		},
+		{
+			name: "read-only directory",
+			entries: []*tar.Header{
+				{Name: "ro/", Typeflag: tar.TypeDir, Mode: 0555},
+				reg("ro/a"), reg("ro/b"),
+			},
+		},
+		{
+			name: "same name twice",
+			entries: []*tar.Header{
+				reg("file"),
+				{Name: "file", Typeflag: tar.TypeReg, Size: 2},
+				reg("file2"),
+			},
+		},
+		{
+			name: "link to file being written",
+			entries: []*tar.Header{
+				reg("file"),
+				{Name: "hard", Typeflag: tar.TypeLink, Linkname: "file"},
+				{Name: "file", Typeflag: tar.TypeSymlink, Linkname: "hard"},
+			},
+		},
+		{
+			name: "large file",
+			entries: []*tar.Header{
+				reg("small"),
+				{Name: "big", Typeflag: tar.TypeReg, Size: maxParallelSize + 1},
+				reg("small2"),
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			extract := func(opts ...Option) ([]string, Stats, []string) {
+				dst := t.TempDir()
+				var stats Stats
+				var seen []string
+				opts = append(opts, WithStats(&stats), WithEntryFunc(func(e Entry) {
+					seen = append(seen, e.Header.Name)
+				}))
+				t.Cleanup(func() { os.Chmod(filepath.Join(dst, "ro"), 0755) })
+				if err := Untar(tarball(t, tc.entries...), dst, opts...); err != nil {
+					t.Fatal(err)
+				}
+				tree := snapshotTree(t, dst)
+				sort.Strings(seen)
+				return tree, stats, seen
+			}
+			wantTree, wantStats, wantSeen := extract()
+			gotTree, gotStats, gotSeen := extract(WithWorkers(4))
+			if !equal(gotTree, wantTree) {
+				t.Errorf("with workers destination holds:\n%q\nwant:\n%q", gotTree, wantTree)
+			}
+			if gotStats.Entries != wantStats.Entries || gotStats.Bytes != wantStats.Bytes || gotStats.Files != wantStats.Files {
+				t.Errorf("with workers got stats %+v, want %+v", gotStats, wantStats)
+			}
+			if !equal(gotSeen, wantSeen) {
+				t.Errorf("with workers entries reported:\n%q\nwant:\n%q", gotSeen, wantSeen)
+			}
+		})
+	}
+}
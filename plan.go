@@ -0,0 +1,85 @@
+package untar
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+)
+
+// Action describes a change extraction of an entry makes to the destination
+// tree.
+type Action string
+
+// Actions reported in dry-run mode.
+const (
+	ActionCreate    Action = "create"    // path does not exist yet
+	ActionOverwrite Action = "overwrite" // existing path of the same type gets new content
+	ActionReplace   Action = "replace"   // existing path of different type is removed
+	ActionConflict  Action = "conflict"  // existing path cannot be replaced (non-empty directory)
+	ActionChmod     Action = "chmod"     // permissions change
+	ActionChown     Action = "chown"     // ownership change
+	ActionUnchanged Action = "unchanged" // path already matches entry
+)
+
+// WithDryRun makes Untar only read the archive and compare its entries with
+// the destination tree without making any changes. Planned changes are
+// reported in Entry.Actions, see WithEntryFunc. Stats count entries and bytes
+// that would be written. Entries are validated as in normal extraction, so
+// unsafe paths and unsupported entry types are reported as errors.
+func WithDryRun() Option {
+	return func(c *config) { c.dryRun = true }
+}
+
+// plan returns changes extraction of entry into path name would make
+func (c *config) plan(dst, name string, hdr *tar.Header, chown bool) ([]Action, error) {
+	st, err := c.compare(dst, name, hdr, chown)
+	switch {
+	case err != nil:
+		return nil, err
+	case st.fi == nil:
+		return []Action{ActionCreate}, nil
+	case st.typ && st.fi.IsDir() && !isEmptyDir(name):
+		return []Action{ActionConflict}, nil
+	case st.typ:
+		return []Action{ActionReplace}, nil
+	}
+	var actions []Action
+	if st.target || st.size || st.device ||
+		st.modTime && (hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA) {
+		actions = append(actions, ActionOverwrite)
+	}
+	if st.mode {
+		actions = append(actions, ActionChmod)
+	}
+	if st.owner {
+		actions = append(actions, ActionChown)
+	}
+	if len(actions) == 0 {
+		actions = append(actions, ActionUnchanged)
+	}
+	return actions, nil
+}
+
+func isEmptyDir(name string) bool {
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	_, err = f.Readdirnames(1)
+	return err == io.EOF
+}
+
+// plannedEntry records entry that would be extracted to path name, so that
+// checkPath sees the tree as it would be after extraction
+func (c *config) plannedEntry(dst, name string, hdr *tar.Header, mode os.FileMode) {
+	if c.planned == nil {
+		c.planned = make(map[string]plannedEntry)
+	}
+	p := plannedEntry{typ: mode.Type()}
+	if hdr.Typeflag == tar.TypeSymlink {
+		p.target = c.symlinkTarget(hdr, dst, name)
+		c.safeDirs = nil
+	}
+	c.planned[name] = p
+}
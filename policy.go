@@ -0,0 +1,81 @@
+package untar
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// WithoutSpecialFiles skips device nodes and named pipes.
+func WithoutSpecialFiles() Option {
+	return func(c *config) { c.noSpecial = true }
+}
+
+// WithPermissionMask clears given permission bits (including os.ModeSetuid,
+// os.ModeSetgid and os.ModeSticky) from modes of extracted entries.
+func WithPermissionMask(mask os.FileMode) Option {
+	return func(c *config) { c.permMask = mask }
+}
+
+// WithoutOwnership disables restoring ownership of extracted entries, which is
+// otherwise done when running as root. It takes precedence over WithOwner.
+func WithoutOwnership() Option {
+	return func(c *config) { c.noOwner = true }
+}
+
+// Policies lists names of option presets supported by PolicyOptions.
+var Policies = []string{"strict", "container", "backup", "legacy"}
+
+// StrictLimits are limits of "strict" policy, see PolicyOptions.
+var StrictLimits = Limits{
+	Entries:   1 << 20,
+	FileSize:  4 << 30,
+	TotalSize: 16 << 30,
+}
+
+// PolicyOptions returns named preset of options, one of Policies:
+//
+//   - strict is meant for untrusted archives: headers are validated with
+//     WithStrict, ownership is not restored, device nodes and named pipes
+//     are skipped, setuid, setgid, sticky and group/world write permissions
+//     are dropped, data after the end of archive is an error, archive may
+//     have at most 1Mi entries, 4GiB per file and 16GiB of files in total
+//     (StrictLimits);
+//   - container is meant for container root file systems: entries are
+//     restored as is, but operations not permitted in unprivileged
+//     containers are skipped with warnings, see WithBestEffort;
+//   - backup is meant for restoring backups over existing trees: entries are
+//     restored as is, existing symlinks to directories are kept, data after
+//     the end of archive is reported as a warning;
+//   - legacy matches behavior of Untar without options.
+//
+// Options given after the preset override its settings.
+func PolicyOptions(name string) ([]Option, error) {
+	switch name {
+	case "strict":
+		return []Option{
+			WithStrict(),
+			WithoutOwnership(),
+			WithoutSpecialFiles(),
+			WithPermissionMask(os.ModeSetuid | os.ModeSetgid | os.ModeSticky | 0022),
+			WithTrailingData(TrailingError),
+			WithLimits(StrictLimits),
+		}, nil
+	case "container":
+		return []Option{WithBestEffort()}, nil
+	case "backup":
+		return []Option{WithKeepDirectorySymlink(), WithTrailingData(TrailingWarn)}, nil
+	case "legacy":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown policy %q, supported are: %s", name, strings.Join(Policies, ", "))
+}
+
+func isSpecial(hdr *tar.Header) bool {
+	switch hdr.Typeflag {
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package untar
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestStrictLimits(t *testing.T) {
+	for _, tc := range []struct {
+		policy   string
+		size     int64
+		exceeded bool
+	}{
+		{"strict", StrictLimits.FileSize + 1, true},
+		{"legacy", StrictLimits.FileSize + 1, false},
+		{"strict", StrictLimits.FileSize, false},
+	} {
+		// archive is cut right after the header, file contents are
+		// never reached if limit is exceeded
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		if err := tw.WriteHeader(&tar.Header{Name: "big", Typeflag: tar.TypeReg, Size: tc.size, Mode: 0644}); err != nil {
+			t.Fatal(err)
+		}
+		opts, err := PolicyOptions(tc.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		it := NewIterator(&buf, opts...)
+		for it.Next() {
+		}
+		if err := it.Err(); errors.Is(err, ErrLimitExceeded) != tc.exceeded {
+			t.Errorf("%s policy, file of %d bytes: got error %v", tc.policy, tc.size, err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package untar
+
+import "io"
+
+// Progress describes the state of extraction passed to WithProgress
+// functions.
+type Progress struct {
+	Read    int64  // bytes read from tar stream so far
+	Entries int    // number of extracted entries
+	Bytes   int64  // number of bytes written to regular files
+	Name    string // name of the last extracted entry
+}
+
+// WithProgress registers a function called with extraction progress after
+// each archive entry is extracted. Progress.Read counts bytes Untar read from
+// its input, so if input size is known, it tells which part of it is done.
+func WithProgress(fn func(Progress)) Option {
+	return func(c *config) { c.progressFunc = append(c.progressFunc, fn) }
+}
+
+// progress calls progress functions after entry name is extracted
+func (c *config) progress(name string) {
+	p := Progress{Entries: c.stats.Entries, Bytes: c.stats.Bytes, Name: name}
+	if c.input != nil {
+		p.Read = c.input.n
+	}
+	for _, fn := range c.progressFunc {
+		fn(p)
+	}
+}
+
+// countingReader counts bytes read from the underlying reader
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,105 @@
+package untar
+
+import (
+	"io"
+	"sync"
+)
+
+// readahead decompresses data in a separate goroutine, so that decompression
+// overlaps with writing extracted files
+type readahead struct {
+	full  chan []byte // buffers with data
+	empty chan []byte // buffers ready to be filled
+	stop  chan struct{}
+	once  sync.Once
+	err   error  // set before full is closed
+	buf   []byte // buffer being read
+	cur   []byte // unread part of buf
+}
+
+const readaheadBuffers = 4
+
+// readaheadSize returns the size of each readahead buffer: buffers take up
+// to half of decoder memory limit, see WithDecoderMemory
+func readaheadSize(limit int64) int {
+	if limit == 0 {
+		return 1 << 20
+	}
+	return int(min(max(limit/2/readaheadBuffers, 32<<10), 1<<20))
+}
+
+// newReadahead starts reading r in the background using buffers of a given
+// size. If r is an io.Closer, it is closed once reading stops.
+func newReadahead(r io.Reader, size int) *readahead {
+	ra := &readahead{
+		// full can hold all buffers, so sending to it never blocks
+		full:  make(chan []byte, readaheadBuffers),
+		empty: make(chan []byte, readaheadBuffers),
+		stop:  make(chan struct{}),
+	}
+	for i := 0; i < readaheadBuffers; i++ {
+		ra.empty <- make([]byte, size)
+	}
+	go func() {
+		defer close(ra.full)
+		if c, ok := r.(io.Closer); ok {
+			defer c.Close()
+		}
+		for {
+			var buf []byte
+			select {
+			case buf = <-ra.empty:
+			case <-ra.stop:
+				return
+			}
+			n, err := fill(r, buf[:cap(buf)])
+			if n != 0 {
+				ra.full <- buf[:n]
+			}
+			if err != nil {
+				ra.err = err
+				return
+			}
+		}
+	}()
+	return ra
+}
+
+// fill reads from r until buf is full or reading fails. Unlike io.ReadFull,
+// it returns errors of r as is, so that io.ErrUnexpectedEOF of truncated
+// compressed stream is not mistaken for the end of data.
+func fill(r io.Reader, buf []byte) (int, error) {
+	var n int
+	for n < len(buf) {
+		m, err := r.Read(buf[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (ra *readahead) Read(p []byte) (int, error) {
+	if len(ra.cur) == 0 {
+		if ra.buf != nil {
+			ra.empty <- ra.buf
+			ra.buf = nil
+		}
+		buf, ok := <-ra.full
+		if !ok {
+			return 0, ra.err
+		}
+		ra.buf, ra.cur = buf, buf
+	}
+	n := copy(p, ra.cur)
+	ra.cur = ra.cur[n:]
+	return n, nil
+}
+
+// Close stops reading. It doesn't wait for the background goroutine, which may
+// be blocked reading the source until the archive file is closed.
+func (ra *readahead) Close() error {
+	ra.once.Do(func() { close(ra.stop) })
+	return nil
+}
@@ -0,0 +1,159 @@
+package untar
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// WithRollback makes Untar remove files and directories it created if
+// extraction fails, so that destination is left as it was before. Existing
+// files that were overwritten or replaced are not restored, see
+// WithAuditBackups and Undo for that.
+func WithRollback() Option {
+	return func(c *config) { c.rollback = true }
+}
+
+// rollbackFS is WriteFS recording paths it creates, so that they can be
+// removed if extraction fails
+type rollbackFS struct {
+	fs WriteFS
+
+	mu      sync.Mutex
+	created []string
+}
+
+// exists reports whether name exists; errors other than name not existing
+// are treated as if it exists, so that it is never removed
+func (r *rollbackFS) exists(name string) bool {
+	_, err := r.fs.Lstat(name)
+	return !os.IsNotExist(err)
+}
+
+func (r *rollbackFS) add(names ...string) {
+	r.mu.Lock()
+	r.created = append(r.created, names...)
+	r.mu.Unlock()
+}
+
+// create runs fn creating name, recording it if it didn't exist before
+func (r *rollbackFS) create(name string, fn func() error) error {
+	existed := r.exists(name)
+	if err := fn(); err != nil {
+		return err
+	}
+	if !existed {
+		r.add(name)
+	}
+	return nil
+}
+
+// undo removes created paths, newest first, returning the first error
+func (r *rollbackFS) undo() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var first error
+	for i := len(r.created) - 1; i >= 0; i-- {
+		if err := r.fs.RemoveAll(r.created[i]); err != nil && first == nil {
+			first = err
+		}
+	}
+	r.created = nil
+	return first
+}
+
+func (r *rollbackFS) OpenFile(name string, flag int, perm os.FileMode) (io.WriteCloser, error) {
+	existed := r.exists(name)
+	f, err := r.fs.OpenFile(name, flag, perm)
+	if err == nil && !existed {
+		r.add(name)
+	}
+	return f, err
+}
+
+func (r *rollbackFS) MkdirAll(name string, perm os.FileMode) error {
+	var created []string
+	for p := filepath.Clean(name); !r.exists(p) && p != filepath.Dir(p); p = filepath.Dir(p) {
+		created = append(created, p)
+	}
+	err := r.fs.MkdirAll(name, perm)
+	// parents are created first, even if MkdirAll fails later
+	for i := len(created) - 1; i >= 0; i-- {
+		if !r.exists(created[i]) {
+			break
+		}
+		r.add(created[i])
+	}
+	return err
+}
+
+func (r *rollbackFS) Remove(name string) error                  { return r.fs.Remove(name) }
+func (r *rollbackFS) RemoveAll(name string) error               { return r.fs.RemoveAll(name) }
+func (r *rollbackFS) Stat(name string) (os.FileInfo, error)     { return r.fs.Stat(name) }
+func (r *rollbackFS) Lstat(name string) (os.FileInfo, error)    { return r.fs.Lstat(name) }
+func (r *rollbackFS) Chmod(name string, mode os.FileMode) error { return r.fs.Chmod(name, mode) }
+func (r *rollbackFS) Chown(name string, uid, gid int) error     { return r.fs.Chown(name, uid, gid) }
+func (r *rollbackFS) Chtimes(name string, atime, mtime time.Time) error {
+	return r.fs.Chtimes(name, atime, mtime)
+}
+
+func (r *rollbackFS) ReadDir(name string) ([]os.DirEntry, error) {
+	fsys, ok := r.fs.(ReadDirFS)
+	if !ok {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: errors.ErrUnsupported}
+	}
+	return fsys.ReadDir(name)
+}
+
+func (r *rollbackFS) Symlink(oldname, newname string) error {
+	fsys, ok := r.fs.(SymlinkFS)
+	if !ok {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: errors.ErrUnsupported}
+	}
+	return r.create(newname, func() error { return fsys.Symlink(oldname, newname) })
+}
+
+func (r *rollbackFS) Readlink(name string) (string, error) {
+	fsys, ok := r.fs.(SymlinkFS)
+	if !ok {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: errors.ErrUnsupported}
+	}
+	return fsys.Readlink(name)
+}
+
+func (r *rollbackFS) Link(oldname, newname string) error {
+	fsys, ok := r.fs.(LinkFS)
+	if !ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: errors.ErrUnsupported}
+	}
+	return r.create(newname, func() error { return fsys.Link(oldname, newname) })
+}
+
+func (r *rollbackFS) Mknod(name string, mode uint32, dev int) error {
+	fsys, ok := r.fs.(NodeFS)
+	if !ok {
+		return &os.PathError{Op: "mknod", Path: name, Err: errors.ErrUnsupported}
+	}
+	return r.create(name, func() error { return fsys.Mknod(name, mode, dev) })
+}
+
+func (r *rollbackFS) Lsetxattr(name, attr string, data []byte) error {
+	fsys, ok := r.fs.(XattrFS)
+	if !ok {
+		return &os.PathError{Op: "setxattr", Path: name, Err: errors.ErrUnsupported}
+	}
+	return fsys.Lsetxattr(name, attr, data)
+}
+
+// rollBack removes what failed extraction created, see WithRollback
+func (c *config) rollBack() {
+	if r, ok := c.fs.(*rollbackFS); ok {
+		if err := r.undo(); err != nil {
+			c.warn(fmt.Errorf("rollback: %w", err))
+		}
+	}
+}
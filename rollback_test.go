@@ -0,0 +1,79 @@
+package untar
+
+import (
+	"archive/tar"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRollback(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		existing []string // slash-separated paths of files holding "old"
+		entries  []*tar.Header
+		fail     bool
+		want     []string // snapshotTree of destination after extraction
+	}{
+		{
+			name:     "failure",
+			existing: []string{"dir/old"},
+			entries: []*tar.Header{
+				reg("dir/new"),
+				{Name: "a/b/", Typeflag: tar.TypeDir, Mode: 0755},
+				reg("a/b/c"),
+				{Name: "dir/link", Typeflag: tar.TypeSymlink, Linkname: "old"},
+				reg("../evil"),
+			},
+			fail: true,
+			want: []string{"dir/", `dir/old "old"`},
+		},
+		{
+			name:     "overwritten files are kept",
+			existing: []string{"file"},
+			entries:  []*tar.Header{reg("file"), reg("../evil")},
+			fail:     true,
+			want:     []string{`file "file"`},
+		},
+		{
+			name:    "success",
+			entries: []*tar.Header{reg("dir/new")},
+			want:    []string{"dir/", `dir/new "dir/new"`},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dst := t.TempDir()
+			for _, name := range tc.existing {
+				p := filepath.Join(dst, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, []byte("old"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := Untar(tarball(t, tc.entries...), dst, WithRollback())
+			switch {
+			case tc.fail && !errors.Is(err, ErrUnsafePath):
+				t.Errorf("got error %v, want %v", err, ErrUnsafePath)
+			case !tc.fail && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			}
+			if got := snapshotTree(t, dst); !equal(got, tc.want) {
+				t.Errorf("destination holds:\n%q\nwant:\n%q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRollbackDestination(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "a", "dst")
+	err := Untar(tarball(t, reg("file"), reg("../evil")), dst, WithRollback())
+	if !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("got error %v, want %v", err, ErrUnsafePath)
+	}
+	if _, err := os.Lstat(filepath.Dir(dst)); !os.IsNotExist(err) {
+		t.Errorf("destination parent created by Untar is left: %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package untar
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WithUnsafe disables checks keeping entries inside the destination: entry
+// names and hard link targets with ".." elements are extracted as is, and
+// entries are written through symbolic links pointing anywhere. Use it only
+// with trusted archives.
+func WithUnsafe() Option {
+	return func(c *config) { c.unsafe = true }
+}
+
+// checkPath verifies that writing entry with clean slash-separated path rel
+// inside dst does not traverse symbolic links leading outside of dst;
+// absDst is absolute form of dst. If replace is true and rel itself is
+// a symbolic link, it is removed so that writing the entry doesn't follow it.
+//
+// With WithKeepDirectorySymlink symbolic links that existed before extraction
+// are trusted and followed wherever they point; the rest of the path is then
+// checked to stay inside such link.
+func (c *config) checkPath(dst, absDst, rel string, replace bool) error {
+	if rel == "" {
+		return nil
+	}
+	if unsafePath(rel) {
+		return fmt.Errorf("%s: %w", rel, ErrUnsafePath)
+	}
+	return c.checkElems(dst, absDst, rel, strings.Split(rel, "/"), replace, 0)
+}
+
+// checkElems does the work of checkPath for path elements elems relative to
+// dst, having followed hops symbolic links already
+func (c *config) checkElems(dst, absDst, rel string, elems []string, replace bool, hops int) error {
+	cur := dst
+	for len(elems) != 0 {
+		next := filepath.Join(cur, elems[0])
+		elems = elems[1:]
+		last := len(elems) == 0
+		if !last && c.safeDirs[next] {
+			cur = next
+			continue
+		}
+		typ, target, err := c.lstat(next)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil // nothing to traverse
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		if typ&os.ModeSymlink == 0 {
+			if last {
+				return nil
+			}
+			if !typ.IsDir() {
+				return nil // nothing to traverse, writing entry reports error
+			}
+			if c.safeDirs == nil {
+				c.safeDirs = make(map[string]bool)
+			}
+			c.safeDirs[next] = true
+			cur = next
+			continue
+		}
+		if last {
+			if replace {
+				return c.fs.Remove(next)
+			}
+			return nil
+		}
+		if hops++; hops > 40 {
+			return fmt.Errorf("%s: too many levels of symbolic links", rel)
+		}
+		var inside string
+		if filepath.IsAbs(target) {
+			inside, err = filepath.Rel(absDst, filepath.Clean(target))
+		} else {
+			inside, err = filepath.Rel(dst, filepath.Join(filepath.Dir(next), target))
+		}
+		if inside = filepath.ToSlash(inside); err != nil || unsafePath(inside) {
+			if c.keepDirSymlink && !c.newSymlink(next) {
+				// link becomes new root: relative paths below it
+				// are checked as is, absolute ones against the
+				// directory it resolves to
+				abs := target
+				if !filepath.IsAbs(abs) {
+					abs = filepath.Join(filepath.Dir(next), abs)
+				}
+				if abs, err = filepath.Abs(abs); err != nil {
+					return fmt.Errorf("%s: %w", rel, err)
+				}
+				return c.checkElems(next, abs, rel, elems, replace, hops)
+			}
+			return fmt.Errorf("%s: %w: %s is a symbolic link to %s", rel, ErrUnsafePath, next, target)
+		}
+		cur = dst
+		if inside != "." {
+			elems = append(strings.Split(inside, "/"), elems...)
+		}
+	}
+	return nil
+}
+
+// newSymlink reports whether symbolic link name was created by extraction
+// rather than existed before it
+func (c *config) newSymlink(name string) bool {
+	if _, ok := c.planned[name]; ok {
+		return true
+	}
+	return c.newSymlinks[name]
+}
+
+// lstat returns file type of name and symbolic link target if it's a link.
+// In dry-run mode entries already planned take precedence over the file
+// system, so that links the archive would create are followed.
+func (c *config) lstat(name string) (os.FileMode, string, error) {
+	if p, ok := c.planned[name]; ok {
+		return p.typ, p.target, nil
+	}
+	fi, err := c.fs.Lstat(name)
+	if err != nil {
+		return 0, "", err
+	}
+	if fi.Mode()&os.ModeSymlink == 0 {
+		return fi.Mode().Type(), "", nil
+	}
+	fsys, ok := c.fs.(SymlinkFS)
+	if !ok {
+		return 0, "", fmt.Errorf("cannot resolve symbolic link %s", name)
+	}
+	target, err := fsys.Readlink(name)
+	return os.ModeSymlink, target, err
+}
+
+// plannedEntry is an entry recorded in dry-run mode, see config.planned
+type plannedEntry struct {
+	typ    os.FileMode
+	target string // symbolic link target
+}
@@ -0,0 +1,281 @@
+package untar
+
+import (
+	"archive/tar"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestUnsafePath(t *testing.T) {
+	windows := runtime.GOOS == "windows"
+	for _, tc := range []struct {
+		name string
+		want bool
+	}{
+		{"", false},
+		{"a", false},
+		{"a/b", false},
+		{"..", true},
+		{"../a", true},
+		{"..a", false},
+		{"a..", false},
+		{`..\a`, windows},
+		{`a\..\..\b`, windows},
+		{"C:a", windows},
+		{"C:/a", windows},
+	} {
+		if got := unsafePath(tc.name); got != tc.want {
+			t.Errorf("unsafePath(%q) = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestUntarOutside(t *testing.T) {
+	windows := runtime.GOOS == "windows"
+	symlink := func(name, target string) *tar.Header {
+		return &tar.Header{Name: name, Typeflag: tar.TypeSymlink, Linkname: target}
+	}
+	link := func(name, target string) *tar.Header {
+		return &tar.Header{Name: name, Typeflag: tar.TypeLink, Linkname: target}
+	}
+	for _, tc := range []struct {
+		name    string
+		entries func(parent string) []*tar.Header
+		opts    []Option
+		unsafe  bool     // ErrUnsafePath expected
+		created []string // slash-separated paths expected inside dst
+	}{
+		{
+			name:    "dot-dot",
+			entries: func(string) []*tar.Header { return []*tar.Header{reg("../evil")} },
+			unsafe:  true,
+		},
+		{
+			name:    "dot-dot inside name",
+			entries: func(string) []*tar.Header { return []*tar.Header{reg("a/../../evil")} },
+			unsafe:  true,
+		},
+		{
+			name:    "absolute name",
+			entries: func(string) []*tar.Header { return []*tar.Header{reg("/abs/file")} },
+			created: []string{"abs", "abs/file"},
+		},
+		{
+			name: "file through relative symlink",
+			entries: func(string) []*tar.Header {
+				return []*tar.Header{symlink("link", "../outside"), reg("link/evil")}
+			},
+			unsafe:  true,
+			created: []string{"link"},
+		},
+		{
+			name: "file through absolute symlink",
+			entries: func(parent string) []*tar.Header {
+				return []*tar.Header{symlink("link", filepath.Join(parent, "outside")), reg("link/evil")}
+			},
+			unsafe:  true,
+			created: []string{"link"},
+		},
+		{
+			name: "file through symlink inside",
+			entries: func(string) []*tar.Header {
+				return []*tar.Header{symlink("link", "."), reg("link/file")}
+			},
+			created: []string{"file", "link"},
+		},
+		{
+			name:    "hard link out",
+			entries: func(string) []*tar.Header { return []*tar.Header{link("hl", "../outside/secret")} },
+			unsafe:  true,
+		},
+		{
+			name: "hard link through symlink",
+			entries: func(string) []*tar.Header {
+				return []*tar.Header{symlink("link", "../outside"), link("hl", "link/secret")}
+			},
+			unsafe:  true,
+			created: []string{"link"},
+		},
+		{
+			name:    "whiteout dot-dot",
+			entries: func(string) []*tar.Header { return []*tar.Header{reg(".wh..")} },
+			opts:    []Option{WithWhiteouts()},
+			unsafe:  true,
+		},
+		{
+			name:    "backslashes",
+			entries: func(string) []*tar.Header { return []*tar.Header{reg(`..\outside\evil`)} },
+			unsafe:  windows,
+			created: map[bool][]string{false: {`..\outside\evil`}}[windows],
+		},
+		{
+			name:    "volume name",
+			entries: func(string) []*tar.Header { return []*tar.Header{reg("C:/evil")} },
+			unsafe:  windows,
+			created: map[bool][]string{false: {"C:", "C:/evil"}}[windows],
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			parent := t.TempDir()
+			dst := filepath.Join(parent, "dst")
+			if err := os.Mkdir(dst, 0777); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Mkdir(filepath.Join(parent, "outside"), 0777); err != nil {
+				t.Fatal(err)
+			}
+			secret := filepath.Join(parent, "outside", "secret")
+			if err := os.WriteFile(secret, []byte("secret"), 0666); err != nil {
+				t.Fatal(err)
+			}
+			err := Untar(tarball(t, tc.entries(parent)...), dst, tc.opts...)
+			switch {
+			case tc.unsafe && !errors.Is(err, ErrUnsafePath):
+				t.Errorf("got error %v, want %v", err, ErrUnsafePath)
+			case !tc.unsafe && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, p := range walk(t, parent) {
+				if !strings.HasPrefix(p, "dst/") {
+					got = append(got, p)
+				}
+			}
+			if !equal(got, []string{"dst", "outside", "outside/secret"}) {
+				t.Errorf("parent of destination holds %q", got)
+			}
+			if got := walk(t, dst); !equal(got, tc.created) {
+				t.Errorf("destination holds %q, want %q", got, tc.created)
+			}
+		})
+	}
+}
+
+// walk returns sorted slash-separated paths of files inside dir, not
+// following symbolic links
+func walk(t *testing.T, dir string) []string {
+	t.Helper()
+	var out []string
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		out = append(out, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestKeepDirectorySymlink(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		entries []*tar.Header
+		unsafe  bool     // ErrUnsafePath expected
+		real    []string // slash-separated paths expected in directory lib points to
+	}{
+		{
+			name: "existing link",
+			entries: []*tar.Header{
+				{Name: "lib/", Typeflag: tar.TypeDir, Mode: 0755},
+				{Name: "lib/f", Typeflag: tar.TypeReg},
+			},
+			real: []string{"f"},
+		},
+		{
+			name: "link from archive",
+			entries: []*tar.Header{
+				{Name: "evil", Typeflag: tar.TypeSymlink, Linkname: "../real"},
+				{Name: "evil/f", Typeflag: tar.TypeReg},
+			},
+			unsafe: true,
+		},
+		{
+			name: "link from archive behind existing link",
+			entries: []*tar.Header{
+				{Name: "lib/evil", Typeflag: tar.TypeSymlink, Linkname: "../outside"},
+				{Name: "lib/evil/f", Typeflag: tar.TypeReg},
+			},
+			unsafe: true,
+			real:   []string{"evil"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			parent := t.TempDir()
+			dst := filepath.Join(parent, "dst")
+			for _, dir := range []string{dst, filepath.Join(parent, "real"), filepath.Join(parent, "outside")} {
+				if err := os.Mkdir(dir, 0777); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.Symlink("../real", filepath.Join(dst, "lib")); err != nil {
+				t.Fatal(err)
+			}
+			err := Untar(tarball(t, tc.entries...), dst, WithKeepDirectorySymlink())
+			switch {
+			case tc.unsafe && !errors.Is(err, ErrUnsafePath):
+				t.Errorf("got error %v, want %v", err, ErrUnsafePath)
+			case !tc.unsafe && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			}
+			if got := walk(t, filepath.Join(parent, "real")); !equal(got, tc.real) {
+				t.Errorf("symlinked directory holds %q, want %q", got, tc.real)
+			}
+			if got := walk(t, filepath.Join(parent, "outside")); len(got) != 0 {
+				t.Errorf("directory outside holds %q", got)
+			}
+		})
+	}
+}
+
+// plainFS is WriteFS without support of symbolic links
+type plainFS struct{ WriteFS }
+
+func TestUnresolvedSymlink(t *testing.T) {
+	parent := t.TempDir()
+	dst := filepath.Join(parent, "dst")
+	for _, dir := range []string{dst, filepath.Join(parent, "outside")} {
+		if err := os.Mkdir(dir, 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("../outside", filepath.Join(dst, "link")); err != nil {
+		t.Fatal(err)
+	}
+	err := Untar(tarball(t, reg("link/evil")), dst, WithFS(plainFS{osFS{}}))
+	if err == nil {
+		t.Error("extraction through symbolic link which cannot be resolved succeeded")
+	}
+	if got := walk(t, filepath.Join(parent, "outside")); len(got) != 0 {
+		t.Errorf("directory outside holds %q", got)
+	}
+}
+
+func reg(name string) *tar.Header { return &tar.Header{Name: name, Typeflag: tar.TypeReg} }
@@ -0,0 +1,61 @@
+package untar
+
+import (
+	"archive/tar"
+	"io"
+)
+
+// SinkFunc is called by UntarFunc for each regular file entry with its
+// slash-separated path (after stripping, see WithStripComponents and
+// WithSubdir) and header. It returns writer file contents are copied to, or
+// nil writer to skip the entry.
+type SinkFunc func(name string, hdr *tar.Header) (io.WriteCloser, error)
+
+// UntarFunc reads tar stream and passes contents of regular files to writers
+// returned by fn, without touching the file system. Other entry types are
+// skipped. Writers are closed after contents are copied; error returned by
+// fn, writer or its Close method stops the process.
+//
+// Selection options (filters, excludes, members) and WithStats apply;
+// options related to file system changes have no effect.
+func UntarFunc(r io.Reader, fn SinkFunc, opts ...Option) error {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return err
+	}
+	var buf []byte
+	if cfg.bufSize > 0 {
+		buf = make([]byte, cfg.bufSize)
+	} else {
+		bufp := copyBufPool.Get().(*[]byte)
+		defer copyBufPool.Put(bufp)
+		buf = *bufp
+	}
+	it := newIterator(r, cfg)
+	it.buf = buf
+	for it.Next() {
+		hdr, name := it.Header(), it.Path()
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		w, err := fn(name, hdr)
+		if err != nil {
+			return err
+		}
+		if w == nil {
+			cfg.stats.Skipped++
+			continue
+		}
+		n, err := io.CopyBuffer(w, it.Reader(), buf)
+		cfg.stats.Bytes += n
+		if err != nil {
+			w.Close()
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		cfg.entryDone(Entry{Header: hdr, Path: name})
+	}
+	return it.Err()
+}
@@ -0,0 +1,123 @@
+package untar
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// WithSkipIdentical makes Untar leave existing regular files intact if they
+// have the same size and modification time as archive entries (and the same
+// owner, if ownership is restored); metadata of such files is left intact
+// too. This makes repeated extraction over the same tree cheap.
+//
+// If compareContents is true, contents of such files are also compared with
+// archive data, and if they differ, only the differing part is rewritten.
+// Existing files of the same size but different modification time are
+// compared too, getting metadata of archive entries once their contents are
+// brought up to date. Contents comparison cannot be used with WithFS.
+func WithSkipIdentical(compareContents bool) Option {
+	return func(c *config) {
+		c.skipIdentical = true
+		c.compareContents = compareContents
+	}
+}
+
+// sameMeta reports whether existing file name has the same type, size,
+// modification time and, if chown is true, owner as hdr
+func (c *config) sameMeta(name string, hdr *tar.Header, chown bool) bool {
+	fi, err := c.fs.Lstat(name)
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() != hdr.Size || fi.ModTime().Unix() != hdr.ModTime.Unix() {
+		return false
+	}
+	if chown {
+		wantUID, wantGID, err := c.owner(hdr)
+		uid, gid, ok := fileOwner(fi)
+		return err == nil && ok && uid == wantUID && gid == wantGID
+	}
+	return true
+}
+
+// sameSize reports whether existing file name is a regular file of the same
+// size as hdr
+func (c *config) sameSize(name string, hdr *tar.Header) bool {
+	fi, err := c.fs.Lstat(name)
+	return err == nil && fi.Mode().IsRegular() && fi.Size() == hdr.Size
+}
+
+// updateFile compares contents of file name with data from rd, rewriting file
+// starting from the first differing byte; it returns number of bytes written
+func (c *config) updateFile(name string, rd io.Reader, buf []byte) (int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if len(buf) < 2 {
+		buf = make([]byte, 64<<10)
+	}
+	a, b := buf[:len(buf)/2], buf[len(buf)/2:]
+	var off int64
+	for {
+		n, rerr := io.ReadFull(rd, a)
+		if rerr != nil && rerr != io.EOF && rerr != io.ErrUnexpectedEOF {
+			return 0, rerr
+		}
+		m, _ := io.ReadFull(f, b[:n])
+		if i := mismatch(a[:n], b[:m]); i >= 0 {
+			return c.rewriteTail(name, off+int64(i), io.MultiReader(bytes.NewReader(a[i:n]), rd), b)
+		}
+		off += int64(n)
+		if rerr != nil {
+			return 0, nil
+		}
+	}
+}
+
+// rewriteTail writes data from rd to file name starting at offset off,
+// truncating the file at the end of written data
+func (c *config) rewriteTail(name string, off int64, rd io.Reader, buf []byte) (int64, error) {
+	w, err := c.fs.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer w.Close()
+	f, ok := w.(interface {
+		io.WriteSeeker
+		Truncate(int64) error
+	})
+	if !ok {
+		return 0, fmt.Errorf("%s: partial rewrite %w", name, errors.ErrUnsupported)
+	}
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.CopyBuffer(f, rd, buf)
+	if err != nil {
+		return n, err
+	}
+	if err := f.Truncate(off + n); err != nil {
+		return n, err
+	}
+	return n, w.Close()
+}
+
+// mismatch returns index of the first differing byte of a and b, or -1 if
+// they are equal
+func mismatch(a, b []byte) int {
+	if bytes.Equal(a, b) {
+		return -1
+	}
+	for i := range a {
+		if i == len(b) || a[i] != b[i] {
+			return i
+		}
+	}
+	if len(b) > len(a) {
+		return len(a)
+	}
+	return -1
+}
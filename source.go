@@ -0,0 +1,72 @@
+package untar
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SourceFunc opens archive identified by URL for reading.
+type SourceFunc func(ctx context.Context, u *url.URL) (io.ReadCloser, error)
+
+var (
+	sourcesMu sync.RWMutex
+	sources   = map[string]SourceFunc{"file": openFileSource}
+)
+
+// RegisterSource makes archives with URLs of given scheme available to
+// OpenSource, and so to the untar command. It panics if scheme is already
+// registered. RegisterSource is intended to be called from init functions.
+func RegisterSource(scheme string, fn SourceFunc) {
+	scheme = strings.ToLower(scheme)
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	if fn == nil {
+		panic("untar: RegisterSource with nil function")
+	}
+	if _, dup := sources[scheme]; dup {
+		panic("untar: RegisterSource called twice for scheme " + scheme)
+	}
+	sources[scheme] = fn
+}
+
+// Sources returns sorted list of registered source URL schemes.
+func Sources() []string {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+	out := make([]string, 0, len(sources))
+	for scheme := range sources {
+		out = append(out, scheme)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// OpenSource opens archive by its name, which is either a local file name or
+// URL ("scheme://...") of one of the schemes registered with RegisterSource.
+// Local files are returned as *os.File.
+func OpenSource(ctx context.Context, name string) (io.ReadCloser, error) {
+	if !strings.Contains(name, "://") {
+		return os.Open(name)
+	}
+	u, err := url.Parse(name)
+	if err != nil {
+		return nil, err
+	}
+	sourcesMu.RLock()
+	fn, ok := sources[strings.ToLower(u.Scheme)]
+	sourcesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported source scheme %q", name, u.Scheme)
+	}
+	return fn(ctx, u)
+}
+
+func openFileSource(_ context.Context, u *url.URL) (io.ReadCloser, error) {
+	return os.Open(u.Path)
+}
@@ -0,0 +1,89 @@
+package untar
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrNoSpace is returned when destination file system doesn't have enough
+// free space for archive contents, see WithSpaceCheck.
+var ErrNoSpace = errors.New("not enough free space")
+
+// WithSpaceCheck makes Untar check free space on destination file system
+// before writing regular files, failing with ErrNoSpace instead of running
+// out of space in the middle of extraction. If need is positive, it is the
+// total size of files archive is known to hold (e.g. from a first pass over
+// it), and is checked before anything is extracted. Otherwise, each file is
+// checked before it's written.
+//
+// The option has no effect with WithFS and WithDryRun, and on platforms not
+// reporting free space.
+func WithSpaceCheck(need int64) Option {
+	return func(c *config) {
+		c.spaceCheck = true
+		c.spaceNeed = need
+	}
+}
+
+// checkSpace checks that destination file system has space for the whole
+// archive, if its size is known, see WithSpaceCheck
+func (c *config) checkSpace(dst string) error {
+	if !c.spaceCheck || c.dryRun || !c.onOS() {
+		c.spaceCheck = false
+		return nil
+	}
+	c.spaceDir = existingDir(dst)
+	free, err := freeSpace(c.spaceDir)
+	if err != nil {
+		if errors.Is(err, errors.ErrUnsupported) {
+			c.spaceCheck = false
+			return nil
+		}
+		return err
+	}
+	if c.spaceNeed > free {
+		return fmt.Errorf("%w: needs %d bytes, only %d available", ErrNoSpace, c.spaceNeed, free)
+	}
+	c.spaceFree = free
+	return nil
+}
+
+// reserveSpace accounts for regular file of size bytes about to be written,
+// failing if it doesn't fit into free space. Free space is only queried again
+// once estimate of what's left runs out, as existing files being replaced or
+// other processes may change it.
+func (c *config) reserveSpace(name string, size int64) error {
+	if !c.spaceCheck {
+		return nil
+	}
+	// files take whole blocks
+	size = (size + holeBlock - 1) / holeBlock * holeBlock
+	if size > c.spaceFree {
+		free, err := freeSpace(c.spaceDir)
+		if err != nil {
+			return err
+		}
+		if size > free {
+			return fmt.Errorf("%s: %w: needs %d bytes, only %d available", name, ErrNoSpace, size, free)
+		}
+		c.spaceFree = free
+	}
+	c.spaceFree -= size
+	return nil
+}
+
+// existingDir returns dir or its closest existing parent
+func existingDir(dir string) string {
+	for {
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,86 @@
+package untar
+
+import (
+	"archive/tar"
+	"io"
+	"strings"
+)
+
+// isSparse reports whether hdr describes sparse file in one of GNU formats:
+// old GNU one or PAX records of "tar --posix -S"
+func isSparse(hdr *tar.Header) bool {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for k := range hdr.PAXRecords {
+		if strings.HasPrefix(k, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// holeBlock is the granularity of holes sparseWriter makes
+const holeBlock = 4096
+
+// sparseFile is a file sparseWriter can make holes in
+type sparseFile interface {
+	io.Writer
+	io.Seeker
+	Truncate(size int64) error
+}
+
+// sparseWriter writes to empty file, seeking over blocks of zeros instead of
+// writing them so that they become holes. Archive/tar expands sparse entries
+// with zeros and doesn't expose their hole maps, so holes are found by
+// contents.
+type sparseWriter struct {
+	f   sparseFile
+	off int64 // logical offset
+	pos int64 // offset of f
+}
+
+func (w *sparseWriter) Write(p []byte) (int, error) {
+	var n int
+	for len(p) != 0 {
+		k := holeBlock - int(w.off%holeBlock)
+		if k > len(p) {
+			k = len(p)
+		}
+		chunk := p[:k]
+		if !isZero(chunk) {
+			if w.pos != w.off {
+				if _, err := w.f.Seek(w.off, io.SeekStart); err != nil {
+					return n, err
+				}
+				w.pos = w.off
+			}
+			m, err := w.f.Write(chunk)
+			w.pos += int64(m)
+			if err != nil {
+				return n + m, err
+			}
+		}
+		w.off += int64(k)
+		n += k
+		p = p[k:]
+	}
+	return n, nil
+}
+
+// finish extends file to its full size if it ends with a hole
+func (w *sparseWriter) finish() error {
+	if w.pos == w.off {
+		return nil
+	}
+	return w.f.Truncate(w.off)
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+// +build !unix
+
+package untar
+
+import "os"
+
+func fileOwner(fi os.FileInfo) (uid, gid int, ok bool) { return 0, 0, false }
+func fileDevice(fi os.FileInfo) (uint64, bool)         { return 0, false }
+func inode(fi os.FileInfo) uint64                      { return 0 }
+func allocated(fi os.FileInfo) int64                   { return 0 }
@@ -0,0 +1,41 @@
+//go:build unix
+// +build unix
+
+package untar
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns numeric owner and group of a file
+func fileOwner(fi os.FileInfo) (uid, gid int, ok bool) {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return int(st.Uid), int(st.Gid), true
+	}
+	return 0, 0, false
+}
+
+// fileDevice returns device number of a device file
+func fileDevice(fi os.FileInfo) (uint64, bool) {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Rdev), true
+	}
+	return 0, false
+}
+
+// inode returns inode number of a file
+func inode(fi os.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
+
+// allocated returns disk space allocated for a file
+func allocated(fi os.FileInfo) int64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return int64(st.Blocks) * 512
+	}
+	return 0
+}
@@ -0,0 +1,105 @@
+package untar
+
+import (
+	"archive/tar"
+	"time"
+)
+
+// Stats holds extraction statistics, see WithStats.
+type Stats struct {
+	Entries int   `json:"entries"` // number of extracted entries
+	Bytes   int64 `json:"bytes"`   // number of bytes written to regular files
+
+	// DiskBytes is the disk space allocated for written regular files as
+	// reported by the file system; it is less than Bytes for sparse files
+	// and may be more due to block rounding. Space shared with other files
+	// (reflinks, deduplication) is counted in full.
+	DiskBytes int64 `json:"disk_bytes"`
+
+	// extracted entries by type
+	Files     int `json:"files"`
+	Dirs      int `json:"dirs"`
+	Symlinks  int `json:"symlinks"`
+	Hardlinks int `json:"hardlinks"`
+	Devices   int `json:"devices"`
+	Fifos     int `json:"fifos"`
+
+	// LinkGroups lists sets of entries sharing the same data via hard
+	// links, in order of their first appearance
+	LinkGroups []LinkGroup    `json:"link_groups,omitempty"`
+	linkIndex  map[string]int // entry name to LinkGroups index
+
+	// Unchanged is the number of existing regular files left intact as
+	// identical to archive entries, see WithSkipIdentical
+	Unchanged int `json:"unchanged,omitempty"`
+
+	Skipped  int           `json:"skipped"`          // entries skipped by filters
+	Failed   int           `json:"failed,omitempty"` // entries failed to extract, see WithKeepGoing
+	Warnings int           `json:"warnings"`         // non-fatal problems, see WithWarningFunc
+	Elapsed  time.Duration `json:"elapsed"`          // time spent extracting
+}
+
+// LinkGroup describes a set of archive entries referring to the same file.
+type LinkGroup struct {
+	Target string   `json:"target"` // entry the hard links point to
+	Links  []string `json:"links"`  // hard link entries
+
+	// Inode is the inode number of extracted file, 0 if unknown (as in
+	// dry-run mode)
+	Inode uint64 `json:"inode,omitempty"`
+}
+
+// WithStats makes Untar accumulate extraction statistics in s. The same Stats
+// can be passed to multiple Untar calls to get combined statistics.
+func WithStats(s *Stats) Option {
+	return func(c *config) { c.stats = s }
+}
+
+// WithWarningFunc registers a function called on non-fatal problems that don't
+// stop extraction, like timestamps that had to be adjusted.
+func WithWarningFunc(fn func(error)) Option {
+	return func(c *config) { c.warnFunc = fn }
+}
+
+func (c *config) warn(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Warnings++
+	if c.warnFunc != nil {
+		c.warnFunc(err)
+	}
+}
+
+func (s *Stats) count(hdr *tar.Header) {
+	s.Entries++
+	switch hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA:
+		s.Files++
+	case tar.TypeDir:
+		s.Dirs++
+	case tar.TypeSymlink:
+		s.Symlinks++
+	case tar.TypeLink:
+		s.Hardlinks++
+	case tar.TypeChar, tar.TypeBlock:
+		s.Devices++
+	case tar.TypeFifo:
+		s.Fifos++
+	}
+}
+
+// link records hard link entry name pointing to target in link groups
+func (s *Stats) link(target, name string, inode uint64) {
+	target, name = cleanName(target), cleanName(name)
+	if s.linkIndex == nil {
+		s.linkIndex = make(map[string]int)
+	}
+	i, ok := s.linkIndex[target]
+	if !ok {
+		i = len(s.LinkGroups)
+		s.LinkGroups = append(s.LinkGroups, LinkGroup{Target: target, Inode: inode})
+		s.linkIndex[target] = i
+	}
+	s.LinkGroups[i].Links = append(s.LinkGroups[i].Links, name)
+	s.linkIndex[name] = i
+}
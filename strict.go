@@ -0,0 +1,128 @@
+package untar
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrMalformed is returned for archive entries rejected in strict mode, see
+// WithStrict.
+var ErrMalformed = errors.New("malformed header")
+
+// Limits enforced in strict mode
+const (
+	strictMaxName = 4096    // PATH_MAX
+	strictMaxElem = 255     // NAME_MAX
+	strictMaxSize = 1 << 40 // 1 TiB
+)
+
+// WithStrict makes Untar reject archives with headers that are well-formed
+// enough to be parsed, but don't conform to the format or carry suspicious
+// values, as archives crafted to exploit extractors often do: unknown entry
+// types; empty, overlong or non-UTF-8 names and link targets; contents size
+// set for entries other than regular files, or exceeding 1 TiB; mode with
+// bits other than permissions; negative or out of range user and group ids,
+// device numbers and timestamps (before 1970 or more than a century ahead);
+// PAX records with unknown keys outside of vendor namespaces. Such entries
+// stop extraction with error wrapping ErrMalformed and describing the
+// problem. Checks apply to all entries, including ones not selected for
+// extraction.
+//
+// Header checksums are verified regardless of this option.
+func WithStrict() Option {
+	return func(c *config) { c.strict = true }
+}
+
+// checkHeader validates header in strict mode
+func checkHeader(hdr *tar.Header) error {
+	if err := headerProblem(hdr); err != "" {
+		return fmt.Errorf("%q: %w: %s", hdr.Name, ErrMalformed, err)
+	}
+	return nil
+}
+
+// headerProblem returns description of the first problem found in hdr, empty
+// if there is none
+func headerProblem(hdr *tar.Header) string {
+	switch hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA, tar.TypeLink, tar.TypeSymlink, tar.TypeChar,
+		tar.TypeBlock, tar.TypeDir, tar.TypeFifo, tar.TypeXGlobalHeader:
+	default:
+		return fmt.Sprintf("unknown entry type %q", hdr.Typeflag)
+	}
+	if msg := nameProblem("name", hdr.Name); msg != "" {
+		return msg
+	}
+	switch hdr.Typeflag {
+	case tar.TypeLink, tar.TypeSymlink:
+		if msg := nameProblem("link target", hdr.Linkname); msg != "" {
+			return msg
+		}
+	default:
+		if hdr.Linkname != "" {
+			return "link target set for entry that is not a link"
+		}
+	}
+	switch {
+	case hdr.Size < 0 || hdr.Size > strictMaxSize:
+		return fmt.Sprintf("size %d is out of range", hdr.Size)
+	case hdr.Size != 0 && hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA && hdr.Typeflag != tar.TypeXGlobalHeader:
+		return fmt.Sprintf("size %d set for entry that is not a regular file", hdr.Size)
+	case hdr.Mode&^07777 != 0:
+		return fmt.Sprintf("mode %#o has bits other than permissions", hdr.Mode)
+	case hdr.Uid < 0 || hdr.Uid > math.MaxInt32:
+		return fmt.Sprintf("user id %d is out of range", hdr.Uid)
+	case hdr.Gid < 0 || hdr.Gid > math.MaxInt32:
+		return fmt.Sprintf("group id %d is out of range", hdr.Gid)
+	case hdr.Devmajor < 0 || hdr.Devminor < 0 || hdr.Devmajor > math.MaxUint32 || hdr.Devminor > math.MaxUint32:
+		return fmt.Sprintf("device number %d:%d is out of range", hdr.Devmajor, hdr.Devminor)
+	case (hdr.Devmajor != 0 || hdr.Devminor != 0) && hdr.Typeflag != tar.TypeChar && hdr.Typeflag != tar.TypeBlock:
+		return "device number set for entry that is not a device"
+	}
+	latest := time.Now().AddDate(100, 0, 0)
+	for _, t := range []struct {
+		name string
+		time time.Time
+	}{{"modification", hdr.ModTime}, {"access", hdr.AccessTime}, {"change", hdr.ChangeTime}} {
+		if !t.time.IsZero() && (t.time.Unix() < 0 || t.time.After(latest)) {
+			return fmt.Sprintf("%s time %v is out of range", t.name, t.time)
+		}
+	}
+	for key := range hdr.PAXRecords {
+		if !strings.Contains(key, ".") && !knownPAXKeys[key] {
+			return fmt.Sprintf("unknown PAX record %q", key)
+		}
+	}
+	return ""
+}
+
+// knownPAXKeys lists PAX record keys defined by POSIX
+var knownPAXKeys = map[string]bool{
+	"atime": true, "charset": true, "comment": true, "ctime": true,
+	"gid": true, "gname": true, "hdrcharset": true, "linkpath": true,
+	"mtime": true, "path": true, "size": true, "uid": true, "uname": true,
+}
+
+func nameProblem(field, name string) string {
+	switch {
+	case name == "":
+		return field + " is empty"
+	case strings.IndexByte(name, 0) >= 0:
+		return field + " has NUL byte"
+	case !utf8.ValidString(name):
+		return field + " is not valid UTF-8"
+	case len(name) > strictMaxName:
+		return fmt.Sprintf("%s is %d bytes long, over %d", field, len(name), strictMaxName)
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if len(elem) > strictMaxElem {
+			return fmt.Sprintf("%s has %d bytes long element, over %d", field, len(elem), strictMaxElem)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+package untar
+
+import (
+	"archive/tar"
+	"io"
+	"path"
+	"strings"
+)
+
+// stripComponents removes n leading elements from slash-separated clean
+// relative path, returning empty string if nothing is left
+func stripComponents(name string, n int) string {
+	for ; n > 0 && name != ""; n-- {
+		i := strings.IndexByte(name, '/')
+		if i < 0 {
+			return ""
+		}
+		name = name[i+1:]
+	}
+	return name
+}
+
+// trimSubdir returns part of slash-separated clean relative path inside dir,
+// reporting false if name is not inside dir
+func trimSubdir(name, dir string) (string, bool) {
+	if !strings.HasPrefix(name, dir+"/") {
+		return "", false
+	}
+	return name[len(dir)+1:], true
+}
+
+// cleanName converts archive entry name to clean slash-separated path relative
+// to archive root, returning empty string for names referring to the root
+// itself
+func cleanName(name string) string {
+	name = strings.TrimLeft(path.Clean(name), "/")
+	if name == "." {
+		return ""
+	}
+	return name
+}
+
+// TopLevelDir reads tar stream and reports the name of the directory holding
+// all archive entries, as in typical "project-1.2.3/" source archive layout.
+// It returns empty string if entries do not share a single top level
+// directory. Result is suitable for deciding whether to use
+// WithStripComponents(1).
+func TopLevelDir(r io.Reader) (string, error) {
+	tr := tar.NewReader(r)
+	var top string
+	for {
+		hdr, err := tr.Next()
+		switch err {
+		case nil:
+		case io.EOF:
+			return top, nil
+		default:
+			return "", err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeXGlobalHeader, tar.TypeXHeader:
+			continue
+		}
+		name := cleanName(hdr.Name)
+		if name == "" {
+			continue
+		}
+		i := strings.IndexByte(name, '/')
+		if i < 0 && hdr.Typeflag != tar.TypeDir {
+			return "", nil // non-directory at the top level
+		}
+		first := name
+		if i >= 0 {
+			first = name[:i]
+		}
+		switch top {
+		case "":
+			top = first
+		case first:
+		default:
+			return "", nil
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package untar
+
+import (
+	"archive/tar"
+	"path"
+	"path/filepath"
+)
+
+// WithRelativeSymlinks rewrites absolute symlink targets into relative ones,
+// treating destination as file system root: symlink extracted to "usr/bin/sh"
+// pointing to "/bin/bash" is created as pointing to "../../bin/bash". This
+// keeps extracted root file system trees usable when they are not mounted at
+// /. Paths are the ones entries are extracted to, after options like
+// WithStripComponents are applied.
+func WithRelativeSymlinks() Option {
+	return func(c *config) { c.symlinks = symlinksRelative }
+}
+
+// WithAbsoluteSymlinks rewrites relative symlink targets into absolute ones,
+// treating destination as file system root: symlink extracted to "usr/bin/sh"
+// pointing to "../../bin/bash" is created as pointing to "/bin/bash". Targets
+// pointing outside of destination are left intact.
+func WithAbsoluteSymlinks() Option {
+	return func(c *config) { c.symlinks = symlinksAbsolute }
+}
+
+const (
+	symlinksAsIs = iota
+	symlinksRelative
+	symlinksAbsolute
+)
+
+// symlinkTarget returns target symlink entry extracted to path name inside
+// dst is to be created with. Conversions treat dst as file system root, so
+// that links stay inside the extracted tree whatever options like
+// WithStripComponents do to entry names.
+func (c *config) symlinkTarget(hdr *tar.Header, dst, name string) string {
+	target := hdr.Linkname
+	if c.symlinks == symlinksAsIs {
+		return filepath.Clean(target)
+	}
+	rel, err := filepath.Rel(dst, name)
+	if err != nil {
+		return filepath.Clean(target)
+	}
+	dir := path.Dir(filepath.ToSlash(rel))
+	switch {
+	case c.symlinks == symlinksRelative && path.IsAbs(target):
+		rel, err := filepath.Rel(filepath.FromSlash(dir), filepath.FromSlash(cleanName(target)))
+		if err == nil {
+			target = filepath.ToSlash(rel)
+		}
+	case c.symlinks == symlinksAbsolute && target != "" && !path.IsAbs(target):
+		joined := path.Join(dir, target)
+		if !unsafePath(joined) {
+			target = path.Join("/", joined)
+		}
+	}
+	return filepath.Clean(target)
+}
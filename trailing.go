@@ -0,0 +1,98 @@
+package untar
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// TrailingData controls what Untar does with data following the end of tar
+// stream, see WithTrailingData. Zero padding, which tar writers commonly add
+// to fill the last record, is never considered trailing data.
+type TrailingData string
+
+const (
+	TrailingIgnore TrailingData = "ignore" // don't read past end of archive
+	TrailingWarn   TrailingData = "warn"   // report trailing data as a warning
+	TrailingError  TrailingData = "error"  // fail with ErrTrailingData
+)
+
+// ErrTrailingData is returned when tar stream is followed by non-zero data and
+// TrailingError policy is used.
+var ErrTrailingData = errors.New("unexpected data after end of archive")
+
+// WithTrailingData sets how data after the end of tar stream is treated. By
+// default (TrailingIgnore) Untar stops reading once end of archive marker is
+// found; other policies make it read the stream to the end.
+func WithTrailingData(policy TrailingData) Option {
+	return func(c *config) { c.trailing = policy }
+}
+
+// WithIgnoreZeros makes Untar continue past end of archive markers: zero
+// blocks are skipped and the next tar stream is read, so that archives
+// concatenated with "cat a.tar b.tar" or padded with zeros are extracted in
+// full. Reading stops at the end of input; data that is neither zeros nor a
+// valid header is an error. TrailingData policy has no effect then.
+func WithIgnoreZeros() Option {
+	return func(c *config) { c.zeros = true }
+}
+
+// nextStream skips zero blocks following end of archive marker, reporting
+// whether br has another tar stream
+func nextStream(br *bufio.Reader) (bool, error) {
+	const blockSize = 512
+	for {
+		blk, err := br.Peek(blockSize)
+		if !isZero(blk) {
+			return true, nil
+		}
+		switch err {
+		case nil:
+		case io.EOF:
+			return false, nil
+		default:
+			return false, err
+		}
+		br.Discard(len(blk))
+	}
+}
+
+// checkTrailing reads the rest of r after the end of tar stream and handles
+// any non-zero data found according to configured policy; buf may be nil
+func (c *config) checkTrailing(r io.Reader, buf []byte) error {
+	if c.trailing == TrailingIgnore {
+		return nil
+	}
+	if buf == nil {
+		buf = make([]byte, 32<<10)
+	}
+	var n, total int64 // n is offset of the first non-zero byte + 1
+	for {
+		k, err := r.Read(buf)
+		for i, b := range buf[:k] {
+			if b != 0 {
+				if n == 0 {
+					n = total + int64(i) + 1
+				}
+				break
+			}
+		}
+		total += int64(k)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	err := fmt.Errorf("%w: %d bytes, non-zero data at offset %d", ErrTrailingData, total, n-1)
+	if c.trailing == TrailingError {
+		return err
+	}
+	c.warn(err)
+	return nil
+}
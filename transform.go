@@ -0,0 +1,136 @@
+package untar
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// WithTransform renames entries with sed-like substitution expressions of
+// the form "s/regexp/replacement/flags", as GNU tar --transform does: for
+// example "s,^build/output/,bin/," moves entries from build/output to bin.
+// Any character may be used as delimiter. Regular expressions use Go syntax;
+// in replacement, \1 to \9 stand for submatches and & for the whole match.
+// Flags are g to replace all matches, i for case-insensitive matching and a
+// number N to replace only the N-th match (or, with g, all starting from it).
+// Expressions are applied in order to entry names and hard link targets, before
+// other path handling like WithStripComponents and safety checks; entries
+// renamed to empty names are skipped. Entries are still selected by their
+// original names.
+func WithTransform(exprs ...string) Option {
+	return func(c *config) { c.transformExprs = append(c.transformExprs, exprs...) }
+}
+
+// transform is a compiled substitution expression, see WithTransform
+type transform struct {
+	re   *regexp.Regexp
+	repl string
+	all  bool // replace all matches starting from nth
+	nth  int  // 1-based index of the first match to replace
+}
+
+func parseTransform(expr string) (*transform, error) {
+	if len(expr) < 2 || expr[0] != 's' {
+		return nil, fmt.Errorf("transform %q: only s/regexp/replacement/flags expressions are supported", expr)
+	}
+	delim := expr[1:2]
+	parts := splitUnescaped(expr[2:], delim[0])
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("transform %q: want s%sregexp%sreplacement%sflags", expr, delim, delim, delim)
+	}
+	t := &transform{repl: parts[1], nth: 1}
+	pattern := parts[0]
+	for i := 0; i < len(parts[2]); i++ {
+		switch c := parts[2][i]; {
+		case c == 'g':
+			t.all = true
+		case c == 'i':
+			pattern = "(?i)" + pattern
+		case c >= '1' && c <= '9':
+			j := i
+			for j < len(parts[2]) && parts[2][j] >= '0' && parts[2][j] <= '9' {
+				j++
+			}
+			t.nth, _ = strconv.Atoi(parts[2][i:j])
+			i = j - 1
+		default:
+			return nil, fmt.Errorf("transform %q: unsupported flag %q", expr, c)
+		}
+	}
+	var err error
+	if t.re, err = regexp.Compile(pattern); err != nil {
+		return nil, fmt.Errorf("transform %q: %w", expr, err)
+	}
+	return t, nil
+}
+
+// splitUnescaped splits s by delim not preceded by backslash, removing
+// backslashes that escape delim
+func splitUnescaped(s string, delim byte) []string {
+	var parts []string
+	var cur strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == delim:
+			cur.WriteByte(delim)
+			i++
+		case s[i] == delim:
+			parts = append(parts, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(s[i])
+		}
+	}
+	return append(parts, cur.String())
+}
+
+func (t *transform) apply(name string) string {
+	n := -1
+	if !t.all {
+		n = t.nth
+	}
+	matches := t.re.FindAllStringSubmatchIndex(name, n)
+	if len(matches) < t.nth {
+		return name
+	}
+	matches = matches[t.nth-1:]
+	var b strings.Builder
+	prev := 0
+	for _, m := range matches {
+		b.WriteString(name[prev:m[0]])
+		t.expand(&b, name, m)
+		prev = m[1]
+	}
+	b.WriteString(name[prev:])
+	return b.String()
+}
+
+// expand writes replacement for match m of name to b
+func (t *transform) expand(b *strings.Builder, name string, m []int) {
+	for i := 0; i < len(t.repl); i++ {
+		switch c := t.repl[i]; {
+		case c == '&':
+			b.WriteString(name[m[0]:m[1]])
+		case c == '\\' && i+1 < len(t.repl):
+			i++
+			if d := t.repl[i]; d >= '0' && d <= '9' {
+				if k := int(d - '0'); 2*k+1 < len(m) && m[2*k] >= 0 {
+					b.WriteString(name[m[2*k]:m[2*k+1]])
+				}
+			} else {
+				b.WriteByte(d)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+// transformName applies WithTransform expressions to entry name
+func (c *config) transformName(name string) string {
+	for _, t := range c.transforms {
+		name = t.apply(name)
+	}
+	return name
+}
@@ -3,22 +3,25 @@
 //
 // Useful for cases where you'd want a replacement for external call to `tar x`.
 // It differs from `tar x` call by not setting proper times on symlinks itself.
-// Extended attributes are not supported.
+// Extended attributes are only restored with WithXattrs. Compressed archives
+// and other formats the untar command accepts can be read with Open.
 //
 // It's tested on OS X and Linux amd64 and is enough to unpack linux root
-// filesystem to a useable state.
+// filesystem to a useable state. On other platforms, like Windows, regular
+// files, directories, links and times are restored, while device nodes, named
+// pipes and extended attributes are skipped with a warning.
 package untar
 
 import (
 	"archive/tar"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"sync"
+	"syscall"
 	"time"
-
-	"golang.org/x/sys/unix"
 )
 
 // Untar extracts each item from a tar stream and saves it into file system
@@ -27,139 +30,505 @@ import (
 // directory does not exist, it will be created.
 //
 // Note that permissions on unpacked data would be set with current umask taken
-// into account; if you expect to get exact permissions, call syscall.Umask(0)
-// beforehand. This function does not call it itself as this changes umask
-// process-wide, so it's safer to do this explicitly.
+// into account; if you expect to get exact permissions, use
+// WithExactPermissions rather than changing umask process-wide.
+//
+// Modification times of directories, and permissions of new directories not
+// writable by owner, are set once the whole archive is extracted, so that
+// writing entries inside doesn't alter or fail on them.
 //
 // Owner/group of extracted files are set only if run as root (os.Getuid() == 0)
-// and are only set as numeric values, user/group names are not taken into
-// account.
-func Untar(f io.Reader, dst string) error {
-	isRoot := os.Getuid() == 0
-	tr := tar.NewReader(f)
+// or WithOwner is used, and are only set as numeric values, user/group names
+// are not taken into account unless WithOwnerNames is used.
+//
+// Extraction can be tuned with options, see functions returning Option.
+func Untar(f io.Reader, dst string, opts ...Option) error {
+	return UntarContext(context.Background(), f, dst, opts...)
+}
+
+// UntarContext works like Untar, but stops with ctx.Err() once ctx is done.
+// Context is checked before each entry and on each read from f; to interrupt
+// a read blocked on f, caller has to close it.
+func UntarContext(ctx context.Context, f io.Reader, dst string, opts ...Option) (err error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return err
+	}
+	if cfg.audit != nil {
+		defer func() {
+			if serr := cfg.audit.sync(); err == nil {
+				err = serr
+			}
+		}()
+	}
+	if cfg.rollback {
+		defer func() {
+			if err != nil {
+				cfg.rollBack()
+			}
+		}()
+	}
+	if ctx.Done() != nil {
+		f = &ctxReader{ctx: ctx, r: f}
+	}
+	if len(cfg.progressFunc) != 0 {
+		cfg.input = &countingReader{r: f}
+		f = cfg.input
+	}
+	var buf []byte
+	if cfg.bufSize > 0 {
+		buf = make([]byte, cfg.bufSize)
+	} else {
+		bufp := copyBufPool.Get().(*[]byte)
+		defer copyBufPool.Put(bufp)
+		buf = *bufp
+	}
+	defer func(start time.Time) { cfg.stats.Elapsed += time.Since(start) }(time.Now())
+	if cfg.baseline != "" {
+		if err := cfg.cloneBaseline(dst); err != nil {
+			return err
+		}
+	}
+	chown := (os.Getuid() == 0 || cfg.fixedOwner) && !cfg.noOwner
+	absDst, err := filepath.Abs(dst)
+	if err != nil {
+		return err
+	}
+	if err := cfg.checkSpace(absDst); err != nil {
+		return err
+	}
+	it := newIterator(f, cfg)
+	it.buf = buf
+	sum := cfg.verifyHash()
+	pool := cfg.newWriterPool()
+	if pool != nil {
+		defer pool.close()
+	}
 	for {
-		hdr, err := tr.Next()
-		switch err {
-		case nil:
-		case io.EOF:
-			return nil
-		default:
+		if err := ctx.Err(); err != nil {
 			return err
 		}
-		name := filepath.Join(dst, filepath.Clean(hdr.Name))
-		mode := hdr.FileInfo().Mode()
+		if !it.Next() {
+			if err := it.Err(); err != nil {
+				return err
+			}
+			if pool != nil {
+				if err := pool.wait(); err != nil {
+					return err
+				}
+			}
+			if err := cfg.resolveLinks(); err != nil {
+				return err
+			}
+			if cfg.baseline != "" {
+				if err := cfg.pruneBaseline(dst); err != nil {
+					return err
+				}
+			}
+			if err := cfg.restoreDirs(); err != nil {
+				return err
+			}
+			return cfg.entryErrors()
+		}
+		hdr := it.Header()
+		name := filepath.Join(dst, filepath.FromSlash(it.Path()))
+		if pool != nil {
+			if err := pool.sync(name, hdr); err != nil {
+				return err
+			}
+		}
+		keep, err := cfg.keepExisting(name, hdr)
+		if err != nil {
+			if err := cfg.entryFailed(hdr, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if !cfg.unsafe {
+			// in dry-run mode plan reports final symlink as replaced
+			replace := !cfg.dryRun && !keep && (hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA)
+			err := cfg.checkPath(dst, absDst, it.Path(), replace)
+			if err == nil && hdr.Typeflag == tar.TypeLink {
+				if target, ok := cfg.relPath(hdr.Linkname); ok {
+					err = cfg.checkPath(dst, absDst, target, false)
+				}
+			}
+			if err != nil {
+				if err := cfg.entryFailed(hdr, err); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if keep {
+			cfg.stats.Skipped++
+			continue
+		}
+		if cfg.whiteouts {
+			if ok, err := cfg.whiteout(dst, absDst, it.Path()); err != nil {
+				if err := cfg.entryFailed(hdr, err); err != nil {
+					return err
+				}
+				continue
+			} else if ok {
+				continue
+			}
+		}
+		mode := hdr.FileInfo().Mode() &^ cfg.permMask
+		perm := mode // mode entry is created with
+		if cfg.exactPerms {
+			// only owner has access until permissions are set
+			perm = mode &^ (os.ModePerm &^ ownerRWX) &^ (os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		}
+		if cfg.dryRun {
+			actions, err := cfg.plan(dst, name, hdr, chown)
+			if err != nil {
+				if err := cfg.entryFailed(hdr, err); err != nil {
+					return err
+				}
+				continue
+			}
+			switch hdr.Typeflag {
+			case tar.TypeReg, tar.TypeRegA:
+				switch actions[0] {
+				case ActionCreate, ActionOverwrite, ActionReplace:
+					cfg.stats.Bytes += hdr.Size
+				}
+			case tar.TypeLink:
+				cfg.stats.link(hdr.Linkname, hdr.Name, 0)
+			}
+			if actions[0] != ActionConflict {
+				cfg.plannedEntry(dst, name, hdr, mode)
+			}
+			cfg.entryDone(Entry{Header: hdr, Path: name, Actions: actions})
+			continue
+		}
+		if hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA {
+			if err := cfg.reserveSpace(hdr.Name, hdr.Size); err != nil {
+				return err
+			}
+		}
+		if pool != nil && (hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA) && hdr.Size <= maxParallelSize {
+			_ = cfg.fs.MkdirAll(filepath.Dir(name), 0777)
+			job := &fileJob{hdr: hdr, name: name, mode: mode, perm: perm, sparse: it.sparse, chown: chown}
+			if err := pool.add(it.Reader(), job); err != nil {
+				return err
+			}
+			continue
+		}
+		var unchanged bool      // existing file is left intact, see WithSkipIdentical
+		var widened os.FileMode // permissions added to new directory, see deferDir
 	ProcessHeader:
 		switch hdr.Typeflag {
 		case tar.TypeReg, tar.TypeRegA, tar.TypeLink, tar.TypeSymlink, tar.TypeFifo, tar.TypeChar, tar.TypeBlock:
 			// some arcihves may contain file entry in a directory
 			// without explicit directory entry before, ensure
 			// directory exists first on a best-effort approach
-			_ = os.MkdirAll(filepath.Dir(name), 0777)
+			_ = cfg.fs.MkdirAll(filepath.Dir(name), 0777)
 		}
 		switch hdr.Typeflag {
 		case tar.TypeReg, tar.TypeRegA:
-			err = writeFile(name, mode, tr)
+			var n, disk int64
+			rd := it.Reader()
+			if sum != nil {
+				sum.Reset()
+				rd = io.TeeReader(rd, sum)
+			}
+			if cfg.skipIdentical && cfg.sameMeta(name, hdr, chown) {
+				if cfg.compareContents {
+					n, err = cfg.updateFile(name, rd, buf)
+					unchanged = err == nil && n == 0
+				} else if sum != nil {
+					_, err = io.CopyBuffer(io.Discard, rd, buf)
+					unchanged = err == nil
+				} else {
+					unchanged = true
+				}
+				cfg.stats.Bytes += n
+				break
+			}
+			if cfg.compareContents && cfg.sameSize(name, hdr) {
+				// contents may match despite different metadata,
+				// as with rebuilt archives of the same release
+				n, err = cfg.updateFile(name, rd, buf)
+				cfg.stats.Bytes += n
+				break
+			}
+			n, disk, err = cfg.writeFile(name, perm, rd, buf, it.sparse)
+			cfg.stats.Bytes += n
+			cfg.stats.DiskBytes += disk
 		case tar.TypeDir:
-			err = os.MkdirAll(name, mode)
+			var kept bool
+			// make sure entries can be written inside new directory
+			if _, serr := cfg.fs.Lstat(name); serr != nil {
+				widened = ownerRWX &^ perm
+			}
+			if kept, err = mkdir(cfg.fs, name, perm|widened, cfg.keepDirSymlink); kept {
+				// existing symlink is used as is, don't alter
+				// metadata of the directory it points to
+				cfg.entryDone(Entry{Header: hdr, Path: name})
+				continue
+			}
 		case tar.TypeLink:
-			err = os.Link(filepath.Join(dst, filepath.Clean(hdr.Linkname)), name)
+			target, ok := cfg.destPath(dst, hdr.Linkname)
+			if !ok {
+				err = fmt.Errorf("%s: hard link target %q is not extracted", hdr.Name, hdr.Linkname)
+				break
+			}
+			err = cfg.hardlink(hdr, target, name)
+			if os.IsNotExist(err) {
+				if _, serr := cfg.fs.Lstat(target); os.IsNotExist(serr) {
+					cfg.linkLater(hdr, target, name)
+					continue
+				}
+			}
+			if err != nil && cfg.degraded("link", hdr.Name, err) {
+				cfg.stats.Skipped++
+				continue
+			}
 		case tar.TypeSymlink:
-			err = os.Symlink(filepath.Clean(hdr.Linkname), name)
+			cfg.safeDirs = nil // directory may be replaced with symlink
+			err = cfg.symlink(cfg.symlinkTarget(hdr, dst, name), name)
+			if err == nil && cfg.keepDirSymlink {
+				if cfg.newSymlinks == nil {
+					cfg.newSymlinks = make(map[string]bool)
+				}
+				cfg.newSymlinks[name] = true
+			}
+			if err != nil && cfg.degraded("symlink", hdr.Name, err) {
+				cfg.stats.Skipped++
+				continue
+			}
 		case tar.TypeFifo:
-			err = unix.Mkfifo(name, syscallMode(mode))
+			err = cfg.mknod(name, syscallMode(perm), 0)
+			if err != nil && cfg.degraded("mkfifo", hdr.Name, err) {
+				cfg.stats.Skipped++
+				continue
+			}
 		case tar.TypeChar, tar.TypeBlock:
-			err = unix.Mknod(name, syscallMode(mode), devNo(hdr.Devmajor, hdr.Devminor))
-		case tar.TypeXGlobalHeader, tar.TypeXHeader:
-			continue
+			err = cfg.mknod(name, syscallMode(perm), devNo(hdr.Devmajor, hdr.Devminor))
+			if err != nil && cfg.degraded("mknod", hdr.Name, err) {
+				cfg.stats.Skipped++
+				continue
+			}
 		default:
-			return fmt.Errorf("unsupported header type flag for %[2]q: %#[1]x (%[1]q)", hdr.Typeflag, hdr.Name)
+			err = fmt.Errorf("unsupported header type flag for %[2]q: %#[1]x (%[1]q)", hdr.Typeflag, hdr.Name)
 		}
 		if err != nil {
 			if os.IsExist(err) {
 				// if file already exists, try to remove it and
 				// re-process — this is for everything except
 				// directories and regular files
-				if os.Remove(name) == nil {
+				if cfg.fs.Remove(name) == nil {
 					goto ProcessHeader
 				}
 			}
-			return err
+			if err := cfg.entryFailed(hdr, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if unchanged {
+			cfg.stats.Unchanged++
 		}
 		switch hdr.Typeflag {
 		case tar.TypeReg, tar.TypeRegA, tar.TypeDir, tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
-			if !hdr.AccessTime.IsZero() || !hdr.ModTime.IsZero() {
-				now := time.Now()
-				atime, mtime := hdr.AccessTime, hdr.ModTime
-				// fix times that don't fit unix epoch
-				if atime.UnixNano() < 0 {
-					atime = now
-				}
-				if mtime.UnixNano() < 0 {
-					mtime = now
-				}
-				if err := os.Chtimes(name, atime, mtime); err != nil {
-					return err
-				}
+			if unchanged {
+				break
 			}
-			if isRoot {
-				if err := os.Chown(name, hdr.Uid, hdr.Gid); err != nil {
-					return err
-				}
-				// group change resets special attributes like
-				// setgid, restore them
-				if mode&os.ModeSetgid != 0 || mode&os.ModeSetuid != 0 {
-					if err := os.Chmod(name, mode); err != nil {
-						return err
-					}
-				}
+			if hdr.Typeflag == tar.TypeDir {
+				// writing entries inside changes directory times
+				cfg.deferDir(name, hdr, mode, widened)
+			} else {
+				err = cfg.setTimes(name, hdr)
+			}
+			if err == nil {
+				err = cfg.setMeta(name, hdr, mode, chown)
+			}
+		}
+		var digest []byte
+		if sum != nil && (hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA) {
+			digest = sum.Sum(nil)
+		}
+		if err == nil && cfg.verify {
+			err = cfg.verifyEntry(dst, name, hdr, digest)
+		}
+		if err != nil {
+			if err := cfg.entryFailed(hdr, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if hdr.Typeflag == tar.TypeLink {
+			var ino uint64
+			if fi, err := cfg.fs.Lstat(name); err == nil {
+				ino = inode(fi)
+			}
+			cfg.stats.link(hdr.Linkname, hdr.Name, ino)
+		}
+		entry := Entry{Header: hdr, Path: name, Unchanged: unchanged}
+		if cfg.digests {
+			entry.Digest = digest
+		}
+		cfg.entryDone(entry)
+	}
+}
+
+// mkdir creates directory name. If name is an existing symlink, it is replaced
+// with a directory, unless keepSymlink is true and symlink points to
+// a directory: in this case symlink is left intact and mkdir returns true.
+func mkdir(fsys WriteFS, name string, mode os.FileMode, keepSymlink bool) (bool, error) {
+	if fi, err := fsys.Lstat(name); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		if keepSymlink {
+			if fi, err := fsys.Stat(name); err == nil && fi.IsDir() {
+				return true, nil
 			}
 		}
+		if err := fsys.Remove(name); err != nil {
+			return false, err
+		}
+	}
+	return false, fsys.MkdirAll(name, mode)
+}
+
+// setMeta sets ownership (if chown is true), permissions (if they are not set
+// on creation) and extended attributes of extracted entry
+func (c *config) setMeta(name string, hdr *tar.Header, mode os.FileMode, chown bool) error {
+	chmod := c.exactPerms && hdr.Typeflag != tar.TypeDir
+	if chown {
+		uid, gid, err := c.owner(hdr)
+		if err != nil {
+			return err
+		}
+		if err := c.fs.Chown(name, uid, gid); err != nil {
+			if !c.degraded("chown", hdr.Name, err) {
+				return err
+			}
+		} else if mode&os.ModeSetgid != 0 || mode&os.ModeSetuid != 0 {
+			// group change resets special attributes like
+			// setgid, restore them
+			chmod = true
+		}
+	}
+	if chmod {
+		if err := c.fs.Chmod(name, mode); err != nil {
+			return err
+		}
+	}
+	if c.ntfsPerms && hdr.Typeflag != tar.TypeDir && c.onOS() {
+		// directories get theirs once their contents are written,
+		// see restoreDir
+		if err := setNTFSPermissions(name, hdr, mode); err != nil && !c.degraded("setacl", hdr.Name, err) {
+			return err
+		}
+	}
+	if c.xattrs || c.selinux {
+		return c.setXattrs(name, hdr)
+	}
+	return nil
+}
+
+// setTimes sets access and modification times of file name from hdr
+func (c *config) setTimes(name string, hdr *tar.Header) error {
+	if hdr.AccessTime.IsZero() && hdr.ModTime.IsZero() {
+		return nil
+	}
+	now := time.Now()
+	atime, mtime := hdr.AccessTime, hdr.ModTime
+	// fix times that don't fit unix epoch
+	if atime.UnixNano() < 0 {
+		atime = now
 	}
+	if mtime.UnixNano() < 0 {
+		if !mtime.IsZero() {
+			c.warn(fmt.Errorf("%s: modification time %v is out of range, using current time", hdr.Name, mtime))
+		}
+		mtime = now
+	}
+	return c.fs.Chtimes(name, atime, mtime)
 }
 
-func writeFile(name string, fm os.FileMode, rd io.Reader) error {
-	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fm)
+// writeFile writes file contents, returning number of bytes written and disk
+// space allocated for the file; if sparse is true, blocks of zeros are left
+// as holes
+func (c *config) writeFile(name string, fm os.FileMode, rd io.Reader, buf []byte, sparse bool) (n, disk int64, err error) {
+	f, err := c.fs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fm)
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
 	defer f.Close()
-	bufp := copyBufPool.Get().(*[]byte)
-	defer copyBufPool.Put(bufp)
-	if _, err := io.CopyBuffer(f, rd, *bufp); err != nil {
-		return err
+	if c.removePartial {
+		defer func() {
+			if err != nil {
+				f.Close()
+				_ = c.fs.Remove(name)
+			}
+		}()
+	}
+	if sf, ok := f.(sparseFile); ok && sparse {
+		sw := &sparseWriter{f: sf}
+		if n, err = io.CopyBuffer(sw, rd, buf); err != nil {
+			return n, 0, err
+		}
+		if err := sw.finish(); err != nil {
+			return n, 0, err
+		}
+	} else if n, err = io.CopyBuffer(f, rd, buf); err != nil {
+		return n, 0, err
+	}
+	if f, ok := f.(interface{ Stat() (os.FileInfo, error) }); ok {
+		if fi, err := f.Stat(); err == nil {
+			disk = allocated(fi)
+		}
 	}
-	return f.Close()
+	return n, disk, f.Close()
 }
 
 // syscallMode returns the syscall-specific mode bits from Go's portable mode bits.
 func syscallMode(i os.FileMode) (o uint32) {
 	o |= uint32(i.Perm())
 	if i&os.ModeSetuid != 0 {
-		o |= unix.S_ISUID
+		o |= syscall.S_ISUID
 	}
 	if i&os.ModeSetgid != 0 {
-		o |= unix.S_ISGID
+		o |= syscall.S_ISGID
 	}
 	if i&os.ModeSticky != 0 {
-		o |= unix.S_ISVTX
+		o |= syscall.S_ISVTX
 	}
 	if i&os.ModeNamedPipe != 0 {
-		o |= unix.S_IFIFO
+		o |= syscall.S_IFIFO
 	}
 	if i&os.ModeDevice != 0 {
 		switch i & os.ModeCharDevice {
 		case 0:
-			o |= unix.S_IFBLK
+			o |= syscall.S_IFBLK
 		default:
-			o |= unix.S_IFCHR
+			o |= syscall.S_IFCHR
 		}
 	}
 	return
 }
 
+// ctxReader fails reads once context is done
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// defaultBufSize is the size of buffer used to copy file contents
+const defaultBufSize = 512 * 1024
+
 var copyBufPool = sync.Pool{
 	New: func() interface{} {
-		b := make([]byte, 512*1024)
+		b := make([]byte, defaultBufSize)
 		return &b
 	},
 }
@@ -1,5 +1,42 @@
+//go:build darwin
 // +build darwin
 
 package untar
 
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
 func devNo(major, minor int64) int { return int((major << 24) + minor) }
+
+func setOpaque(dir string) error {
+	return errors.New("overlayfs opaque directories are not supported on this platform")
+}
+
+// dropCache flushes file data to storage and disables caching of further
+// reads
+func dropCache(f *os.File) error {
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	_, err := unix.FcntlInt(f.Fd(), unix.F_NOCACHE, 1)
+	return err
+}
+
+// reflink creates file dst as copy-on-write clone of src
+func reflink(src, dst string) error {
+	return unix.Clonefile(src, dst, unix.CLONE_NOFOLLOW)
+}
+
+// freeSpace returns space available to unprivileged users on file system
+// holding dir
+func freeSpace(dir string) (int64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
@@ -1,5 +1,55 @@
+//go:build linux
 // +build linux
 
 package untar
 
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
 func devNo(major, minor int64) int { return int((major << 8) + minor) }
+
+// setOpaque marks directory as opaque for overlayfs
+func setOpaque(dir string) error {
+	return unix.Setxattr(dir, "trusted.overlay.opaque", []byte("y"), 0)
+}
+
+// dropCache flushes file data to storage and evicts it from page cache, so
+// that following reads hit the storage
+func dropCache(f *os.File) error {
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED)
+}
+
+// reflink creates file dst as copy-on-write clone of src
+func reflink(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlFileClone(int(out.Fd()), int(in.Fd())); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// freeSpace returns space available to unprivileged users on file system
+// holding dir
+func freeSpace(dir string) (int64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
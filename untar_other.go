@@ -0,0 +1,23 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package untar
+
+import (
+	"errors"
+	"os"
+)
+
+func devNo(major, minor int64) int { return int((major << 8) + minor) }
+
+func setOpaque(dir string) error {
+	return errors.New("overlayfs opaque directories are not supported on this platform")
+}
+
+// dropCache flushes file data to storage; reads may still be served from
+// cache on this platform
+func dropCache(f *os.File) error { return f.Sync() }
+
+func reflink(src, dst string) error { return errors.ErrUnsupported }
+
+func freeSpace(dir string) (int64, error) { return 0, errors.ErrUnsupported }
@@ -0,0 +1,112 @@
+package untar
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// ErrVerify is returned when extracted entry does not match the archive, see
+// WithVerify.
+var ErrVerify = errors.New("verification failed")
+
+// WithVerify makes Untar read back each regular file once it is written and
+// compare its SHA-256 hash, size and modification time with the archive
+// entry; symbolic link targets and hard links are checked too. Files are
+// flushed to storage and, where supported, evicted from the operating system
+// cache before reading, so that storage corruption is caught rather than
+// masked by cached data. Mismatch stops extraction with error wrapping
+// ErrVerify. Permissions are not compared as they depend on umask.
+//
+// It cannot be used with WithFS.
+func WithVerify() Option {
+	return func(c *config) { c.verify = true }
+}
+
+// WithDigests makes Untar compute SHA-256 hash of each regular file as it is
+// written and report it in Entry.Digest, see WithEntryFunc. Data is hashed
+// while being copied, so it's not read again. Files are written sequentially
+// with this option, as with WithVerify.
+func WithDigests() Option {
+	return func(c *config) { c.digests = true }
+}
+
+// verifyEntry checks extracted entry against its header; sum is SHA-256 hash
+// of regular file data as it was read from archive
+func (c *config) verifyEntry(dst, name string, hdr *tar.Header, sum []byte) error {
+	fail := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%s: %w: %s", hdr.Name, ErrVerify, fmt.Sprintf(format, args...))
+	}
+	fi, err := os.Lstat(name)
+	if err != nil {
+		return fail("%v", err)
+	}
+	switch hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA:
+		if !fi.Mode().IsRegular() {
+			return fail("not a regular file")
+		}
+		if fi.Size() != hdr.Size {
+			return fail("size is %d, want %d", fi.Size(), hdr.Size)
+		}
+		if mtime := hdr.ModTime; mtime.UnixNano() >= 0 && fi.ModTime().Unix() != mtime.Unix() {
+			return fail("modification time is %v, want %v", fi.ModTime(), mtime)
+		}
+		got, err := fileHash(name)
+		if err != nil {
+			return fail("%v", err)
+		}
+		if !bytes.Equal(got, sum) {
+			return fail("content hash mismatch")
+		}
+	case tar.TypeSymlink:
+		target, err := os.Readlink(name)
+		if err != nil {
+			return fail("%v", err)
+		}
+		if want := c.symlinkTarget(hdr, dst, name); target != want {
+			return fail("symlink points to %q, want %q", target, want)
+		}
+	case tar.TypeLink:
+		target, _ := c.destPath(dst, hdr.Linkname)
+		tfi, err := os.Lstat(target)
+		if err != nil {
+			return fail("%v", err)
+		}
+		if !os.SameFile(fi, tfi) {
+			return fail("not a hard link to %s", hdr.Linkname)
+		}
+	}
+	return nil
+}
+
+// fileHash returns SHA-256 hash of file contents read from storage
+func fileHash(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := dropCache(f); err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// verifyHash returns hash to accumulate regular file data for verification
+// or digests, nil if both are disabled
+func (c *config) verifyHash() hash.Hash {
+	if !c.verify && !c.digests || c.dryRun {
+		return nil
+	}
+	return sha256.New()
+}
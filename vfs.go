@@ -0,0 +1,149 @@
+package untar
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// WriteFS is a file system Untar extracts to, see WithFS. Names passed to its
+// methods are destination directory joined with entry paths. Methods follow
+// semantics of os package functions of the same name; errors should be
+// compatible with os.IsExist and os.IsNotExist checks.
+//
+// File systems may additionally implement SymlinkFS, LinkFS, NodeFS and XattrFS
+// to support corresponding entry types; extraction of such entries into file
+// systems not implementing these interfaces fails with errors wrapping
+// errors.ErrUnsupported, see also WithBestEffort.
+type WriteFS interface {
+	// OpenFile opens file for writing; if returned value has
+	// Stat() (os.FileInfo, error) method, it is used for statistics.
+	OpenFile(name string, flag int, perm os.FileMode) (io.WriteCloser, error)
+	MkdirAll(name string, perm os.FileMode) error
+	Remove(name string) error
+	RemoveAll(name string) error
+	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	Chmod(name string, mode os.FileMode) error
+	Chown(name string, uid, gid int) error
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// SymlinkFS is a WriteFS supporting symbolic links.
+type SymlinkFS interface {
+	WriteFS
+	Symlink(oldname, newname string) error
+	Readlink(name string) (string, error)
+}
+
+// LinkFS is a WriteFS supporting hard links.
+type LinkFS interface {
+	WriteFS
+	Link(oldname, newname string) error
+}
+
+// NodeFS is a WriteFS supporting named pipes and device nodes. Mode passed to
+// Mknod holds both permissions and file type bits (syscall.S_IFIFO,
+// syscall.S_IFCHR or syscall.S_IFBLK).
+type NodeFS interface {
+	WriteFS
+	Mknod(name string, mode uint32, dev int) error
+}
+
+// ReadDirFS is a WriteFS able to list directories, which is needed to apply
+// opaque whiteouts, see WithWhiteouts.
+type ReadDirFS interface {
+	WriteFS
+	ReadDir(name string) ([]os.DirEntry, error)
+}
+
+// WithFS makes Untar extract to fsys instead of the operating system file
+// system. It cannot be used together with WithDryRun, WithWhiteouts,
+// WithOverlayWhiteouts, WithAuditBackups, WithVerify, WithBaseline and
+// contents comparison of WithSkipIdentical, which only work with operating
+// system file system.
+func WithFS(fsys WriteFS) Option {
+	return func(c *config) { c.fs = fsys }
+}
+
+func (c *config) symlink(oldname, newname string) error {
+	if fsys, ok := c.fs.(SymlinkFS); ok {
+		return fsys.Symlink(oldname, newname)
+	}
+	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: errors.ErrUnsupported}
+}
+
+func (c *config) link(oldname, newname string) error {
+	if fsys, ok := c.fs.(LinkFS); ok {
+		return fsys.Link(oldname, newname)
+	}
+	return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: errors.ErrUnsupported}
+}
+
+func (c *config) mknod(name string, mode uint32, dev int) error {
+	if fsys, ok := c.fs.(NodeFS); ok {
+		return fsys.Mknod(name, mode, dev)
+	}
+	return &os.PathError{Op: "mknod", Path: name, Err: errors.ErrUnsupported}
+}
+
+// readDir returns names of directory entries
+func (c *config) readDir(name string) ([]string, error) {
+	fsys, ok := c.fs.(ReadDirFS)
+	if !ok {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: errors.ErrUnsupported}
+	}
+	entries, err := fsys.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	return names, nil
+}
+
+// checkFS reports options that can't be used with custom file system
+func (c *config) checkFS() error {
+	if _, ok := c.fs.(osFS); ok {
+		return nil
+	}
+	switch {
+	case c.dryRun:
+		return fmt.Errorf("dry-run mode %w with custom file system", errors.ErrUnsupported)
+	case c.whiteouts:
+		return fmt.Errorf("whiteouts are %w with custom file system", errors.ErrUnsupported)
+	case c.baseline != "":
+		return fmt.Errorf("baseline is %w with custom file system", errors.ErrUnsupported)
+	case c.compareContents:
+		return fmt.Errorf("contents comparison is %w with custom file system", errors.ErrUnsupported)
+	case c.verify:
+		return fmt.Errorf("verification is %w with custom file system", errors.ErrUnsupported)
+	case c.backupDir != "":
+		return fmt.Errorf("audit backups are %w with custom file system", errors.ErrUnsupported)
+	}
+	return nil
+}
+
+// osFS is WriteFS of the operating system
+type osFS struct{}
+
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (io.WriteCloser, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (osFS) MkdirAll(name string, perm os.FileMode) error      { return os.MkdirAll(name, perm) }
+func (osFS) Remove(name string) error                          { return os.Remove(name) }
+func (osFS) RemoveAll(name string) error                       { return os.RemoveAll(name) }
+func (osFS) Stat(name string) (os.FileInfo, error)             { return os.Stat(name) }
+func (osFS) Lstat(name string) (os.FileInfo, error)            { return os.Lstat(name) }
+func (osFS) Chmod(name string, mode os.FileMode) error         { return os.Chmod(name, mode) }
+func (osFS) Chown(name string, uid, gid int) error             { return os.Chown(name, uid, gid) }
+func (osFS) Chtimes(name string, atime, mtime time.Time) error { return os.Chtimes(name, atime, mtime) }
+func (osFS) Symlink(oldname, newname string) error             { return os.Symlink(oldname, newname) }
+func (osFS) Readlink(name string) (string, error)              { return os.Readlink(name) }
+func (osFS) Link(oldname, newname string) error                { return os.Link(oldname, newname) }
+func (osFS) ReadDir(name string) ([]os.DirEntry, error)        { return os.ReadDir(name) }
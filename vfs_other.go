@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package untar
+
+import (
+	"errors"
+	"os"
+)
+
+func (osFS) Lsetxattr(name, attr string, data []byte) error {
+	return &os.PathError{Op: "setxattr", Path: name, Err: errors.ErrUnsupported}
+}
+
+func (osFS) Mknod(name string, mode uint32, dev int) error {
+	return &os.PathError{Op: "mknod", Path: name, Err: errors.ErrUnsupported}
+}
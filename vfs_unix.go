@@ -0,0 +1,17 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package untar
+
+import "golang.org/x/sys/unix"
+
+func (osFS) Lsetxattr(name, attr string, data []byte) error {
+	return unix.Lsetxattr(name, attr, data, 0)
+}
+
+func (osFS) Mknod(name string, mode uint32, dev int) error {
+	if mode&unix.S_IFMT == unix.S_IFIFO {
+		return unix.Mkfifo(name, mode&^unix.S_IFMT)
+	}
+	return unix.Mknod(name, mode, dev)
+}
@@ -0,0 +1,47 @@
+//go:build windows
+// +build windows
+
+package untar
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// adsXattrPrefix is the namespace of extended attributes stored as NTFS
+// alternate data streams, see WithXattrs
+const adsXattrPrefix = "user."
+
+// Lsetxattr writes user.* attribute as alternate data stream of file name,
+// named after the attribute without the prefix. Other attributes have no
+// NTFS equivalent.
+func (osFS) Lsetxattr(name, attr string, data []byte) error {
+	stream := strings.TrimPrefix(attr, adsXattrPrefix)
+	if stream == attr || stream == "" || strings.ContainsAny(stream, `:\/`) {
+		return &os.PathError{Op: "setxattr", Path: name, Err: errors.ErrUnsupported}
+	}
+	p, err := windows.UTF16PtrFromString(name + ":" + stream)
+	if err != nil {
+		return &os.PathError{Op: "setxattr", Path: name, Err: err}
+	}
+	// don't follow symbolic links, backup semantics allow opening
+	// directories
+	h, err := windows.CreateFile(p, windows.GENERIC_WRITE, 0, nil, windows.CREATE_ALWAYS,
+		windows.FILE_FLAG_OPEN_REPARSE_POINT|windows.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return &os.PathError{Op: "setxattr", Path: name, Err: err}
+	}
+	f := os.NewFile(uintptr(h), name+":"+stream)
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (osFS) Mknod(name string, mode uint32, dev int) error {
+	return &os.PathError{Op: "mknod", Path: name, Err: errors.ErrUnsupported}
+}
@@ -0,0 +1,117 @@
+package untar
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// whiteoutPrefix marks entries of container image layers that remove paths
+// from lower layers; opaqueWhiteout marks a directory whose contents from
+// lower layers are hidden.
+const (
+	whiteoutPrefix = ".wh."
+	opaqueWhiteout = ".wh..wh..opq"
+)
+
+// WithWhiteouts treats the archive as an OCI (docker) image layer applied on
+// top of lower layers already extracted to the destination: whiteout entries
+// (".wh.name") remove matching paths and opaque whiteouts (".wh..wh..opq")
+// remove lower layer contents of their directories. Whiteout entries themselves
+// are not extracted.
+func WithWhiteouts() Option {
+	return func(c *config) { c.whiteouts = true }
+}
+
+// WithOverlayWhiteouts works like WithWhiteouts, but instead of applying
+// whiteouts to the destination, it translates them to overlayfs format, so
+// that destination can be used as overlayfs upper or lower directory:
+// whiteouts become character devices with 0/0 device number and opaque
+// directories get "trusted.overlay.opaque" extended attribute. Creating
+// these requires root privileges.
+func WithOverlayWhiteouts() Option {
+	return func(c *config) { c.whiteouts, c.overlay = true, true }
+}
+
+// whiteout handles whiteout entry with clean slash-separated path rel
+// extracted to dst, reporting false if entry is not a whiteout and has to be
+// extracted. Paths extracted from the current layer are remembered so that
+// whiteouts don't affect them.
+func (c *config) whiteout(dst, absDst, rel string) (bool, error) {
+	name := filepath.Join(dst, filepath.FromSlash(rel))
+	dir, base := filepath.Split(name)
+	dir = filepath.Clean(dir)
+	if !strings.HasPrefix(base, whiteoutPrefix) {
+		if c.layerPaths == nil {
+			c.layerPaths = make(map[string]bool)
+		}
+		for p := name; p != dst && !c.layerPaths[p]; p = filepath.Dir(p) {
+			c.layerPaths[p] = true
+			if p == filepath.Dir(p) {
+				break
+			}
+		}
+		return false, nil
+	}
+	if base != opaqueWhiteout {
+		// removed path must be a sibling of whiteout entry
+		switch target := base[len(whiteoutPrefix):]; {
+		case target == "", target == ".", target == "..", strings.ContainsRune(target, filepath.Separator):
+			return true, fmt.Errorf("%s: %w: invalid whiteout", rel, ErrUnsafePath)
+		}
+		if !c.unsafe {
+			err := c.checkPath(dst, absDst, path.Join(path.Dir(rel), base[len(whiteoutPrefix):]), false)
+			if err != nil {
+				return true, err
+			}
+		}
+	}
+	if c.dryRun {
+		return true, nil
+	}
+	if c.overlay {
+		return true, c.overlayWhiteout(dir, base)
+	}
+	if base == opaqueWhiteout {
+		names, err := c.readDir(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			return true, nil
+		}
+		if err != nil {
+			return true, err
+		}
+		for _, n := range names {
+			if p := filepath.Join(dir, n); !c.layerPaths[p] {
+				if err := c.fs.RemoveAll(p); err != nil {
+					return true, err
+				}
+			}
+		}
+		return true, nil
+	}
+	p := filepath.Join(dir, base[len(whiteoutPrefix):])
+	if c.layerPaths[p] {
+		return true, nil
+	}
+	return true, c.fs.RemoveAll(p)
+}
+
+// overlayWhiteout creates overlayfs equivalent of whiteout entry base in
+// directory dir
+func (c *config) overlayWhiteout(dir, base string) error {
+	if err := c.fs.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	if base == opaqueWhiteout {
+		return setOpaque(dir)
+	}
+	p := filepath.Join(dir, base[len(whiteoutPrefix):])
+	if err := c.fs.RemoveAll(p); err != nil {
+		return err
+	}
+	return c.mknod(p, syscall.S_IFCHR, devNo(0, 0))
+}
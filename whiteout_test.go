@@ -0,0 +1,120 @@
+package untar
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tarball returns uncompressed tar archive holding entries with given
+// headers; regular files get their name as contents, or as many "x" bytes as
+// header Size is set to.
+func tarball(t *testing.T, hdrs ...*tar.Header) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range hdrs {
+		hdr := *hdr
+		var data []byte
+		if hdr.Typeflag == tar.TypeReg {
+			data = []byte(hdr.Name)
+			if hdr.Size != 0 {
+				data = bytes.Repeat([]byte("x"), int(hdr.Size))
+			}
+			hdr.Size = int64(len(data))
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestWhiteoutOutside(t *testing.T) {
+	for _, name := range []string{".wh...", "sub/.wh..", ".wh..", ".wh."} {
+		t.Run(name, func(t *testing.T) {
+			parent := t.TempDir()
+			dst := filepath.Join(parent, "dst")
+			for _, p := range []string{"sibling", "dst/keep", "dst/sub/keep"} {
+				p = filepath.Join(parent, filepath.FromSlash(p))
+				if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, nil, 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r := tarball(t, &tar.Header{Name: name, Typeflag: tar.TypeReg})
+			err := Untar(r, dst, WithWhiteouts())
+			if !errors.Is(err, ErrUnsafePath) {
+				t.Errorf("got error %v, want %v", err, ErrUnsafePath)
+			}
+			for _, p := range []string{"sibling", "dst/keep", "dst/sub/keep"} {
+				if _, err := os.Lstat(filepath.Join(parent, filepath.FromSlash(p))); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
+
+func TestWhiteoutThroughSymlink(t *testing.T) {
+	parent := t.TempDir()
+	dst := filepath.Join(parent, "dst")
+	if err := os.MkdirAll(filepath.Join(parent, "outside"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	victim := filepath.Join(parent, "outside", "victim")
+	if err := os.WriteFile(victim, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	r := tarball(t,
+		&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../outside"},
+		&tar.Header{Name: "link/.wh.victim", Typeflag: tar.TypeReg},
+	)
+	if err := Untar(r, dst, WithWhiteouts()); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("got error %v, want %v", err, ErrUnsafePath)
+	}
+	if _, err := os.Lstat(victim); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWhiteouts(t *testing.T) {
+	dst := t.TempDir()
+	for _, p := range []string{"gone", "opaque/old", "kept"} {
+		p = filepath.Join(dst, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := tarball(t,
+		&tar.Header{Name: ".wh.gone", Typeflag: tar.TypeReg},
+		&tar.Header{Name: "opaque/new", Typeflag: tar.TypeReg},
+		&tar.Header{Name: "opaque/.wh..wh..opq", Typeflag: tar.TypeReg},
+	)
+	if err := Untar(r, dst, WithWhiteouts()); err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]bool{"gone": false, "opaque/old": false, "opaque/new": true, "kept": true, ".wh.gone": false} {
+		_, err := os.Lstat(filepath.Join(dst, filepath.FromSlash(p)))
+		if got := err == nil; got != want {
+			t.Errorf("%s: exists %v, want %v", p, got, want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package untar
+
+import (
+	"archive/tar"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// XattrFS is a WriteFS supporting extended attributes. Lsetxattr must not
+// follow symbolic links.
+type XattrFS interface {
+	WriteFS
+	Lsetxattr(name, attr string, data []byte) error
+}
+
+// WithXattrs makes Untar restore extended attributes stored in PAX records
+// of archives created with "tar --xattrs" (SCHILY.xattr.* keys) or bsdtar
+// (LIBARCHIVE.xattr.* keys), like user.* attributes or file capabilities
+// (security.capability). SELinux contexts are only restored with WithSELinux.
+// Attributes of namespaces the process is not permitted to set are skipped
+// with a warning. On Windows user.* attributes become NTFS alternate data
+// streams named without the prefix, other namespaces are skipped.
+func WithXattrs() Option {
+	return func(c *config) { c.xattrs = true }
+}
+
+// WithSELinux makes Untar restore SELinux security contexts of entries, stored
+// either as security.selinux extended attribute or in RHT.security.selinux
+// PAX records of archives created with "tar --selinux". Contexts are set as
+// found in archive, relabel the tree (e.g. with restorecon) if it is
+// restored on a system with a different policy.
+func WithSELinux() Option {
+	return func(c *config) { c.selinux = true }
+}
+
+const (
+	xattrPrefix      = "SCHILY.xattr."        // PAX key prefix of extended attributes
+	libarchivePrefix = "LIBARCHIVE.xattr."    // the same with escaped names and base64 values
+	selinuxKey       = "RHT.security.selinux" // PAX key of SELinux context
+	selinuxXattr     = "security.selinux"     // extended attribute of SELinux context
+)
+
+// xattr is extended attribute to set
+type xattr struct {
+	name, value string
+}
+
+// entryXattrs returns extended attributes of hdr to restore, sorted by name
+func (c *config) entryXattrs(hdr *tar.Header) []xattr {
+	var attrs []xattr
+	for k, v := range hdr.PAXRecords {
+		var name string
+		switch {
+		case k == selinuxKey:
+			if _, ok := hdr.PAXRecords[xattrPrefix+selinuxXattr]; ok {
+				continue // same context stored twice
+			}
+			name = selinuxXattr
+		case strings.HasPrefix(k, xattrPrefix):
+			name = k[len(xattrPrefix):]
+		case strings.HasPrefix(k, libarchivePrefix):
+			var err error
+			if name, err = url.PathUnescape(k[len(libarchivePrefix):]); err != nil {
+				continue
+			}
+			if _, ok := hdr.PAXRecords[xattrPrefix+name]; ok {
+				continue // bsdtar stores both forms
+			}
+			b, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(v, "="))
+			if err != nil {
+				continue
+			}
+			v = string(b)
+		default:
+			continue
+		}
+		if name == "" || (name == selinuxXattr && !c.selinux) || (name != selinuxXattr && !c.xattrs) {
+			continue
+		}
+		attrs = append(attrs, xattr{name: name, value: v})
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].name < attrs[j].name })
+	return attrs
+}
+
+// setXattrs sets extended attributes of hdr on file name. Attributes are set
+// after ownership is changed, as chown clears file capabilities.
+func (c *config) setXattrs(name string, hdr *tar.Header) error {
+	attrs := c.entryXattrs(hdr)
+	if len(attrs) == 0 {
+		return nil
+	}
+	fsys, ok := c.fs.(XattrFS)
+	if !ok {
+		return &os.PathError{Op: "setxattr", Path: name, Err: errors.ErrUnsupported}
+	}
+	for _, attr := range attrs {
+		err := fsys.Lsetxattr(name, attr.name, []byte(attr.value))
+		if err == nil {
+			continue
+		}
+		if !isPermission(err) {
+			return fmt.Errorf("%s: setting extended attribute %s: %w", hdr.Name, attr.name, err)
+		}
+		ns := attr.name
+		if attr.name == selinuxXattr {
+			ns = "SELinux"
+		} else if i := strings.IndexByte(ns, '.'); i > 0 {
+			ns = ns[:i]
+		}
+		if c.firstFailure("setxattr " + ns) {
+			c.warn(fmt.Errorf("%s: cannot set %s extended attributes (%v), skipping them for this and further entries", hdr.Name, ns, err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package untar
+
+import (
+	"archive/tar"
+	"reflect"
+	"testing"
+)
+
+func TestEntryXattrs(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		records map[string]string
+		selinux bool
+		want    []xattr
+	}{
+		{"gnu", map[string]string{"SCHILY.xattr.user.a": "1", "SCHILY.xattr.user.b": "2"}, false,
+			[]xattr{{"user.a", "1"}, {"user.b", "2"}}},
+		{"libarchive", map[string]string{"LIBARCHIVE.xattr.user.a": "dmFsdWU="}, false,
+			[]xattr{{"user.a", "value"}}},
+		{"libarchive unpadded", map[string]string{"LIBARCHIVE.xattr.user.a": "dmFsdWU"}, false,
+			[]xattr{{"user.a", "value"}}},
+		{"libarchive escaped name", map[string]string{"LIBARCHIVE.xattr.user.a%3Db": "eA=="}, false,
+			[]xattr{{"user.a=b", "x"}}},
+		{"libarchive duplicate", map[string]string{"SCHILY.xattr.user.a": "1", "LIBARCHIVE.xattr.user.a": "Mg=="}, false,
+			[]xattr{{"user.a", "1"}}},
+		{"libarchive bad base64", map[string]string{"LIBARCHIVE.xattr.user.a": "!!"}, false, nil},
+		{"selinux disabled", map[string]string{"RHT.security.selinux": "ctx"}, false, nil},
+		{"selinux", map[string]string{"RHT.security.selinux": "ctx"}, true,
+			[]xattr{{"security.selinux", "ctx"}}},
+	} {
+		c := &config{xattrs: true, selinux: tc.selinux}
+		got := c.entryXattrs(&tar.Header{PAXRecords: tc.records})
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}